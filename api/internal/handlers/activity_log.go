@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ukoni/internal/services"
+)
+
+type ActivityLogHandler struct {
+	Service *services.ActivityLogService
+}
+
+func (h *ActivityLogHandler) ListActivity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	q, err := parseActivityQuery(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	page, err := h.Service.ListActivity(r.Context(), userID, r.PathValue("id"), q)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *ActivityLogHandler) GetProductHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	q, err := parseActivityQuery(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	page, err := h.Service.GetProductHistory(r.Context(), userID, r.PathValue("id"), q)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseActivityQuery reads the activity filters from the query string. Times
+// are RFC 3339.
+func parseActivityQuery(r *http.Request) (services.ActivityQuery, error) {
+	query := r.URL.Query()
+	q := services.ActivityQuery{
+		UserID:     query.Get("actor"),
+		Action:     query.Get("action"),
+		EntityType: query.Get("entity_type"),
+		EntityID:   query.Get("entity_id"),
+		Cursor:     query.Get("cursor"),
+	}
+	if l := query.Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v <= 0 {
+			return q, services.BadRequest("invalid limit")
+		}
+		q.Limit = v
+	}
+	if s := query.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, services.BadRequest("invalid since, expected RFC 3339")
+		}
+		q.Since = &t
+	}
+	if u := query.Get("until"); u != "" {
+		t, err := time.Parse(time.RFC3339, u)
+		if err != nil {
+			return q, services.BadRequest("invalid until, expected RFC 3339")
+		}
+		q.Until = &t
+	}
+	return q, nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"ukoni/internal/models"
+	"ukoni/internal/services"
+)
+
+type APIKeyHandler struct {
+	Service *services.APIKeyService
+}
+
+// ListAPIKeys lists the logged-in user's API keys
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	keys, err := h.Service.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKey creates an API key and returns it once, in full
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name        string     `json:"name"`
+		InventoryID *string    `json:"inventory_id"`
+		Scope       string     `json:"scope"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	key, token, err := h.Service.CreateAPIKey(r.Context(), userID, services.CreateAPIKeyInput{
+		Name:        req.Name,
+		InventoryID: req.InventoryID,
+		Scope:       req.Scope,
+		ExpiresAt:   req.ExpiresAt,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*models.APIKey
+		Token string `json:"token"`
+	}{key, token})
+}
+
+// RevokeAPIKey stops one of the logged-in user's API keys working
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Service.RevokeAPIKey(r.Context(), userID, r.PathValue("id")); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"ukoni/internal/models"
 	"ukoni/internal/services"
 )
 
@@ -14,6 +16,9 @@ type signupRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+
+	// InvitationToken, when set, accepts the invitation as part of signup.
+	InvitationToken string `json:"invitation_token,omitempty"`
 }
 
 type loginRequest struct {
@@ -24,43 +29,279 @@ type loginRequest struct {
 func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	var req signupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
-	user, err := h.Service.Signup(req.Name, req.Email, req.Password)
+	var (
+		user       *models.User
+		invitation *models.Invitation
+		err        error
+	)
+	if req.InvitationToken != "" {
+		user, invitation, err = h.Service.SignupWithInvitation(req.Name, req.Email, req.Password, req.InvitationToken)
+	} else {
+		user, err = h.Service.Signup(req.Name, req.Email, req.Password)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	// Generate token for the new user
-	token, err := h.Service.Login(req.Email, req.Password)
+	// Start a session for the new user
+	tokens, err := h.Service.StartSession(r.Context(), h.Service.SessionModel.DB, user.ID, clientInfo(r))
 	if err != nil {
-		// This should technically not happen if signup just succeeded, but handle it
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
+	response := map[string]interface{}{
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+		"session_id":    tokens.SessionID,
+	}
+	if invitation != nil {
+		response["invitation"] = invitation
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"user":  user,
-		"token": token,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	tokens, err := h.Service.Login(req.Email, req.Password, clientInfo(r))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+	if req.RefreshToken == "" {
+		WriteError(w, r, services.BadRequest("refresh_token required"))
+		return
+	}
+
+	tokens, err := h.Service.Refresh(req.RefreshToken, clientInfo(r))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// Logout ends the session making the request
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+	sessionID, _ := r.Context().Value("sessionID").(string)
+
+	if err := h.Service.Logout(userID, sessionID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll ends every session of the logged-in user
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Service.LogoutAll(userID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions lists the logged-in user's active sessions
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+	sessionID, _ := r.Context().Value("sessionID").(string)
+
+	sessions, err := h.Service.ListSessions(userID, sessionID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession ends one of the logged-in user's sessions, such as a lost
+// device
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	sessionID := r.PathValue("id")
+	if sessionID == "" {
+		WriteError(w, r, services.BadRequest("session id required"))
+		return
+	}
+
+	if err := h.Service.Logout(userID, sessionID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword emails a reset link if the address has an account. It
+// always answers the same way so it can't be used to probe for accounts.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+	if req.Email == "" {
+		WriteError(w, r, services.BadRequest("email required"))
+		return
+	}
+
+	if err := h.Service.ForgotPassword(req.Email); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password using the token from a reset link
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+	if req.Token == "" {
+		WriteError(w, r, services.BadRequest("token required"))
+		return
+	}
+
+	if err := h.Service.ResetPassword(req.Token, req.Password); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword replaces the logged-in user's password and returns tokens
+// for a fresh session, as every other session is ended
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
-	token, err := h.Service.Login(req.Email, req.Password)
+	tokens, err := h.Service.ChangePassword(userID, req.CurrentPassword, req.NewPassword, clientInfo(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		WriteError(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// VerifyEmail confirms the address a verification link was sent to
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+	if req.Token == "" {
+		WriteError(w, r, services.BadRequest("token required"))
+		return
+	}
+
+	if err := h.Service.VerifyEmail(req.Token); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification emails the logged-in user a new verification link
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Service.ResendVerification(userID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// clientInfo describes the device making a request, for session listings.
+func clientInfo(r *http.Request) services.ClientInfo {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	return services.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: ip,
+	}
 }
@@ -1,39 +1,26 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strconv"
 	"ukoni/internal/services"
 )
 
 type CanonicalProductHandler struct {
-	Service           *services.CanonicalProductService
-	MembershipService *services.MembershipService
+	Service *services.CanonicalProductService
 }
 
 func (h *CanonicalProductHandler) CreateCanonicalProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
-		return
-	}
-
-	// Check membership
-	if _, err := h.MembershipService.MembershipModel.GetMembership(inventoryID, userID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "forbidden", http.StatusForbidden)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
@@ -43,17 +30,13 @@ func (h *CanonicalProductHandler) CreateCanonicalProduct(w http.ResponseWriter,
 		CategoryID  string `json:"category_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
-	product, err := h.Service.CreateCanonicalProduct(r.Context(), inventoryID, req.Name, req.Description, req.CategoryID)
+	product, err := h.Service.CreateCanonicalProduct(r.Context(), userID, inventoryID, req.Name, req.Description, req.CategoryID)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidInput) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -64,30 +47,19 @@ func (h *CanonicalProductHandler) CreateCanonicalProduct(w http.ResponseWriter,
 func (h *CanonicalProductHandler) GetCanonicalProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
-	product, err := h.Service.GetCanonicalProduct(r.Context(), id)
+	product, err := h.Service.GetCanonicalProduct(r.Context(), userID, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if product == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
-		return
-	}
-
-	// Check membership
-	if _, err := h.MembershipService.MembershipModel.GetMembership(product.InventoryID, userID); err != nil {
-		// Return 404 to avoid leaking existence
-		http.Error(w, "product not found", http.StatusNotFound)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -97,28 +69,13 @@ func (h *CanonicalProductHandler) GetCanonicalProduct(w http.ResponseWriter, r *
 func (h *CanonicalProductHandler) UpdateCanonicalProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
-		return
-	}
-
-	// Check existence and permission first
-	existing, err := h.Service.GetCanonicalProduct(r.Context(), id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if existing == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
-		return
-	}
-	if _, err := h.MembershipService.MembershipModel.GetMembership(existing.InventoryID, userID); err != nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
@@ -128,25 +85,17 @@ func (h *CanonicalProductHandler) UpdateCanonicalProduct(w http.ResponseWriter,
 		CategoryID  string `json:"category_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
-	product, err := h.Service.UpdateCanonicalProduct(r.Context(), id, req.Name, req.Description, req.CategoryID)
+	product, err := h.Service.UpdateCanonicalProduct(r.Context(), userID, id, req.Name, req.Description, req.CategoryID)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidInput) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if errors.Is(err, services.ErrNotFound) {
-			http.Error(w, "product not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 	if product == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+		WriteError(w, r, services.NewError(http.StatusNotFound, "not_found", "product not found"))
 		return
 	}
 
@@ -156,42 +105,19 @@ func (h *CanonicalProductHandler) UpdateCanonicalProduct(w http.ResponseWriter,
 func (h *CanonicalProductHandler) DeleteCanonicalProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
-	// Check existence and permission first
-	existing, err := h.Service.GetCanonicalProduct(r.Context(), id)
+	err := h.Service.DeleteCanonicalProduct(r.Context(), userID, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if existing == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
-		return
-	}
-	if _, err := h.MembershipService.MembershipModel.GetMembership(existing.InventoryID, userID); err != nil {
-		http.Error(w, "product not found", http.StatusNotFound)
-		return
-	}
-
-	err = h.Service.DeleteCanonicalProduct(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, services.ErrInvalidInput) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if errors.Is(err, services.ErrNotFound) {
-			http.Error(w, "product not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -201,23 +127,13 @@ func (h *CanonicalProductHandler) DeleteCanonicalProduct(w http.ResponseWriter,
 func (h *CanonicalProductHandler) ListCanonicalProducts(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
-		return
-	}
-
-	// Check membership
-	if _, err := h.MembershipService.MembershipModel.GetMembership(inventoryID, userID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "forbidden", http.StatusForbidden)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
@@ -239,9 +155,9 @@ func (h *CanonicalProductHandler) ListCanonicalProducts(w http.ResponseWriter, r
 		}
 	}
 
-	products, err := h.Service.ListCanonicalProducts(r.Context(), inventoryID, limit, offset, search)
+	products, err := h.Service.ListCanonicalProducts(r.Context(), userID, inventoryID, limit, offset, search)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ukoni/internal/services"
+)
+
+type CategoryHandler struct {
+	Service *services.CategoryService
+}
+
+type categoryRequest struct {
+	Name             string  `json:"name"`
+	ParentCategoryID *string `json:"parent_category_id"`
+}
+
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	category, err := h.Service.CreateCategory(r.Context(), userID, r.PathValue("id"), req.Name, req.ParentCategoryID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+func (h *CategoryHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	categories, err := h.Service.ListCategories(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+func (h *CategoryHandler) GetTree(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	tree, err := h.Service.GetTree(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	category, err := h.Service.GetCategory(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	category, err := h.Service.UpdateCategory(r.Context(), userID, r.PathValue("id"), req.Name, req.ParentCategoryID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteCategory(r.Context(), userID, r.PathValue("id")); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -27,13 +27,13 @@ func (h *ConsumptionHandler) CreateConsumptionEvent(w http.ResponseWriter, r *ht
 	inventoryID := r.PathValue("id")
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	var req createConsumptionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
@@ -41,7 +41,7 @@ func (h *ConsumptionHandler) CreateConsumptionEvent(w http.ResponseWriter, r *ht
 	if req.ConsumedAt != "" {
 		parsed, err := time.Parse(time.RFC3339, req.ConsumedAt)
 		if err != nil {
-			http.Error(w, "invalid consumed_at format (expected RFC3339)", http.StatusBadRequest)
+			WriteError(w, r, services.BadRequest("invalid consumed_at format (expected RFC3339)"))
 			return
 		}
 		consumedAt = parsed
@@ -62,11 +62,7 @@ func (h *ConsumptionHandler) CreateConsumptionEvent(w http.ResponseWriter, r *ht
 
 	event, err := h.Service.CreateConsumption(r.Context(), input)
 	if err != nil {
-		if err.Error() == "user is not a member of this inventory" {
-			http.Error(w, err.Error(), http.StatusForbidden)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -79,7 +75,7 @@ func (h *ConsumptionHandler) ListConsumptionEvents(w http.ResponseWriter, r *htt
 	inventoryID := r.PathValue("id")
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
@@ -99,11 +95,7 @@ func (h *ConsumptionHandler) ListConsumptionEvents(w http.ResponseWriter, r *htt
 
 	events, err := h.Service.ListConsumptionEvents(r.Context(), inventoryID, userID, limit, offset)
 	if err != nil {
-		if err.Error() == "user is not a member of this inventory" {
-			http.Error(w, err.Error(), http.StatusForbidden)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -115,3 +107,19 @@ func (h *ConsumptionHandler) ListConsumptionEvents(w http.ResponseWriter, r *htt
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(events)
 }
+
+func (h *ConsumptionHandler) DeleteConsumptionEvent(w http.ResponseWriter, r *http.Request) {
+	eventID := r.PathValue("id")
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteConsumption(r.Context(), eventID, userID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
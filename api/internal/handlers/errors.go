@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"ukoni/internal/services"
+)
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+
+	// Errors repeats the field errors of a failed validation at the top
+	// level, where clients of the signup API already look for them.
+	Errors []services.FieldError `json:"errors,omitempty"`
+}
+
+type errorBody struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// WriteError responds with the JSON error envelope for err. Errors the
+// services don't recognise are logged with the request ID and reported as a
+// generic internal error, so database and other internal details never reach
+// the client.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr, known := services.ToError(err)
+	if !known {
+		logger, ok := r.Context().Value("logger").(*slog.Logger)
+		if !ok {
+			logger = slog.Default()
+		}
+		logger.Error("request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+
+	requestID, _ := r.Context().Value("requestID").(string)
+	fields, _ := apiErr.Details.([]services.FieldError)
+
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error: errorBody{
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			Details:   apiErr.Details,
+			RequestID: requestID,
+		},
+		Errors: fields,
+	})
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"ukoni/internal/models"
 	"ukoni/internal/services"
 )
 
@@ -13,7 +15,7 @@ type InventoryHandler struct {
 func (h *InventoryHandler) CreateInventory(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
@@ -21,13 +23,13 @@ func (h *InventoryHandler) CreateInventory(w http.ResponseWriter, r *http.Reques
 		Name string `json:"name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	inventory, err := h.Service.CreateInventory(r.Context(), userID, req.Name)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -36,18 +38,21 @@ func (h *InventoryHandler) CreateInventory(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *InventoryHandler) GetInventory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
-	inventory, err := h.Service.GetInventory(id)
+	inventory, err := h.Service.GetInventory(r.Context(), userID, id)
 	if err != nil {
-		// Differentiate between 404 and 500 if possible, but basic 500 for now or checks in service.
-		// For simplicity/robustness assuming if error is not nil it might be not found or db error.
-		// Ideally service returns named errors.
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -57,15 +62,155 @@ func (h *InventoryHandler) GetInventory(w http.ResponseWriter, r *http.Request)
 func (h *InventoryHandler) ListInventories(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
-	inventories, err := h.Service.ListInventories(userID)
+	inventories, err := h.Service.ListInventories(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(inventories)
 }
+
+// UpdateInventory renames an inventory
+func (h *InventoryHandler) UpdateInventory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name *string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	inventory, err := h.Service.UpdateInventory(r.Context(), userID, r.PathValue("id"), services.UpdateInventoryInput{Name: req.Name})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(inventory)
+}
+
+// ArchiveInventory makes an inventory read-only
+func (h *InventoryHandler) ArchiveInventory(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, h.Service.ArchiveInventory)
+}
+
+// UnarchiveInventory makes an archived inventory editable again
+func (h *InventoryHandler) UnarchiveInventory(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, h.Service.UnarchiveInventory)
+}
+
+func (h *InventoryHandler) setArchived(w http.ResponseWriter, r *http.Request, set func(context.Context, string, string) (*models.Inventory, error)) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	inventory, err := set(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(inventory)
+}
+
+// DeleteInventory deletes an inventory and everything in it
+func (h *InventoryHandler) DeleteInventory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteInventory(r.Context(), userID, r.PathValue("id")); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TransferOwnership offers the inventory to one of its admins
+func (h *InventoryHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	transfer, err := h.Service.TransferOwnership(r.Context(), userID, r.PathValue("id"), req.UserID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// GetPendingTransfer returns the inventory's open ownership transfer
+func (h *InventoryHandler) GetPendingTransfer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	transfer, err := h.Service.GetPendingTransfer(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// CancelTransfer withdraws the owner's open ownership transfer
+func (h *InventoryHandler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	h.resolveTransfer(w, r, h.Service.CancelTransfer)
+}
+
+// AcceptTransfer makes the logged-in user the owner
+func (h *InventoryHandler) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	h.resolveTransfer(w, r, h.Service.AcceptTransfer)
+}
+
+// DeclineTransfer turns down an ownership transfer
+func (h *InventoryHandler) DeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	h.resolveTransfer(w, r, h.Service.DeclineTransfer)
+}
+
+func (h *InventoryHandler) resolveTransfer(w http.ResponseWriter, r *http.Request, resolve func(context.Context, string, string) error) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := resolve(r.Context(), userID, r.PathValue("id")); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
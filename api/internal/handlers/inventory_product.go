@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"ukoni/internal/models"
+	"ukoni/internal/services"
+)
+
+type InventoryProductHandler struct {
+	Service *services.InventoryProductService
+}
+
+type adjustStockRequest struct {
+	Type     string  `json:"type"`
+	Quantity float64 `json:"quantity"`
+	Note     *string `json:"note"`
+}
+
+func (h *InventoryProductHandler) ListStock(w http.ResponseWriter, r *http.Request) {
+	inventoryID := r.PathValue("id")
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	limit, offset := 20, 0
+	query := r.URL.Query()
+	if l := query.Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := query.Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	filter := models.StockFilter{
+		CanonicalProductID: query.Get("canonical_product_id"),
+		CategoryID:         query.Get("category_id"),
+	}
+
+	items, err := h.Service.ListStock(r.Context(), inventoryID, userID, filter, limit, offset)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func (h *InventoryProductHandler) GetStock(w http.ResponseWriter, r *http.Request) {
+	inventoryID := r.PathValue("id")
+	variantID := r.PathValue("variantId")
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	item, err := h.Service.GetStock(r.Context(), inventoryID, variantID, userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+func (h *InventoryProductHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	inventoryID := r.PathValue("id")
+	variantID := r.PathValue("variantId")
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req adjustStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	adjustment, err := h.Service.AdjustStock(r.Context(), services.AdjustStockInput{
+		InventoryID:      inventoryID,
+		ProductVariantID: variantID,
+		UserID:           userID,
+		Type:             req.Type,
+		Quantity:         req.Quantity,
+		Note:             req.Note,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(adjustment)
+}
+
+func (h *InventoryProductHandler) ListAdjustments(w http.ResponseWriter, r *http.Request) {
+	inventoryID := r.PathValue("id")
+	variantID := r.PathValue("variantId")
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	limit, offset := 20, 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+
+	adjustments, err := h.Service.ListAdjustments(r.Context(), inventoryID, variantID, userID, limit, offset)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	if adjustments == nil {
+		adjustments = []*models.InventoryAdjustment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adjustments)
+}
+
+func (h *InventoryProductHandler) GetStockTotal(w http.ResponseWriter, r *http.Request) {
+	canonicalProductID := r.PathValue("id")
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	total, err := h.Service.GetStockTotal(r.Context(), userID, canonicalProductID, r.URL.Query().Get("unit"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(total)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"ukoni/internal/models"
 	"ukoni/internal/services"
 )
 
@@ -14,13 +15,13 @@ type MembershipHandler struct {
 func (h *MembershipHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
@@ -29,7 +30,7 @@ func (h *MembershipHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
 		Role  string `json:"role"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
@@ -38,13 +39,9 @@ func (h *MembershipHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
 		req.Role = "viewer"
 	}
 
-	invitation, err := h.Service.InviteUser(userID, inventoryID, req.Email, req.Role)
+	invitation, err := h.Service.InviteUser(r.Context(), userID, inventoryID, req.Email, req.Role)
 	if err != nil {
-		if err == services.ErrUnauthorized {
-			http.Error(w, err.Error(), http.StatusForbidden)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		WriteError(w, r, err)
 		return
 	}
 
@@ -52,64 +49,99 @@ func (h *MembershipHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(invitation)
 }
 
-// AcceptInvite handles accepting an invitation
+// AcceptInvite handles accepting an invitation by ID
 func (h *MembershipHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		// Acceptance generally requires the user to be logged in effectively linking the invite to their account
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		// Acceptance requires the user to be logged in so the invite can be checked against their email
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inviteID := r.PathValue("id")
 	if inviteID == "" {
-		http.Error(w, "invitation id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invitation id required"))
 		return
 	}
 
-	var req struct {
-		Token string `json:"token"`
+	token, ok := decodeInvitationToken(w, r)
+	if !ok {
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+
+	invitation, err := h.Service.AcceptInvitation(userID, inviteID, token)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	if req.Token == "" {
-		http.Error(w, "token required", http.StatusBadRequest)
+	writeAcceptedInvitation(w, invitation)
+}
+
+// AcceptInviteByToken handles accepting an invitation from a link that
+// carries only its token
+func (h *MembershipHandler) AcceptInviteByToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	token, ok := decodeInvitationToken(w, r)
+	if !ok {
 		return
 	}
 
-	if err := h.Service.AcceptInvitation(userID, inviteID, req.Token); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	invitation, err := h.Service.AcceptInvitationByToken(userID, token)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"accepted"}`))
+	writeAcceptedInvitation(w, invitation)
+}
+
+func decodeInvitationToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return "", false
+	}
+
+	if req.Token == "" {
+		WriteError(w, r, services.BadRequest("token required"))
+		return "", false
+	}
+	return req.Token, true
+}
+
+func writeAcceptedInvitation(w http.ResponseWriter, invitation *models.Invitation) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":       invitation.Status,
+		"inventory_id": invitation.InventoryID,
+		"role":         invitation.Role,
+	})
 }
 
 // ListMembers handles listing all members of an inventory
 func (h *MembershipHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
-	members, err := h.Service.ListMembers(userID, inventoryID)
+	members, err := h.Service.ListMembers(r.Context(), userID, inventoryID)
 	if err != nil {
-		if err == services.ErrUnauthorized {
-			http.Error(w, err.Error(), http.StatusForbidden)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		WriteError(w, r, err)
 		return
 	}
 
@@ -120,25 +152,161 @@ func (h *MembershipHandler) ListMembers(w http.ResponseWriter, r *http.Request)
 func (h *MembershipHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	inventoryID := r.PathValue("id")
+	targetUserID := r.PathValue("userId")
+	if inventoryID == "" || targetUserID == "" {
+		WriteError(w, r, services.BadRequest("inventory id and user id required"))
+		return
+	}
+
+	if err := h.Service.RemoveMember(r.Context(), userID, inventoryID, targetUserID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateMember handles changing a member's role
+func (h *MembershipHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	targetUserID := r.PathValue("userId")
 	if inventoryID == "" || targetUserID == "" {
-		http.Error(w, "inventory id and user id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id and user id required"))
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	member, err := h.Service.ChangeMemberRole(r.Context(), userID, inventoryID, targetUserID, req.Role)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(member)
+}
+
+// LeaveInventory handles a member leaving an inventory
+func (h *MembershipHandler) LeaveInventory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	inventoryID := r.PathValue("id")
+	if inventoryID == "" {
+		WriteError(w, r, services.BadRequest("inventory id required"))
+		return
+	}
+
+	if err := h.Service.LeaveInventory(r.Context(), userID, inventoryID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListInvitations handles listing the invitations of an inventory
+func (h *MembershipHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	inventoryID := r.PathValue("id")
+	if inventoryID == "" {
+		WriteError(w, r, services.BadRequest("inventory id required"))
+		return
+	}
+
+	invitations, err := h.Service.ListInvitations(r.Context(), userID, inventoryID, r.URL.Query().Get("status"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// RevokeInvitation handles withdrawing a pending invitation
+func (h *MembershipHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	inviteID := r.PathValue("id")
+	if inviteID == "" {
+		WriteError(w, r, services.BadRequest("invitation id required"))
 		return
 	}
 
-	if err := h.Service.RemoveMember(userID, inventoryID, targetUserID); err != nil {
-		if err == services.ErrUnauthorized {
-			http.Error(w, err.Error(), http.StatusForbidden)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+	if err := h.Service.RevokeInvitation(r.Context(), userID, inviteID); err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// ResendInvitation handles reissuing an invitation with a new token
+func (h *MembershipHandler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	inviteID := r.PathValue("id")
+	if inviteID == "" {
+		WriteError(w, r, services.BadRequest("invitation id required"))
+		return
+	}
+
+	invitation, err := h.Service.ResendInvitation(r.Context(), userID, inviteID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// ListMyInvitations handles listing the pending invitations sent to the
+// logged-in user's email
+func (h *MembershipHandler) ListMyInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	invitations, err := h.Service.ListMyInvitations(userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitations)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"ukoni/internal/services"
+)
+
+type OIDCHandler struct {
+	Service *services.OIDCService
+}
+
+// ListProviders lists the external providers users can log in with
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"providers": h.Service.ListProviders(),
+	})
+}
+
+// StartLogin returns the provider page the app should send the user to
+func (h *OIDCHandler) StartLogin(w http.ResponseWriter, r *http.Request) {
+	authorizationURL, err := h.Service.StartLogin(r.Context(), r.PathValue("provider"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorization_url": authorizationURL,
+	})
+}
+
+// FinishLogin logs in with the code and state the provider redirected back
+// with, creating the account on first use
+func (h *OIDCHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	login, err := h.Service.FinishLogin(r.Context(), r.PathValue("provider"), req.Code, req.State, clientInfo(r))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	if login.Created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":          login.User,
+		"token":         login.Tokens.AccessToken,
+		"refresh_token": login.Tokens.RefreshToken,
+		"expires_at":    login.Tokens.ExpiresAt,
+		"session_id":    login.Tokens.SessionID,
+	})
+}
@@ -13,7 +13,7 @@ type OutletHandler struct {
 func (h *OutletHandler) CreateOutlet(w http.ResponseWriter, r *http.Request) {
 	sellerID := r.PathValue("id")
 	if sellerID == "" {
-		http.Error(w, "seller id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("seller id required"))
 		return
 	}
 
@@ -24,13 +24,13 @@ func (h *OutletHandler) CreateOutlet(w http.ResponseWriter, r *http.Request) {
 		WebsiteURL string `json:"website_url"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	outlet, err := h.Service.CreateOutlet(sellerID, req.Name, req.Channel, req.Address, req.WebsiteURL)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -41,13 +41,13 @@ func (h *OutletHandler) CreateOutlet(w http.ResponseWriter, r *http.Request) {
 func (h *OutletHandler) GetOutlet(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "outlet id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("outlet id required"))
 		return
 	}
 
 	outlet, err := h.Service.GetOutlet(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -57,13 +57,13 @@ func (h *OutletHandler) GetOutlet(w http.ResponseWriter, r *http.Request) {
 func (h *OutletHandler) ListOutlets(w http.ResponseWriter, r *http.Request) {
 	sellerID := r.PathValue("id")
 	if sellerID == "" {
-		http.Error(w, "seller id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("seller id required"))
 		return
 	}
 
 	outlets, err := h.Service.ListOutlets(sellerID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -73,7 +73,7 @@ func (h *OutletHandler) ListOutlets(w http.ResponseWriter, r *http.Request) {
 func (h *OutletHandler) UpdateOutlet(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "outlet id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("outlet id required"))
 		return
 	}
 
@@ -84,13 +84,13 @@ func (h *OutletHandler) UpdateOutlet(w http.ResponseWriter, r *http.Request) {
 		WebsiteURL string `json:"website_url"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	outlet, err := h.Service.UpdateOutlet(id, req.Name, req.Channel, req.Address, req.WebsiteURL)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -100,12 +100,12 @@ func (h *OutletHandler) UpdateOutlet(w http.ResponseWriter, r *http.Request) {
 func (h *OutletHandler) DeleteOutlet(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "outlet id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("outlet id required"))
 		return
 	}
 
 	if err := h.Service.DeleteOutlet(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -1,60 +1,44 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strconv"
 	"ukoni/internal/services"
 )
 
 type ProductHandler struct {
-	Service           *services.ProductService
-	MembershipService *services.MembershipService
+	Service *services.ProductService
 }
 
 func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
-		return
-	}
-
-	// Check membership
-	if _, err := h.MembershipService.MembershipModel.GetMembership(inventoryID, userID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "forbidden", http.StatusForbidden)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
 	var req struct {
-		Brand       string `json:"brand"`
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		CategoryID  string `json:"category_id"`
+		CanonicalProductID string `json:"canonical_product_id"`
+		Brand              string `json:"brand"`
+		Name               string `json:"name"`
+		Description        string `json:"description"`
+		CategoryID         string `json:"category_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
-	product, err := h.Service.CreateProduct(r.Context(), inventoryID, req.Brand, req.Name, req.Description, req.CategoryID)
+	product, err := h.Service.CreateProduct(r.Context(), userID, inventoryID, req.CanonicalProductID, req.Brand, req.Name, req.Description, req.CategoryID)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidInput) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -65,29 +49,19 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
-	product, err := h.Service.GetProduct(r.Context(), id)
+	product, err := h.Service.GetProduct(r.Context(), userID, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if product == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
-		return
-	}
-
-	// Check membership
-	if _, err := h.MembershipService.MembershipModel.GetMembership(product.InventoryID, userID); err != nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -97,57 +71,35 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
-		return
-	}
-
-	// Check existence and permission first
-	existing, err := h.Service.GetProduct(r.Context(), id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if existing == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
-		return
-	}
-	if _, err := h.MembershipService.MembershipModel.GetMembership(existing.InventoryID, userID); err != nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
 	var req struct {
-		Brand       string `json:"brand"`
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		CategoryID  string `json:"category_id"`
+		CanonicalProductID *string `json:"canonical_product_id"`
+		Brand              string  `json:"brand"`
+		Name               string  `json:"name"`
+		Description        string  `json:"description"`
+		CategoryID         string  `json:"category_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
-	product, err := h.Service.UpdateProduct(r.Context(), id, req.Brand, req.Name, req.Description, req.CategoryID)
+	product, err := h.Service.UpdateProduct(r.Context(), userID, id, req.CanonicalProductID, req.Brand, req.Name, req.Description, req.CategoryID)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidInput) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if errors.Is(err, services.ErrNotFound) {
-			http.Error(w, "product not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 	if product == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+		WriteError(w, r, services.NewError(http.StatusNotFound, "not_found", "product not found"))
 		return
 	}
 
@@ -157,42 +109,19 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
-		return
-	}
-
-	// Check existence and permission first
-	existing, err := h.Service.GetProduct(r.Context(), id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if existing == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
-		return
-	}
-	if _, err := h.MembershipService.MembershipModel.GetMembership(existing.InventoryID, userID); err != nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
-	err = h.Service.DeleteProduct(r.Context(), id)
+	err := h.Service.DeleteProduct(r.Context(), userID, id)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidInput) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if errors.Is(err, services.ErrNotFound) {
-			http.Error(w, "product not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -202,23 +131,13 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
-		return
-	}
-
-	// Check membership
-	if _, err := h.MembershipService.MembershipModel.GetMembership(inventoryID, userID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "forbidden", http.StatusForbidden)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
@@ -226,6 +145,7 @@ func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	limitStr := query.Get("limit")
 	offsetStr := query.Get("offset")
 	search := query.Get("search")
+	categoryID := query.Get("category_id")
 
 	limit := 10
 	offset := 0
@@ -240,9 +160,9 @@ func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	products, err := h.Service.ListProducts(r.Context(), inventoryID, limit, offset, search)
+	products, err := h.Service.ListProducts(r.Context(), userID, inventoryID, limit, offset, search, categoryID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -252,89 +172,163 @@ func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) CreateVariant(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	productID := r.PathValue("id")
 	if productID == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
-	// Check existence and permission first
-	product, err := h.Service.GetProduct(r.Context(), productID)
+	input, ok := decodeVariantInput(w, r)
+	if !ok {
+		return
+	}
+
+	variant, err := h.Service.CreateVariant(r.Context(), userID, productID, input)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
-	if product == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(variant)
+}
+
+func (h *ProductHandler) ListVariants(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
-	if _, err := h.MembershipService.MembershipModel.GetMembership(product.InventoryID, userID); err != nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+
+	productID := r.PathValue("id")
+	if productID == "" {
+		WriteError(w, r, services.BadRequest("product id required"))
 		return
 	}
 
-	var req struct {
-		VariantName string   `json:"variant_name"`
-		SKU         string   `json:"sku"`
-		Unit        string   `json:"unit"`
-		Size        *float64 `json:"size"`
+	variants, err := h.Service.ListVariants(r.Context(), userID, productID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+
+	json.NewEncoder(w).Encode(variants)
+}
+
+func (h *ProductHandler) GetVariant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
-	variant, err := h.Service.CreateVariant(r.Context(), productID, req.VariantName, req.SKU, req.Unit, req.Size)
+	id := r.PathValue("id")
+	if id == "" {
+		WriteError(w, r, services.BadRequest("variant id required"))
+		return
+	}
+
+	variant, err := h.Service.GetVariant(r.Context(), userID, id)
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidInput) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(variant)
 }
 
-func (h *ProductHandler) ListVariants(w http.ResponseWriter, r *http.Request) {
+func (h *ProductHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
-	productID := r.PathValue("id")
-	if productID == "" {
-		http.Error(w, "product id required", http.StatusBadRequest)
+	id := r.PathValue("id")
+	if id == "" {
+		WriteError(w, r, services.BadRequest("variant id required"))
+		return
+	}
+
+	input, ok := decodeVariantInput(w, r)
+	if !ok {
 		return
 	}
 
-	// Check existence and permission first
-	product, err := h.Service.GetProduct(r.Context(), productID)
+	variant, err := h.Service.UpdateVariant(r.Context(), userID, id, input)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
-	if product == nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+
+	json.NewEncoder(w).Encode(variant)
+}
+
+func (h *ProductHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		WriteError(w, r, services.BadRequest("variant id required"))
 		return
 	}
-	if _, err := h.MembershipService.MembershipModel.GetMembership(product.InventoryID, userID); err != nil {
-		http.Error(w, "product not found", http.StatusNotFound)
+
+	if err := h.Service.DeleteVariant(r.Context(), userID, id); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LookupVariants finds an inventory's variants by SKU or barcode.
+func (h *ProductHandler) LookupVariants(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
-	variants, err := h.Service.ListVariants(r.Context(), productID)
+	inventoryID := r.PathValue("id")
+	if inventoryID == "" {
+		WriteError(w, r, services.BadRequest("inventory id required"))
+		return
+	}
+
+	variants, err := h.Service.LookupVariants(r.Context(), userID, inventoryID, r.URL.Query().Get("code"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(variants)
 }
+
+func decodeVariantInput(w http.ResponseWriter, r *http.Request) (services.VariantInput, bool) {
+	var req struct {
+		VariantName string   `json:"variant_name"`
+		SKU         string   `json:"sku"`
+		GTIN        string   `json:"gtin"`
+		Unit        string   `json:"unit"`
+		Size        *float64 `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return services.VariantInput{}, false
+	}
+	return services.VariantInput{
+		VariantName: req.VariantName,
+		SKU:         req.SKU,
+		GTIN:        req.GTIN,
+		Unit:        req.Unit,
+		Size:        req.Size,
+	}, true
+}
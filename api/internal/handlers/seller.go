@@ -16,13 +16,13 @@ func (h *SellerHandler) CreateSeller(w http.ResponseWriter, r *http.Request) {
 		Type string `json:"type"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	seller, err := h.Service.CreateSeller(req.Name, req.Type)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -33,13 +33,13 @@ func (h *SellerHandler) CreateSeller(w http.ResponseWriter, r *http.Request) {
 func (h *SellerHandler) GetSeller(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "seller id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("seller id required"))
 		return
 	}
 
 	seller, err := h.Service.GetSeller(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -49,7 +49,7 @@ func (h *SellerHandler) GetSeller(w http.ResponseWriter, r *http.Request) {
 func (h *SellerHandler) ListSellers(w http.ResponseWriter, r *http.Request) {
 	sellers, err := h.Service.ListSellers()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -59,7 +59,7 @@ func (h *SellerHandler) ListSellers(w http.ResponseWriter, r *http.Request) {
 func (h *SellerHandler) UpdateSeller(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "seller id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("seller id required"))
 		return
 	}
 
@@ -68,13 +68,13 @@ func (h *SellerHandler) UpdateSeller(w http.ResponseWriter, r *http.Request) {
 		Type string `json:"type"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	seller, err := h.Service.UpdateSeller(id, req.Name, req.Type)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -84,12 +84,12 @@ func (h *SellerHandler) UpdateSeller(w http.ResponseWriter, r *http.Request) {
 func (h *SellerHandler) DeleteSeller(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "seller id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("seller id required"))
 		return
 	}
 
 	if err := h.Service.DeleteSeller(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -14,13 +14,13 @@ type ShoppingListHandler struct {
 func (h *ShoppingListHandler) CreateList(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
@@ -28,17 +28,13 @@ func (h *ShoppingListHandler) CreateList(w http.ResponseWriter, r *http.Request)
 		Name string `json:"name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	list, err := h.Service.CreateList(r.Context(), userID, inventoryID, req.Name)
 	if err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -49,23 +45,19 @@ func (h *ShoppingListHandler) CreateList(w http.ResponseWriter, r *http.Request)
 func (h *ShoppingListHandler) ListLists(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
 	lists, err := h.Service.ListLists(r.Context(), userID, inventoryID)
 	if err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -75,23 +67,19 @@ func (h *ShoppingListHandler) ListLists(w http.ResponseWriter, r *http.Request)
 func (h *ShoppingListHandler) GetList(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	listID := r.PathValue("id")
 	if listID == "" {
-		http.Error(w, "list id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("list id required"))
 		return
 	}
 
 	list, err := h.Service.GetList(r.Context(), userID, listID)
 	if err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -105,13 +93,13 @@ func (h *ShoppingListHandler) GetList(w http.ResponseWriter, r *http.Request) {
 func (h *ShoppingListHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	listID := r.PathValue("id")
 	if listID == "" {
-		http.Error(w, "list id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("list id required"))
 		return
 	}
 
@@ -119,17 +107,13 @@ func (h *ShoppingListHandler) UpdateList(w http.ResponseWriter, r *http.Request)
 		Name string `json:"name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	list, err := h.Service.UpdateList(r.Context(), userID, listID, req.Name)
 	if err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -139,22 +123,18 @@ func (h *ShoppingListHandler) UpdateList(w http.ResponseWriter, r *http.Request)
 func (h *ShoppingListHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	listID := r.PathValue("id")
 	if listID == "" {
-		http.Error(w, "list id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("list id required"))
 		return
 	}
 
 	if err := h.Service.DeleteList(r.Context(), userID, listID); err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -164,23 +144,19 @@ func (h *ShoppingListHandler) DeleteList(w http.ResponseWriter, r *http.Request)
 func (h *ShoppingListHandler) ListItems(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	listID := r.PathValue("id")
 	if listID == "" {
-		http.Error(w, "list id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("list id required"))
 		return
 	}
 
 	items, err := h.Service.ListItems(r.Context(), userID, listID)
 	if err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -190,41 +166,41 @@ func (h *ShoppingListHandler) ListItems(w http.ResponseWriter, r *http.Request)
 func (h *ShoppingListHandler) AddItem(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	listID := r.PathValue("id")
 	if listID == "" {
-		http.Error(w, "list id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("list id required"))
 		return
 	}
 
 	var req struct {
-		TargetType        string  `json:"target_type"`
-		TargetID          string  `json:"target_id"`
-		PreferredOutletID *string `json:"preferred_outlet_id"`
-		Notes             *string `json:"notes"`
+		TargetType        string   `json:"target_type"`
+		TargetID          string   `json:"target_id"`
+		Quantity          *float64 `json:"quantity"`
+		Unit              *string  `json:"unit"`
+		PreferredOutletID *string  `json:"preferred_outlet_id"`
+		Notes             *string  `json:"notes"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
 	item := &models.ShoppingListItem{
 		TargetType:        req.TargetType,
 		TargetID:          req.TargetID,
+		Quantity:          req.Quantity,
+		Unit:              req.Unit,
 		PreferredOutletID: req.PreferredOutletID,
 		Notes:             req.Notes,
 	}
 
 	createdItem, err := h.Service.AddItem(r.Context(), userID, listID, item)
 	if err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -235,32 +211,30 @@ func (h *ShoppingListHandler) AddItem(w http.ResponseWriter, r *http.Request) {
 func (h *ShoppingListHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	itemID := r.PathValue("itemId")
 	if itemID == "" {
-		http.Error(w, "item id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("item id required"))
 		return
 	}
 
 	var req struct {
-		Notes             *string `json:"notes"`
-		PreferredOutletID *string `json:"preferred_outlet_id"`
+		Notes             *string  `json:"notes"`
+		PreferredOutletID *string  `json:"preferred_outlet_id"`
+		Quantity          *float64 `json:"quantity"`
+		Unit              *string  `json:"unit"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
-	updatedItem, err := h.Service.UpdateItem(r.Context(), userID, itemID, req.Notes, req.PreferredOutletID)
+	updatedItem, err := h.Service.UpdateItem(r.Context(), userID, itemID, req.Notes, req.PreferredOutletID, req.Quantity, req.Unit)
 	if err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -270,22 +244,18 @@ func (h *ShoppingListHandler) UpdateItem(w http.ResponseWriter, r *http.Request)
 func (h *ShoppingListHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	itemID := r.PathValue("itemId")
 	if itemID == "" {
-		http.Error(w, "item id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("item id required"))
 		return
 	}
 
 	if err := h.Service.DeleteItem(r.Context(), userID, itemID); err != nil {
-		if err.Error() == "unauthorized" {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -29,19 +29,19 @@ type CreateTransactionItemRequest struct {
 func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
 	var req CreateTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("invalid request body"))
 		return
 	}
 
@@ -52,18 +52,11 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 		TransactionDate: req.TransactionDate,
 	}
 
-	for _, itemReq := range req.Items {
-		input.Items = append(input.Items, services.CreateTransactionItemInput{
-			ProductVariantID:   itemReq.ProductVariantID,
-			Quantity:           itemReq.Quantity,
-			PricePerUnit:       itemReq.PricePerUnit,
-			ShoppingListItemID: itemReq.ShoppingListItemID,
-		})
-	}
+	input.Items = transactionItemInputs(req.Items)
 
 	transaction, err := h.Service.CreateTransaction(r.Context(), input)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -74,13 +67,13 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 func (h *TransactionHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	inventoryID := r.PathValue("id")
 	if inventoryID == "" {
-		http.Error(w, "inventory id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("inventory id required"))
 		return
 	}
 
@@ -100,7 +93,7 @@ func (h *TransactionHandler) ListTransactions(w http.ResponseWriter, r *http.Req
 
 	transactions, err := h.Service.ListTransactions(r.Context(), inventoryID, userID, limit, offset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
@@ -114,25 +107,89 @@ func (h *TransactionHandler) ListTransactions(w http.ResponseWriter, r *http.Req
 func (h *TransactionHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		WriteError(w, r, services.ErrUnauthorized)
 		return
 	}
 
 	transactionID := r.PathValue("id")
 	if transactionID == "" {
-		http.Error(w, "transaction id required", http.StatusBadRequest)
+		WriteError(w, r, services.BadRequest("transaction id required"))
 		return
 	}
 
 	transaction, err := h.Service.GetTransaction(r.Context(), transactionID, userID)
 	if err != nil {
-		if err == services.ErrTransactionNotFound {
-			http.Error(w, "transaction not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(transaction)
+}
+
+func (h *TransactionHandler) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	transactionID := r.PathValue("id")
+	if transactionID == "" {
+		WriteError(w, r, services.BadRequest("transaction id required"))
+		return
+	}
+
+	var req CreateTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	transaction, err := h.Service.UpdateTransaction(r.Context(), services.UpdateTransactionInput{
+		TransactionID:   transactionID,
+		UserID:          userID,
+		OutletID:        req.OutletID,
+		TransactionDate: req.TransactionDate,
+		Items:           transactionItemInputs(req.Items),
+	})
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(transaction)
 }
+
+func (h *TransactionHandler) DeleteTransaction(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	transactionID := r.PathValue("id")
+	if transactionID == "" {
+		WriteError(w, r, services.BadRequest("transaction id required"))
+		return
+	}
+
+	if err := h.Service.DeleteTransaction(r.Context(), transactionID, userID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func transactionItemInputs(items []CreateTransactionItemRequest) []services.CreateTransactionItemInput {
+	inputs := make([]services.CreateTransactionItemInput, 0, len(items))
+	for _, itemReq := range items {
+		inputs = append(inputs, services.CreateTransactionItemInput{
+			ProductVariantID:   itemReq.ProductVariantID,
+			Quantity:           itemReq.Quantity,
+			PricePerUnit:       itemReq.PricePerUnit,
+			ShoppingListItemID: itemReq.ShoppingListItemID,
+		})
+	}
+	return inputs
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"ukoni/internal/services"
+)
+
+type UnitHandler struct {
+	Service *services.UnitService
+}
+
+type createUnitConversionRequest struct {
+	FromUnit   string   `json:"from_unit"`
+	ToUnit     string   `json:"to_unit"`
+	Factor     float64  `json:"factor"`
+	Confidence *float64 `json:"confidence"`
+	Note       *string  `json:"note"`
+}
+
+func (h *UnitHandler) ListUnits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Service.ListUnits())
+}
+
+func (h *UnitHandler) Convert(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	quantity, err := strconv.ParseFloat(query.Get("quantity"), 64)
+	if err != nil {
+		WriteError(w, r, services.BadRequest("quantity must be a number"))
+		return
+	}
+
+	conversion, err := h.Service.Convert(r.Context(), userID, quantity, query.Get("from"), query.Get("to"), query.Get("canonical_product_id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversion)
+}
+
+func (h *UnitHandler) ListConversions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	conversions, err := h.Service.ListConversions(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversions)
+}
+
+func (h *UnitHandler) CreateConversion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	var req createUnitConversionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, services.BadRequest("invalid request body"))
+		return
+	}
+
+	conversion, err := h.Service.CreateConversion(r.Context(), services.CreateUnitConversionInput{
+		CanonicalProductID: r.PathValue("id"),
+		UserID:             userID,
+		FromUnit:           req.FromUnit,
+		ToUnit:             req.ToUnit,
+		Factor:             req.Factor,
+		Confidence:         req.Confidence,
+		Note:               req.Note,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(conversion)
+}
+
+func (h *UnitHandler) DeleteConversion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, r, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Service.DeleteConversion(r.Context(), userID, r.PathValue("id")); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -5,34 +5,44 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 	"ukoni/internal/config"
+	"ukoni/internal/handlers"
+	"ukoni/internal/models"
+	"ukoni/internal/services"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type AuthMiddleware struct {
-	Config *config.Config
+	Config        *config.Config
+	SessionModel  *models.SessionModel
+	APIKeyService *services.APIKeyService
 }
 
-func NewAuthMiddleware(cfg *config.Config) *AuthMiddleware {
-	return &AuthMiddleware{Config: cfg}
+func NewAuthMiddleware(cfg *config.Config, sessionModel *models.SessionModel, apiKeyService *services.APIKeyService) *AuthMiddleware {
+	return &AuthMiddleware{Config: cfg, SessionModel: sessionModel, APIKeyService: apiKeyService}
 }
 
 func (m *AuthMiddleware) Auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "authorization header required", http.StatusUnauthorized)
+			handlers.WriteError(w, r, services.NewError(http.StatusUnauthorized, "unauthorized", "authorization header required"))
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "invalid authorization header format", http.StatusUnauthorized)
+			handlers.WriteError(w, r, services.NewError(http.StatusUnauthorized, "unauthorized", "invalid authorization header format"))
 			return
 		}
 
 		tokenString := parts[1]
+		if strings.HasPrefix(tokenString, services.APIKeyPrefix) {
+			m.apiKeyAuth(w, r, tokenString, next)
+			return
+		}
 		// Config is now injected via the struct
 
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -43,23 +53,86 @@ func (m *AuthMiddleware) Auth(next http.HandlerFunc) http.HandlerFunc {
 		})
 
 		if err != nil || !token.Valid {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			handlers.WriteError(w, r, services.NewError(http.StatusUnauthorized, "unauthorized", "invalid token"))
 			return
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			http.Error(w, "invalid token claims", http.StatusUnauthorized)
+			handlers.WriteError(w, r, services.NewError(http.StatusUnauthorized, "unauthorized", "invalid token claims"))
 			return
 		}
 
 		userID, ok := claims["sub"].(string)
 		if !ok {
-			http.Error(w, "invalid user id in token", http.StatusUnauthorized)
+			handlers.WriteError(w, r, services.NewError(http.StatusUnauthorized, "unauthorized", "invalid user id in token"))
+			return
+		}
+
+		// Access tokens are tied to a session so that logging out revokes
+		// them before they expire.
+		sessionID, ok := claims["sid"].(string)
+		if !ok {
+			handlers.WriteError(w, r, services.NewError(http.StatusUnauthorized, "unauthorized", "invalid session in token"))
+			return
+		}
+
+		active, err := m.SessionModel.IsActive(r.Context(), userID, sessionID, time.Now())
+		if err != nil {
+			handlers.WriteError(w, r, err)
+			return
+		}
+		if !active {
+			handlers.WriteError(w, r, services.NewError(http.StatusUnauthorized, "unauthorized", "session has ended"))
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), "userID", userID)
+		ctx = context.WithValue(ctx, "sessionID", sessionID)
 		next(w, r.WithContext(ctx))
 	}
 }
+
+// apiKeyAuth authenticates a request made with an API key. Keys limited to
+// reading can only make requests that don't change anything.
+func (m *AuthMiddleware) apiKeyAuth(w http.ResponseWriter, r *http.Request, token string, next http.HandlerFunc) {
+	key, err := m.APIKeyService.Authenticate(r.Context(), token)
+	if err != nil {
+		handlers.WriteError(w, r, err)
+		return
+	}
+
+	if key.Scope == services.APIKeyScopeRead && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		handlers.WriteError(w, r, services.NewError(http.StatusForbidden, "insufficient_scope", "this api key can only read"))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), "userID", key.UserID)
+	ctx = context.WithValue(ctx, "apiKey", key)
+	next(w, r.WithContext(ctx))
+}
+
+// RequireSession authenticates like Auth but refuses API keys, for managing
+// the account itself: its password, sessions and keys.
+func (m *AuthMiddleware) RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return m.Auth(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("apiKey").(*models.APIKey); ok {
+			handlers.WriteError(w, r, services.NewError(http.StatusForbidden, "session_required", "api keys cannot be used for this request"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RequireUnrestricted authenticates like Auth but refuses API keys restricted
+// to one inventory, for changes to data shared by every inventory such as
+// sellers and their outlets.
+func (m *AuthMiddleware) RequireUnrestricted(next http.HandlerFunc) http.HandlerFunc {
+	return m.Auth(func(w http.ResponseWriter, r *http.Request) {
+		if key, ok := r.Context().Value("apiKey").(*models.APIKey); ok && key.InventoryID != nil {
+			handlers.WriteError(w, r, services.NewError(http.StatusForbidden, "inventory_restricted", "this api key is restricted to one inventory"))
+			return
+		}
+		next(w, r)
+	})
+}
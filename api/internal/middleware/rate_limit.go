@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+	"ukoni/internal/config"
+	"ukoni/internal/handlers"
+	"ukoni/internal/services"
+)
+
+// RateLimitStore keeps the token buckets RateLimit draws from. The in-memory
+// store suits a single instance; replicas that should share one limit need a
+// store backed by something they all reach, such as Postgres.
+type RateLimitStore interface {
+	// Take spends a token from the bucket for key. The bucket holds up to
+	// limit.Requests tokens and refills at limit.Requests every limit.Per.
+	// When it is empty Take reports how long until the next token.
+	Take(ctx context.Context, key string, limit config.RateLimit, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+
+	// Refund puts back a token Take spent, for a request that another limit
+	// then turned away.
+	Refund(ctx context.Context, key string, limit config.RateLimit) error
+}
+
+// RateLimitKey picks what a request is counted against, such as the client's
+// IP address. An empty key leaves the request out of that limit.
+type RateLimitKey func(r *http.Request) string
+
+// ByIP counts requests against the address they arrived from. Behind a
+// reverse proxy that is the proxy's address, and every client shares one
+// bucket; use ByClientIP with the proxy's addresses there.
+func ByIP(r *http.Request) string {
+	return "ip:" + remoteIP(r)
+}
+
+// ByClientIP counts requests against the client's IP address. A request from
+// one of trustedProxies is counted against the address the proxy forwarded
+// it for: the last in X-Forwarded-For that isn't a trusted proxy itself.
+// Addresses further left are the client's to choose, so they are ignored.
+func ByClientIP(trustedProxies []netip.Prefix) RateLimitKey {
+	trusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) string {
+		ip := remoteIP(r)
+		if !trusted(ip) {
+			return "ip:" + ip
+		}
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(forwarded[i])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !trusted(hop) {
+				break
+			}
+		}
+		return "ip:" + ip
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+// maxKeyBodyBytes bounds how much of a body ByEmail reads looking for an
+// email address.
+const maxKeyBodyBytes = 1 << 16
+
+// ByEmail counts requests against the email address in a JSON body, so that
+// attempts on one account are limited however many addresses they come from.
+// The body is left intact for the handler.
+func ByEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBodyBytes))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return ""
+	}
+
+	email := services.NormalizeEmail(req.Email)
+	if email == "" {
+		return ""
+	}
+	return "email:" + email
+}
+
+// rateLimitCharge is a token a request has been charged, kept so that it can
+// be refunded if a later limit turns the request away.
+type rateLimitCharge struct {
+	store RateLimitStore
+	key   string
+	limit config.RateLimit
+}
+
+// RateLimit limits requests to the wrapped handler. Each key gets its own
+// bucket within group, so route groups don't share buckets, and a request
+// has to fit in all of them. Throttled requests get a 429 with Retry-After,
+// and the tokens they were charged by this and any enclosing RateLimit are
+// refunded, so a request turned away by one bucket doesn't drain the others.
+// If the store fails the request goes through; a broken limiter shouldn't
+// take the API down with it.
+func RateLimit(store RateLimitStore, group string, limit config.RateLimit, keys ...RateLimitKey) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if !limit.Enabled() {
+			return next
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			charges, ok := r.Context().Value("rateLimitCharges").(*[]rateLimitCharge)
+			if !ok {
+				charges = &[]rateLimitCharge{}
+				r = r.WithContext(context.WithValue(r.Context(), "rateLimitCharges", charges))
+			}
+
+			now := time.Now()
+			for _, keyFor := range keys {
+				key := keyFor(r)
+				if key == "" {
+					continue
+				}
+
+				allowed, retryAfter, err := store.Take(r.Context(), group+":"+key, limit, now)
+				if err != nil {
+					rateLimitLogger(r).Error("rate limit check failed", "group", group, "error", err)
+					continue
+				}
+				if !allowed {
+					refund(r, *charges)
+					handlers.WriteError(w, r, services.TooManyRequests("rate_limited", "too many requests; try again later", retryAfter))
+					return
+				}
+				*charges = append(*charges, rateLimitCharge{store: store, key: group + ":" + key, limit: limit})
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// refund gives back the tokens a throttled request was charged.
+func refund(r *http.Request, charges []rateLimitCharge) {
+	for _, c := range charges {
+		if err := c.store.Refund(r.Context(), c.key, c.limit); err != nil {
+			rateLimitLogger(r).Error("rate limit refund failed", "key", c.key, "error", err)
+		}
+	}
+}
+
+func rateLimitLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value("logger").(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	per     time.Duration
+}
+
+// MemoryRateLimitStore keeps token buckets in memory.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit config.RateLimit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	perSecond := capacity / limit.Per.Seconds()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	} else if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(capacity, b.tokens+elapsed.Seconds()*perSecond)
+		b.updated = now
+	}
+	b.per = limit.Per
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	return false, wait, nil
+}
+
+func (s *MemoryRateLimitStore) Refund(ctx context.Context, key string, limit config.RateLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[key]; ok {
+		b.tokens = min(float64(limit.Requests), b.tokens+1)
+	}
+	return nil
+}
+
+// sweep drops buckets that have been idle long enough to refill, since
+// they're no different from having no bucket at all.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.per {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 	"ukoni/internal/database"
 )
@@ -44,3 +46,136 @@ func (m *ActivityLogModel) Create(ctx context.Context, dbtx database.DBTX, logEn
 		metadataJSON,
 	).Scan(&logEntry.ID, &logEntry.CreatedAt)
 }
+
+// ActivityLogFilter narrows an activity listing. Zero values are ignored.
+// Results are ordered newest first; when Before is set only entries strictly
+// older than the (created_at, id) pair it points at are returned.
+type ActivityLogFilter struct {
+	InventoryID  string
+	UserID       string
+	Action       string
+	ActionPrefix string
+	EntityType   string
+	EntityID     string
+	// ProductID matches entries about the product itself or any of its
+	// variants.
+	ProductID string
+	Since     *time.Time
+	Until     *time.Time
+	Before    *ActivityLogCursor
+	Limit     int
+}
+
+// ActivityLogCursor is the position of an entry in the (created_at, id)
+// ordering used for keyset pagination.
+type ActivityLogCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (m *ActivityLogModel) List(ctx context.Context, filter ActivityLogFilter) ([]*ActivityLog, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.InventoryID != "" {
+		conditions = append(conditions, "inventory_id = "+arg(filter.InventoryID))
+	}
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = "+arg(filter.UserID))
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = "+arg(filter.Action))
+	}
+	if filter.ActionPrefix != "" {
+		conditions = append(conditions, "action LIKE "+arg(escapeLike(filter.ActionPrefix)+"%"))
+	}
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = "+arg(filter.EntityType))
+	}
+	if filter.EntityID != "" {
+		conditions = append(conditions, "entity_id = "+arg(filter.EntityID))
+	}
+	if filter.ProductID != "" {
+		p := arg(filter.ProductID)
+		conditions = append(conditions, fmt.Sprintf(
+			"((entity_type = 'product' AND entity_id = %s) OR (entity_type = 'product_variant' AND entity_id IN (SELECT id FROM product_variants WHERE product_id = %s)))",
+			p, p,
+		))
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.Since))
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.Until))
+	}
+	if filter.Before != nil {
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < (%s, %s)", arg(filter.Before.CreatedAt), arg(filter.Before.ID)))
+	}
+
+	query := `
+		SELECT id, inventory_id, user_id, action, entity_type, entity_id, metadata, created_at
+		FROM activity_logs
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + arg(filter.Limit)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*ActivityLog{}
+	for rows.Next() {
+		var entry ActivityLog
+		var entityType sql.NullString
+		var metadata []byte
+		if err := rows.Scan(
+			&entry.ID, &entry.InventoryID, &entry.UserID, &entry.Action, &entityType, &entry.EntityID, &metadata, &entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entry.EntityType = entityType.String
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &entry.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Anonymise replaces a departed user's name and email wherever they appear
+// as values in activity metadata. Emails are replaced throughout, as
+// invitations record them; names only in entries the user made.
+func (m *ActivityLogModel) Anonymise(ctx context.Context, dbtx database.DBTX, userID, name, email, replacement string) error {
+	replace := `metadata = REPLACE(metadata::text, to_jsonb($1::text)::text, to_jsonb($2::text)::text)::jsonb`
+
+	query := `UPDATE activity_logs SET ` + replace + `
+		WHERE metadata IS NOT NULL AND metadata::text LIKE '%' || to_jsonb($1::text)::text || '%'`
+	for _, value := range []string{email, strings.ToLower(email)} {
+		if _, err := dbtx.ExecContext(ctx, query, value, replacement); err != nil {
+			return err
+		}
+	}
+
+	if name == "" {
+		return nil
+	}
+	query = `UPDATE activity_logs SET ` + replace + `
+		WHERE metadata IS NOT NULL AND user_id = $3`
+	_, err := dbtx.ExecContext(ctx, query, name, replacement, userID)
+	return err
+}
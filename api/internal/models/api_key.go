@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// APIKey is a personal access token a user creates for scripts and
+// integrations. It can be limited to one inventory and to reading.
+type APIKey struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"-"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	TokenHash   string     `json:"-"`
+	InventoryID *string    `json:"inventory_id"`
+	Scope       string     `json:"scope"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"-"`
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+const apiKeySelect = `
+		SELECT id, user_id, name, prefix, token_hash, inventory_id, scope, created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys
+`
+
+func scanAPIKey(scanner interface{ Scan(...any) error }) (*APIKey, error) {
+	var k APIKey
+	err := scanner.Scan(
+		&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.TokenHash, &k.InventoryID, &k.Scope, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (m *APIKeyModel) Create(ctx context.Context, dbtx database.DBTX, k *APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, token_hash, inventory_id, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query,
+		k.UserID, k.Name, k.Prefix, k.TokenHash, k.InventoryID, k.Scope, k.ExpiresAt,
+	).Scan(&k.ID, &k.CreatedAt)
+}
+
+// GetByTokenHash fetches the key a token belongs to, revoked or not.
+func (m *APIKeyModel) GetByTokenHash(ctx context.Context, hash string) (*APIKey, error) {
+	return scanAPIKey(m.DB.QueryRowContext(ctx, apiKeySelect+` WHERE token_hash = $1`, hash))
+}
+
+// ListForUser lists a user's keys that haven't been revoked, newest first.
+// Expired keys are included so users can see why a script stopped working.
+func (m *APIKeyModel) ListForUser(ctx context.Context, userID string) ([]*APIKey, error) {
+	rows, err := m.DB.QueryContext(ctx, apiKeySelect+` WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke revokes one of a user's keys. It returns sql.ErrNoRows if the user
+// has no such key.
+func (m *APIKeyModel) Revoke(ctx context.Context, dbtx database.DBTX, userID, id string, now time.Time) error {
+	result, err := dbtx.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = $3
+		WHERE id::text = $2 AND user_id = $1 AND revoked_at IS NULL`, userID, id, now)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every key a user has.
+func (m *APIKeyModel) RevokeAllForUser(ctx context.Context, dbtx database.DBTX, userID string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, userID, now)
+	return err
+}
+
+// MarkUsed records when a key was last used. Writes are skipped while the
+// recorded time is less than a minute old so busy scripts don't cause a
+// write per request.
+func (m *APIKeyModel) MarkUsed(ctx context.Context, id string, now time.Time) error {
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)`, id, now, now.Add(-time.Minute))
+	return err
+}
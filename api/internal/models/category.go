@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"ukoni/internal/database"
+)
+
+type Category struct {
+	ID               string     `json:"id"`
+	InventoryID      string     `json:"inventory_id"`
+	Name             string     `json:"name"`
+	ParentCategoryID *string    `json:"parent_category_id,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        *time.Time `json:"updated_at,omitempty"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CategoryNode is a category with its subcategories, used to return the
+// category tree of an inventory.
+type CategoryNode struct {
+	*Category
+	Children []*CategoryNode `json:"children"`
+}
+
+type CategoryModel struct {
+	DB *sql.DB
+}
+
+// categorySubtree returns a subquery selecting the category bound to the
+// given placeholder and all of its descendants.
+func categorySubtree(arg int) string {
+	return fmt.Sprintf(`(
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM product_categories WHERE id = $%d AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.id FROM product_categories c JOIN subtree s ON c.parent_category_id = s.id
+			WHERE c.deleted_at IS NULL
+		)
+		SELECT id FROM subtree
+	)`, arg)
+}
+
+func (m *CategoryModel) Create(ctx context.Context, dbtx database.DBTX, c *Category) error {
+	query := `
+		INSERT INTO product_categories (inventory_id, name, parent_category_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`
+	return dbtx.QueryRowContext(ctx, query,
+		c.InventoryID,
+		c.Name,
+		c.ParentCategoryID,
+	).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+}
+
+func (m *CategoryModel) GetByID(ctx context.Context, id string) (*Category, error) {
+	query := `
+		SELECT id, inventory_id, name, parent_category_id, created_at, updated_at, deleted_at
+		FROM product_categories
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	var c Category
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&c.ID, &c.InventoryID, &c.Name, &c.ParentCategoryID, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *CategoryModel) ListByInventory(ctx context.Context, inventoryID string) ([]*Category, error) {
+	query := `
+		SELECT id, inventory_id, name, parent_category_id, created_at, updated_at, deleted_at
+		FROM product_categories
+		WHERE inventory_id = $1 AND deleted_at IS NULL
+		ORDER BY name ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, query, inventoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*Category{}
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(
+			&c.ID, &c.InventoryID, &c.Name, &c.ParentCategoryID, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &c)
+	}
+	return categories, rows.Err()
+}
+
+func (m *CategoryModel) Update(ctx context.Context, dbtx database.DBTX, c *Category) error {
+	query := `
+		UPDATE product_categories
+		SET name = $1, parent_category_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING updated_at
+	`
+	return dbtx.QueryRowContext(ctx, query, c.Name, c.ParentCategoryID, c.ID).Scan(&c.UpdatedAt)
+}
+
+// Delete soft-deletes a category. Its subcategories and any products filed
+// under it are moved up to its parent so nothing is left pointing at it.
+func (m *CategoryModel) Delete(ctx context.Context, dbtx database.DBTX, c *Category) error {
+	statements := []string{
+		`UPDATE product_categories SET parent_category_id = $2, updated_at = CURRENT_TIMESTAMP WHERE parent_category_id = $1 AND deleted_at IS NULL`,
+		`UPDATE products SET category_id = $2 WHERE category_id = $1`,
+		`UPDATE canonical_products SET category_id = $2 WHERE category_id = $1`,
+	}
+	for _, query := range statements {
+		if _, err := dbtx.ExecContext(ctx, query, c.ID, c.ParentCategoryID); err != nil {
+			return err
+		}
+	}
+
+	result, err := dbtx.ExecContext(ctx, `UPDATE product_categories SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`, c.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
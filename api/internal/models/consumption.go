@@ -18,6 +18,22 @@ type ConsumptionEvent struct {
 	Source             string     `json:"source"`
 	ConsumedAt         time.Time  `json:"consumed_at"`
 	DeletedAt          *time.Time `json:"deleted_at,omitempty"`
+
+	Allocations []*ConsumptionAllocation `json:"allocations,omitempty"`
+}
+
+// ConsumptionAllocation records how much of a consumption event was debited
+// from a specific inventory product, so the drawdown can be audited and undone.
+type ConsumptionAllocation struct {
+	ID                 string     `json:"id"`
+	ConsumptionEventID string     `json:"consumption_event_id"`
+	InventoryProductID string     `json:"inventory_product_id"`
+	ProductVariantID   string     `json:"product_variant_id"`
+	Quantity           float64    `json:"quantity"`
+	Unit               *string    `json:"unit,omitempty"`
+	Confidence         float64    `json:"confidence"`
+	CreatedAt          time.Time  `json:"created_at"`
+	ReversedAt         *time.Time `json:"reversed_at,omitempty"`
 }
 
 type ConsumptionModel struct {
@@ -73,3 +89,98 @@ func (m *ConsumptionModel) List(ctx context.Context, inventoryID string, limit,
 	}
 	return events, rows.Err()
 }
+
+func (m *ConsumptionModel) GetByID(ctx context.Context, id string) (*ConsumptionEvent, error) {
+	query := `
+		SELECT id, inventory_id, canonical_product_id, created_by_user_id,
+		       quantity, unit, note, source, consumed_at, deleted_at
+		FROM consumption_events
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	var e ConsumptionEvent
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&e.ID, &e.InventoryID, &e.CanonicalProductID, &e.CreatedByUserID,
+		&e.Quantity, &e.Unit, &e.Note, &e.Source, &e.ConsumedAt, &e.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (m *ConsumptionModel) Delete(ctx context.Context, dbtx database.DBTX, id string) error {
+	query := `
+		UPDATE consumption_events
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	result, err := dbtx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *ConsumptionModel) CreateAllocation(ctx context.Context, dbtx database.DBTX, a *ConsumptionAllocation) error {
+	query := `
+		INSERT INTO consumption_allocations (
+			consumption_event_id, inventory_product_id, product_variant_id, quantity, unit, confidence
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query,
+		a.ConsumptionEventID,
+		a.InventoryProductID,
+		a.ProductVariantID,
+		a.Quantity,
+		a.Unit,
+		a.Confidence,
+	).Scan(&a.ID, &a.CreatedAt)
+}
+
+// ListAllocations returns the allocations of an event that have not been reversed.
+func (m *ConsumptionModel) ListAllocations(ctx context.Context, dbtx database.DBTX, eventID string) ([]*ConsumptionAllocation, error) {
+	query := `
+		SELECT id, consumption_event_id, inventory_product_id, product_variant_id,
+		       quantity, unit, confidence, created_at, reversed_at
+		FROM consumption_allocations
+		WHERE consumption_event_id = $1 AND reversed_at IS NULL
+		ORDER BY created_at ASC, id ASC
+	`
+	rows, err := dbtx.QueryContext(ctx, query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allocations []*ConsumptionAllocation
+	for rows.Next() {
+		var a ConsumptionAllocation
+		if err := rows.Scan(
+			&a.ID, &a.ConsumptionEventID, &a.InventoryProductID, &a.ProductVariantID,
+			&a.Quantity, &a.Unit, &a.Confidence, &a.CreatedAt, &a.ReversedAt,
+		); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, &a)
+	}
+	return allocations, rows.Err()
+}
+
+func (m *ConsumptionModel) ReverseAllocations(ctx context.Context, dbtx database.DBTX, eventID string) error {
+	query := `
+		UPDATE consumption_allocations
+		SET reversed_at = CURRENT_TIMESTAMP
+		WHERE consumption_event_id = $1 AND reversed_at IS NULL
+	`
+	_, err := dbtx.ExecContext(ctx, query, eventID)
+	return err
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// OutboxEmail is a rendered email waiting to be, or already, delivered.
+type OutboxEmail struct {
+	ID            string     `json:"id"`
+	Recipient     string     `json:"recipient"`
+	Template      string     `json:"template"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+type EmailOutboxModel struct {
+	DB *sql.DB
+}
+
+// Enqueue stores an email for delivery. Written inside the caller's
+// transaction, it is only picked up once that transaction commits.
+func (m *EmailOutboxModel) Enqueue(ctx context.Context, dbtx database.DBTX, email *OutboxEmail) error {
+	query := `
+		INSERT INTO email_outbox (recipient, template, subject, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, attempts, next_attempt_at, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query, email.Recipient, email.Template, email.Subject, email.Body).Scan(
+		&email.ID, &email.Status, &email.Attempts, &email.NextAttemptAt, &email.CreatedAt,
+	)
+}
+
+// ClaimDue locks up to limit pending emails whose next attempt is due,
+// skipping any another worker has already locked.
+func (m *EmailOutboxModel) ClaimDue(ctx context.Context, dbtx database.DBTX, now time.Time, limit int) ([]*OutboxEmail, error) {
+	query := `
+		SELECT id, recipient, template, subject, body, status, attempts, last_error, next_attempt_at, created_at, sent_at
+		FROM email_outbox
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at ASC, created_at ASC
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+	rows, err := dbtx.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []*OutboxEmail
+	for rows.Next() {
+		var e OutboxEmail
+		if err := rows.Scan(
+			&e.ID, &e.Recipient, &e.Template, &e.Subject, &e.Body, &e.Status, &e.Attempts, &e.LastError, &e.NextAttemptAt, &e.CreatedAt, &e.SentAt,
+		); err != nil {
+			return nil, err
+		}
+		emails = append(emails, &e)
+	}
+	return emails, rows.Err()
+}
+
+func (m *EmailOutboxModel) MarkSent(ctx context.Context, dbtx database.DBTX, id string, now time.Time) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sent', attempts = attempts + 1, sent_at = $1, last_error = NULL
+		WHERE id = $2
+	`
+	_, err := dbtx.ExecContext(ctx, query, now, id)
+	return err
+}
+
+// MarkFailed records a failed attempt. The email is retried at nextAttemptAt,
+// or given up on when nextAttemptAt is nil.
+func (m *EmailOutboxModel) MarkFailed(ctx context.Context, dbtx database.DBTX, id, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1,
+			last_error = $1,
+			status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			next_attempt_at = COALESCE($2, next_attempt_at)
+		WHERE id = $3
+	`
+	_, err := dbtx.ExecContext(ctx, query, lastError, nextAttemptAt, id)
+	return err
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// EmailVerificationToken is a single-use, expiring proof that a user can
+// read mail sent to Email. Only a hash of the token is stored.
+type EmailVerificationToken struct {
+	ID        string
+	UserID    string
+	Email     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type EmailVerificationModel struct {
+	DB *sql.DB
+}
+
+func (m *EmailVerificationModel) Create(ctx context.Context, dbtx database.DBTX, t *EmailVerificationToken) error {
+	query := `
+		INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query, t.UserID, t.Email, t.TokenHash, t.ExpiresAt).Scan(&t.ID, &t.CreatedAt)
+}
+
+// GetByHashForUpdate fetches a verification token by its hash and locks it
+// until the transaction ends.
+func (m *EmailVerificationModel) GetByHashForUpdate(ctx context.Context, dbtx database.DBTX, hash string) (*EmailVerificationToken, error) {
+	query := `
+		SELECT id, user_id, email, token_hash, created_at, expires_at, used_at
+		FROM email_verification_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+	var t EmailVerificationToken
+	err := dbtx.QueryRowContext(ctx, query, hash).Scan(&t.ID, &t.UserID, &t.Email, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UseAllForUser marks every outstanding verification token of a user as
+// used.
+func (m *EmailVerificationModel) UseAllForUser(ctx context.Context, dbtx database.DBTX, userID string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE email_verification_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`, now, userID)
+	return err
+}
@@ -12,6 +12,7 @@ type Inventory struct {
 	Name        string     `json:"name"`
 	OwnerUserID string     `json:"owner_user_id"`
 	CreatedAt   time.Time  `json:"created_at"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
 	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
@@ -31,13 +32,13 @@ func (m *InventoryModel) Create(ctx context.Context, dbtx database.DBTX, invento
 
 func (m *InventoryModel) GetByID(id string) (*Inventory, error) {
 	query := `
-		SELECT id, name, owner_user_id, created_at, deleted_at
+		SELECT id, name, owner_user_id, created_at, archived_at, deleted_at
 		FROM inventories
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 	var i Inventory
 	err := m.DB.QueryRowContext(context.Background(), query, id).Scan(
-		&i.ID, &i.Name, &i.OwnerUserID, &i.CreatedAt, &i.DeletedAt,
+		&i.ID, &i.Name, &i.OwnerUserID, &i.CreatedAt, &i.ArchivedAt, &i.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -45,14 +46,69 @@ func (m *InventoryModel) GetByID(id string) (*Inventory, error) {
 	return &i, nil
 }
 
-func (m *InventoryModel) ListByUserID(userID string) ([]*Inventory, error) {
+// InventorySummary is an inventory as listed for one of its users.
+type InventorySummary struct {
+	*Inventory
+
+	// Role is the user's effective role: "owner" or their membership role.
+	Role           string     `json:"role"`
+	MemberCount    int        `json:"member_count"`
+	LastActivityAt *time.Time `json:"last_activity_at"`
+}
+
+// ListForUser lists the inventories a user owns or is a current member of,
+// once each, oldest first.
+func (m *InventoryModel) ListForUser(ctx context.Context, userID string) ([]*InventorySummary, error) {
 	query := `
-		SELECT i.id, i.name, i.owner_user_id, i.created_at, i.deleted_at
+		SELECT i.id, i.name, i.owner_user_id, i.created_at, i.archived_at, i.deleted_at,
+			CASE WHEN i.owner_user_id = $1 THEN 'owner' ELSE (
+				SELECT im.role FROM inventory_memberships im
+				WHERE im.inventory_id = i.id AND im.user_id = $1 AND im.deleted_at IS NULL
+				ORDER BY im.invited_at ASC
+				LIMIT 1
+			) END,
+			(SELECT COUNT(*) FROM inventory_memberships im WHERE im.inventory_id = i.id AND im.deleted_at IS NULL),
+			(SELECT MAX(al.created_at) FROM activity_logs al WHERE al.inventory_id = i.id)
 		FROM inventories i
-		LEFT JOIN inventory_memberships im ON i.id = im.inventory_id
-		WHERE (i.owner_user_id = $1 OR im.user_id = $1) AND i.deleted_at IS NULL
+		WHERE i.deleted_at IS NULL AND (
+			i.owner_user_id = $1 OR EXISTS (
+				SELECT 1 FROM inventory_memberships im
+				WHERE im.inventory_id = i.id AND im.user_id = $1 AND im.deleted_at IS NULL
+			)
+		)
+		ORDER BY i.created_at ASC, i.id ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inventories := []*InventorySummary{}
+	for rows.Next() {
+		s := InventorySummary{Inventory: &Inventory{}}
+		if err := rows.Scan(
+			&s.ID, &s.Name, &s.OwnerUserID, &s.CreatedAt, &s.ArchivedAt, &s.DeletedAt,
+			&s.Role, &s.MemberCount, &s.LastActivityAt,
+		); err != nil {
+			return nil, err
+		}
+		inventories = append(inventories, &s)
+	}
+	return inventories, rows.Err()
+}
+
+// ListOwnedForUpdate lists the inventories a user owns and locks them until
+// the transaction ends.
+func (m *InventoryModel) ListOwnedForUpdate(ctx context.Context, dbtx database.DBTX, userID string) ([]*Inventory, error) {
+	query := `
+		SELECT id, name, owner_user_id, created_at, archived_at, deleted_at
+		FROM inventories
+		WHERE owner_user_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at ASC
+		FOR UPDATE
 	`
-	rows, err := m.DB.QueryContext(context.Background(), query, userID)
+	rows, err := dbtx.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -61,15 +117,66 @@ func (m *InventoryModel) ListByUserID(userID string) ([]*Inventory, error) {
 	var inventories []*Inventory
 	for rows.Next() {
 		var i Inventory
-		if err := rows.Scan(&i.ID, &i.Name, &i.OwnerUserID, &i.CreatedAt, &i.DeletedAt); err != nil {
+		if err := rows.Scan(&i.ID, &i.Name, &i.OwnerUserID, &i.CreatedAt, &i.ArchivedAt, &i.DeletedAt); err != nil {
 			return nil, err
 		}
 		inventories = append(inventories, &i)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return inventories, rows.Err()
+}
+
+// Lock holds an inventory's row until the transaction ends, so that changes
+// to its members that depend on each other happen one at a time.
+func (m *InventoryModel) Lock(ctx context.Context, dbtx database.DBTX, id string) error {
+	var locked string
+	return dbtx.QueryRowContext(ctx, `SELECT id FROM inventories WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&locked)
+}
+
+func (m *InventoryModel) SetOwner(ctx context.Context, dbtx database.DBTX, id, userID string) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE inventories SET owner_user_id = $1 WHERE id = $2 AND deleted_at IS NULL`, userID, id)
+	return err
+}
+
+func (m *InventoryModel) Archive(ctx context.Context, dbtx database.DBTX, id string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE inventories SET archived_at = $1 WHERE id = $2 AND deleted_at IS NULL AND archived_at IS NULL`, now, id)
+	return err
+}
+
+func (m *InventoryModel) Unarchive(ctx context.Context, dbtx database.DBTX, id string) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE inventories SET archived_at = NULL WHERE id = $1 AND deleted_at IS NULL`, id)
+	return err
+}
+
+func (m *InventoryModel) Rename(ctx context.Context, dbtx database.DBTX, id, name string) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE inventories SET name = $1 WHERE id = $2 AND deleted_at IS NULL`, name, id)
+	return err
+}
+
+// inventoryContents are the statements that soft delete what an inventory
+// holds. Purchases, consumption and adjustments stay as history.
+var inventoryContents = []string{
+	`UPDATE shopping_list_items SET deleted_at = $2
+		WHERE deleted_at IS NULL AND shopping_list_id IN (SELECT id FROM shopping_lists WHERE inventory_id = $1)`,
+	`UPDATE shopping_lists SET deleted_at = $2 WHERE inventory_id = $1 AND deleted_at IS NULL`,
+	`UPDATE inventory_products SET deleted_at = $2 WHERE inventory_id = $1 AND deleted_at IS NULL`,
+	`UPDATE product_variants SET deleted_at = $2
+		WHERE deleted_at IS NULL AND product_id IN (SELECT id FROM products WHERE inventory_id = $1)`,
+	`UPDATE products SET deleted_at = $2 WHERE inventory_id = $1 AND deleted_at IS NULL`,
+	`UPDATE canonical_products SET deleted_at = $2 WHERE inventory_id = $1 AND deleted_at IS NULL`,
+	`UPDATE product_categories SET deleted_at = $2 WHERE inventory_id = $1 AND deleted_at IS NULL`,
+	`UPDATE inventories SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`,
+}
+
+// SoftDelete deletes an inventory together with its products, shopping
+// lists, stock and open invitations.
+func (m *InventoryModel) SoftDelete(ctx context.Context, dbtx database.DBTX, id string, now time.Time) error {
+	for _, query := range inventoryContents {
+		if _, err := dbtx.ExecContext(ctx, query, id, now); err != nil {
+			return err
+		}
 	}
-	return inventories, nil
+	_, err := dbtx.ExecContext(ctx, `UPDATE invitations SET status = 'revoked' WHERE inventory_id = $1 AND status = 'pending'`, id)
+	return err
 }
 
 // Ensure UUID validity check helper if needed, but for now assuming valid UUID strings from higher layers or DB handles generation.
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// InventoryAdjustment is a manual change to stock that did not come from a
+// transaction or a consumption event, e.g. a stock-take or spoiled goods.
+type InventoryAdjustment struct {
+	ID                 string     `json:"id"`
+	InventoryID        string     `json:"inventory_id"`
+	InventoryProductID string     `json:"inventory_product_id"`
+	ProductVariantID   string     `json:"product_variant_id"`
+	AdjustmentType     string     `json:"adjustment_type"` // 'stock_take', 'spoilage', 'gift', 'correction'
+	QuantityChange     float64    `json:"quantity_change"`
+	QuantityBefore     float64    `json:"quantity_before"`
+	QuantityAfter      float64    `json:"quantity_after"`
+	Unit               *string    `json:"unit,omitempty"`
+	Note               *string    `json:"note,omitempty"`
+	CreatedByUserID    string     `json:"created_by_user_id"`
+	CreatedAt          time.Time  `json:"created_at"`
+	DeletedAt          *time.Time `json:"deleted_at,omitempty"`
+}
+
+type InventoryAdjustmentModel struct {
+	DB *sql.DB
+}
+
+func (m *InventoryAdjustmentModel) Create(ctx context.Context, dbtx database.DBTX, a *InventoryAdjustment) error {
+	query := `
+		INSERT INTO inventory_adjustments (
+			inventory_id, inventory_product_id, product_variant_id, adjustment_type,
+			quantity_change, quantity_before, quantity_after, unit, note, created_by_user_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query,
+		a.InventoryID,
+		a.InventoryProductID,
+		a.ProductVariantID,
+		a.AdjustmentType,
+		a.QuantityChange,
+		a.QuantityBefore,
+		a.QuantityAfter,
+		a.Unit,
+		a.Note,
+		a.CreatedByUserID,
+	).Scan(&a.ID, &a.CreatedAt)
+}
+
+func (m *InventoryAdjustmentModel) ListByVariant(ctx context.Context, inventoryID, productVariantID string, limit, offset int) ([]*InventoryAdjustment, error) {
+	query := `
+		SELECT id, inventory_id, inventory_product_id, product_variant_id, adjustment_type,
+		       quantity_change, quantity_before, quantity_after, unit, note, created_by_user_id,
+		       created_at, deleted_at
+		FROM inventory_adjustments
+		WHERE inventory_id = $1 AND product_variant_id = $2 AND deleted_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := m.DB.QueryContext(ctx, query, inventoryID, productVariantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var adjustments []*InventoryAdjustment
+	for rows.Next() {
+		var a InventoryAdjustment
+		if err := rows.Scan(
+			&a.ID, &a.InventoryID, &a.InventoryProductID, &a.ProductVariantID, &a.AdjustmentType,
+			&a.QuantityChange, &a.QuantityBefore, &a.QuantityAfter, &a.Unit, &a.Note, &a.CreatedByUserID,
+			&a.CreatedAt, &a.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, &a)
+	}
+	return adjustments, rows.Err()
+}
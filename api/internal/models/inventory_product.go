@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 	"ukoni/internal/database"
 )
@@ -18,6 +19,26 @@ type InventoryProduct struct {
 	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
 }
 
+// StockItem is an inventory product joined with the names of the variant,
+// product and canonical product it represents.
+type StockItem struct {
+	InventoryProduct
+	VariantName          string   `json:"variant_name"`
+	VariantSize          *float64 `json:"variant_size,omitempty"`
+	SKU                  *string  `json:"sku,omitempty"`
+	ProductID            string   `json:"product_id"`
+	ProductName          string   `json:"product_name"`
+	Brand                *string  `json:"brand,omitempty"`
+	CategoryID           *string  `json:"category_id,omitempty"`
+	CanonicalProductID   *string  `json:"canonical_product_id,omitempty"`
+	CanonicalProductName *string  `json:"canonical_product_name,omitempty"`
+}
+
+type StockFilter struct {
+	CanonicalProductID string
+	CategoryID         string
+}
+
 type InventoryProductModel struct {
 	DB *sql.DB
 }
@@ -41,7 +62,28 @@ func (m *InventoryProductModel) Get(ctx context.Context, inventoryID, productVar
 	return &ip, nil
 }
 
-func (m *InventoryProductModel) Upsert(ctx context.Context, dbtx database.DBTX, inventoryID, productVariantID string, quantityChange float64, unit *string) error {
+// GetForUpdate fetches a stock row and locks it until the transaction ends.
+func (m *InventoryProductModel) GetForUpdate(ctx context.Context, dbtx database.DBTX, inventoryID, productVariantID string) (*InventoryProduct, error) {
+	query := `
+		SELECT id, inventory_id, product_variant_id, quantity, unit, created_at, last_updated, deleted_at
+		FROM inventory_products
+		WHERE inventory_id = $1 AND product_variant_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	var ip InventoryProduct
+	err := dbtx.QueryRowContext(ctx, query, inventoryID, productVariantID).Scan(
+		&ip.ID, &ip.InventoryID, &ip.ProductVariantID, &ip.Quantity, &ip.Unit, &ip.CreatedAt, &ip.LastUpdated, &ip.DeletedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ip, nil
+}
+
+func (m *InventoryProductModel) Upsert(ctx context.Context, dbtx database.DBTX, inventoryID, productVariantID string, quantityChange float64, unit *string) (string, error) {
 	query := `
 		INSERT INTO inventory_products (inventory_id, product_variant_id, quantity, unit)
 		VALUES ($1, $2, $3, $4)
@@ -53,7 +95,8 @@ func (m *InventoryProductModel) Upsert(ctx context.Context, dbtx database.DBTX,
 		RETURNING id
 	`
 	var id string
-	return dbtx.QueryRowContext(ctx, query, inventoryID, productVariantID, quantityChange, unit).Scan(&id)
+	err := dbtx.QueryRowContext(ctx, query, inventoryID, productVariantID, quantityChange, unit).Scan(&id)
+	return id, err
 }
 
 func (m *InventoryProductModel) List(ctx context.Context, inventoryID string, limit, offset int) ([]*InventoryProduct, error) {
@@ -82,3 +125,157 @@ func (m *InventoryProductModel) List(ctx context.Context, inventoryID string, li
 	}
 	return products, rows.Err()
 }
+
+// ListForCanonicalProduct returns the in-stock rows for every variant of a
+// canonical product, oldest first, locking them until the transaction ends.
+func (m *InventoryProductModel) ListForCanonicalProduct(ctx context.Context, dbtx database.DBTX, inventoryID, canonicalProductID string) ([]*InventoryProduct, error) {
+	query := `
+		SELECT ip.id, ip.inventory_id, ip.product_variant_id, ip.quantity, ip.unit, ip.created_at, ip.last_updated, ip.deleted_at
+		FROM inventory_products ip
+		JOIN product_variants pv ON pv.id = ip.product_variant_id
+		JOIN products p ON p.id = pv.product_id
+		WHERE ip.inventory_id = $1 AND p.canonical_product_id = $2
+		  AND ip.deleted_at IS NULL AND ip.quantity > 0
+		ORDER BY ip.created_at ASC, ip.id ASC
+		FOR UPDATE OF ip
+	`
+	rows, err := dbtx.QueryContext(ctx, query, inventoryID, canonicalProductID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []*InventoryProduct
+	for rows.Next() {
+		var ip InventoryProduct
+		if err := rows.Scan(
+			&ip.ID, &ip.InventoryID, &ip.ProductVariantID, &ip.Quantity, &ip.Unit, &ip.CreatedAt, &ip.LastUpdated, &ip.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		products = append(products, &ip)
+	}
+	return products, rows.Err()
+}
+
+func (m *InventoryProductModel) AdjustQuantity(ctx context.Context, dbtx database.DBTX, id string, quantityChange float64) error {
+	query := `
+		UPDATE inventory_products
+		SET quantity = quantity + $1, last_updated = CURRENT_TIMESTAMP
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+	result, err := dbtx.ExecContext(ctx, query, quantityChange, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const stockItemSelect = `
+		SELECT ip.id, ip.inventory_id, ip.product_variant_id, ip.quantity, ip.unit, ip.created_at, ip.last_updated, ip.deleted_at,
+		       pv.variant_name, pv.size, pv.sku,
+		       p.id, p.name, p.brand, p.category_id,
+		       cp.id, cp.name
+		FROM inventory_products ip
+		JOIN product_variants pv ON pv.id = ip.product_variant_id
+		JOIN products p ON p.id = pv.product_id
+		LEFT JOIN canonical_products cp ON cp.id = p.canonical_product_id
+`
+
+func scanStockItem(scanner interface{ Scan(...any) error }) (*StockItem, error) {
+	var item StockItem
+	err := scanner.Scan(
+		&item.ID, &item.InventoryID, &item.ProductVariantID, &item.Quantity, &item.Unit, &item.CreatedAt, &item.LastUpdated, &item.DeletedAt,
+		&item.VariantName, &item.VariantSize, &item.SKU,
+		&item.ProductID, &item.ProductName, &item.Brand, &item.CategoryID,
+		&item.CanonicalProductID, &item.CanonicalProductName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (m *InventoryProductModel) ListStock(ctx context.Context, inventoryID string, filter StockFilter, limit, offset int) ([]*StockItem, error) {
+	query := stockItemSelect + `
+		WHERE ip.inventory_id = $1 AND ip.deleted_at IS NULL
+	`
+	args := []interface{}{inventoryID}
+	argCount := 2
+
+	if filter.CanonicalProductID != "" {
+		query += fmt.Sprintf(" AND p.canonical_product_id = $%d", argCount)
+		args = append(args, filter.CanonicalProductID)
+		argCount++
+	}
+	if filter.CategoryID != "" {
+		subtree := categorySubtree(argCount)
+		query += fmt.Sprintf(" AND (p.category_id IN %s OR cp.category_id IN %s)", subtree, subtree)
+		args = append(args, filter.CategoryID)
+		argCount++
+	}
+
+	query += fmt.Sprintf(" ORDER BY p.name ASC, pv.variant_name ASC LIMIT $%d OFFSET $%d", argCount, argCount+1)
+	args = append(args, limit, offset)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*StockItem{}
+	for rows.Next() {
+		item, err := scanStockItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ListStockByCanonicalProduct returns every stock row of the variants linked to
+// a canonical product, oldest first.
+func (m *InventoryProductModel) ListStockByCanonicalProduct(ctx context.Context, inventoryID, canonicalProductID string) ([]*StockItem, error) {
+	query := stockItemSelect + `
+		WHERE ip.inventory_id = $1 AND p.canonical_product_id = $2 AND ip.deleted_at IS NULL
+		ORDER BY ip.created_at ASC, ip.id ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, query, inventoryID, canonicalProductID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*StockItem
+	for rows.Next() {
+		item, err := scanStockItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (m *InventoryProductModel) GetStock(ctx context.Context, inventoryID, productVariantID string) (*StockItem, error) {
+	query := stockItemSelect + `
+		WHERE ip.inventory_id = $1 AND ip.product_variant_id = $2 AND ip.deleted_at IS NULL
+	`
+	item, err := scanStockItem(m.DB.QueryRowContext(ctx, query, inventoryID, productVariantID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return item, nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+// InventoryTransfer is an offer from an inventory's owner to make one of its
+// admins the owner instead.
+type InventoryTransfer struct {
+	ID          string     `json:"id"`
+	InventoryID string     `json:"inventory_id"`
+	FromUserID  string     `json:"from_user_id"`
+	ToUserID    string     `json:"to_user_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+type InventoryTransferModel struct {
+	DB *sql.DB
+}
+
+func (m *InventoryTransferModel) Create(ctx context.Context, dbtx database.DBTX, t *InventoryTransfer) error {
+	query := `
+		INSERT INTO inventory_transfers (inventory_id, from_user_id, to_user_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query, t.InventoryID, t.FromUserID, t.ToUserID).Scan(&t.ID, &t.Status, &t.CreatedAt)
+}
+
+// GetPending returns the open transfer of an inventory and locks it until
+// the transaction ends.
+func (m *InventoryTransferModel) GetPending(ctx context.Context, dbtx database.DBTX, inventoryID string) (*InventoryTransfer, error) {
+	query := `
+		SELECT id, inventory_id, from_user_id, to_user_id, status, created_at, responded_at
+		FROM inventory_transfers
+		WHERE inventory_id = $1 AND status = 'pending'
+		FOR UPDATE
+	`
+	var t InventoryTransfer
+	err := dbtx.QueryRowContext(ctx, query, inventoryID).Scan(
+		&t.ID, &t.InventoryID, &t.FromUserID, &t.ToUserID, &t.Status, &t.CreatedAt, &t.RespondedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Resolve closes a pending transfer with the given status.
+func (m *InventoryTransferModel) Resolve(ctx context.Context, dbtx database.DBTX, t *InventoryTransfer, status string, now time.Time) error {
+	query := `
+		UPDATE inventory_transfers
+		SET status = $1, responded_at = $2
+		WHERE id = $3 AND status = 'pending'
+	`
+	result, err := dbtx.ExecContext(ctx, query, status, now, t.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	t.Status = status
+	t.RespondedAt = &now
+	return nil
+}
+
+// CancelPending cancels the open transfer of an inventory, if there is one.
+func (m *InventoryTransferModel) CancelPending(ctx context.Context, dbtx database.DBTX, inventoryID string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE inventory_transfers SET status = 'cancelled', responded_at = $1 WHERE inventory_id = $2 AND status = 'pending'`, now, inventoryID)
+	return err
+}
+
+// CancelPendingForUser cancels the open transfers a user offered or was
+// offered.
+func (m *InventoryTransferModel) CancelPendingForUser(ctx context.Context, dbtx database.DBTX, userID string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE inventory_transfers SET status = 'cancelled', responded_at = $1 WHERE (from_user_id = $2 OR to_user_id = $2) AND status = 'pending'`, now, userID)
+	return err
+}
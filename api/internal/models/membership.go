@@ -2,9 +2,7 @@ package models
 
 import (
 	"context"
-	"crypto/subtle"
 	"database/sql"
-	"errors"
 	"time"
 	"ukoni/internal/database"
 )
@@ -25,23 +23,26 @@ type Invitation struct {
 	Role            string     `json:"role"`
 	InvitedByUserID string     `json:"invited_by_user_id"`
 	Status          string     `json:"status"`
-	Token           string     `json:"token"`
+	Token           string     `json:"-"`
 	CreatedAt       time.Time  `json:"created_at"`
 	AcceptedAt      *time.Time `json:"accepted_at,omitempty"`
 	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+
+	// Join fields
+	InventoryName string `json:"inventory_name,omitempty"`
 }
 
 type MembershipModel struct {
 	DB *sql.DB
 }
 
-func (m *MembershipModel) CreateInvitation(invitation *Invitation) error {
+func (m *MembershipModel) CreateInvitation(ctx context.Context, dbtx database.DBTX, invitation *Invitation) error {
 	query := `
 		INSERT INTO invitations (inventory_id, email, role, invited_by_user_id, status, token, expires_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at
 	`
-	return m.DB.QueryRowContext(context.Background(), query,
+	return dbtx.QueryRowContext(ctx, query,
 		invitation.InventoryID, invitation.Email, invitation.Role, invitation.InvitedByUserID, invitation.Status, invitation.Token, invitation.ExpiresAt,
 	).Scan(&invitation.ID, &invitation.CreatedAt)
 }
@@ -62,56 +63,195 @@ func (m *MembershipModel) GetInvitationByID(id string) (*Invitation, error) {
 	return &i, nil
 }
 
-func (m *MembershipModel) AcceptInvitation(inviteID, token, userID string, now time.Time) error {
-	// Start a transaction
-	tx, err := m.DB.BeginTx(context.Background(), nil)
+// ListInvitations lists the invitations of an inventory, newest first,
+// optionally only those with the given status.
+func (m *MembershipModel) ListInvitations(inventoryID, status string) ([]*Invitation, error) {
+	query := `
+		SELECT id, inventory_id, email, role, invited_by_user_id, status, token, created_at, accepted_at, expires_at
+		FROM invitations
+		WHERE inventory_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+	`
+	rows, err := m.DB.QueryContext(context.Background(), query, inventoryID, status)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.InventoryID, &i.Email, &i.Role, &i.InvitedByUserID, &i.Status, &i.Token, &i.CreatedAt, &i.AcceptedAt, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &i)
 	}
-	defer tx.Rollback()
+	return invitations, rows.Err()
+}
 
-	// 1. Get the invitation to verify and get details
-	var i Invitation
-	queryInvite := `
-		SELECT inventory_id, role, status, token, expires_at
-		FROM invitations
-		WHERE id = $1 FOR UPDATE
+// ListPendingInvitationsForEmail lists the invitations still open to an email
+// address, matched case-insensitively, with the name of each inventory.
+func (m *MembershipModel) ListPendingInvitationsForEmail(email string, now time.Time) ([]*Invitation, error) {
+	query := `
+		SELECT i.id, i.inventory_id, i.email, i.role, i.invited_by_user_id, i.status, i.token, i.created_at, i.accepted_at, i.expires_at, inv.name
+		FROM invitations i
+		JOIN inventories inv ON inv.id = i.inventory_id
+		WHERE LOWER(i.email) = LOWER($1) AND i.status = 'pending'
+			AND (i.expires_at IS NULL OR i.expires_at > $2)
+			AND inv.deleted_at IS NULL
+		ORDER BY i.created_at DESC
+	`
+	rows, err := m.DB.QueryContext(context.Background(), query, email, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.InventoryID, &i.Email, &i.Role, &i.InvitedByUserID, &i.Status, &i.Token, &i.CreatedAt, &i.AcceptedAt, &i.ExpiresAt, &i.InventoryName); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &i)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation withdraws a pending invitation. It returns sql.ErrNoRows
+// when the invitation is no longer pending.
+func (m *MembershipModel) RevokeInvitation(ctx context.Context, dbtx database.DBTX, id string) error {
+	query := `
+		UPDATE invitations
+		SET status = 'revoked'
+		WHERE id = $1 AND status = 'pending'
 	`
-	err = tx.QueryRowContext(context.Background(), queryInvite, inviteID).Scan(&i.InventoryID, &i.Role, &i.Status, &i.Token, &i.ExpiresAt)
+	result, err := dbtx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
 	if err != nil {
-		return err // Handle not found
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
 	}
+	return nil
+}
+
+// RenewInvitation gives a pending or expired invitation a new token and
+// expiry, making it pending again. It returns sql.ErrNoRows when the
+// invitation has been accepted or revoked.
+func (m *MembershipModel) RenewInvitation(ctx context.Context, dbtx database.DBTX, invitation *Invitation) error {
+	query := `
+		UPDATE invitations
+		SET token = $1, expires_at = $2, status = 'pending'
+		WHERE id = $3 AND status IN ('pending', 'expired')
+		RETURNING status
+	`
+	return dbtx.QueryRowContext(ctx, query, invitation.Token, invitation.ExpiresAt, invitation.ID).Scan(&invitation.Status)
+}
 
-	if i.Status != "pending" {
-		return errors.New("invitation is not pending")
+// ExpireInvitations marks pending invitations past their expiry as expired
+// and returns them.
+func (m *MembershipModel) ExpireInvitations(ctx context.Context, now time.Time) ([]*Invitation, error) {
+	query := `
+		UPDATE invitations
+		SET status = 'expired'
+		WHERE status = 'pending' AND expires_at < $1
+		RETURNING id, inventory_id, email, role, invited_by_user_id, status, token, created_at, accepted_at, expires_at
+	`
+	rows, err := m.DB.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	if subtle.ConstantTimeCompare([]byte(i.Token), []byte(token)) != 1 {
-		return errors.New("invalid invitation token")
+	invitations := []*Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.InventoryID, &i.Email, &i.Role, &i.InvitedByUserID, &i.Status, &i.Token, &i.CreatedAt, &i.AcceptedAt, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &i)
 	}
+	return invitations, rows.Err()
+}
 
-	if i.ExpiresAt != nil && i.ExpiresAt.Before(now) {
-		return errors.New("invitation has expired")
+const invitationSelect = `
+		SELECT id, inventory_id, email, role, invited_by_user_id, status, token, created_at, accepted_at, expires_at
+		FROM invitations
+`
+
+func scanInvitation(scanner interface{ Scan(...any) error }) (*Invitation, error) {
+	var i Invitation
+	if err := scanner.Scan(&i.ID, &i.InventoryID, &i.Email, &i.Role, &i.InvitedByUserID, &i.Status, &i.Token, &i.CreatedAt, &i.AcceptedAt, &i.ExpiresAt); err != nil {
+		return nil, err
 	}
+	return &i, nil
+}
+
+// GetInvitationForUpdate fetches an invitation by ID and locks it until the
+// transaction ends.
+func (m *MembershipModel) GetInvitationForUpdate(ctx context.Context, dbtx database.DBTX, id string) (*Invitation, error) {
+	return scanInvitation(dbtx.QueryRowContext(ctx, invitationSelect+` WHERE id = $1 FOR UPDATE`, id))
+}
+
+// GetInvitationByTokenForUpdate fetches an invitation by its token and locks
+// it until the transaction ends.
+func (m *MembershipModel) GetInvitationByTokenForUpdate(ctx context.Context, dbtx database.DBTX, token string) (*Invitation, error) {
+	return scanInvitation(dbtx.QueryRowContext(ctx, invitationSelect+` WHERE token = $1 FOR UPDATE`, token))
+}
 
-	// 2. Update invitation status
-	updateInvite := `
+// MarkInvitationAccepted records that a pending invitation has been accepted.
+func (m *MembershipModel) MarkInvitationAccepted(ctx context.Context, dbtx database.DBTX, id string, now time.Time) error {
+	query := `
 		UPDATE invitations
 		SET status = 'accepted', accepted_at = $1
-		WHERE id = $2
+		WHERE id = $2 AND status = 'pending'
 	`
-	_, err = tx.ExecContext(context.Background(), updateInvite, now, inviteID)
+	result, err := dbtx.ExecContext(ctx, query, now, id)
 	if err != nil {
 		return err
 	}
-
-	// 3. Create membership
-	err = m.AddMember(context.Background(), tx, i.InventoryID, userID, i.Role)
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsMember reports whether a user has an active membership of an inventory.
+func (m *MembershipModel) IsMember(ctx context.Context, dbtx database.DBTX, inventoryID, userID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM inventory_memberships
+			WHERE inventory_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		)
+	`
+	var exists bool
+	err := dbtx.QueryRowContext(ctx, query, inventoryID, userID).Scan(&exists)
+	return exists, err
+}
 
-	return tx.Commit()
+// IsMemberByEmail reports whether the user with an email, matched
+// case-insensitively, has an active membership of an inventory.
+func (m *MembershipModel) IsMemberByEmail(inventoryID, email string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM inventory_memberships im
+			JOIN users u ON u.id = im.user_id
+			WHERE im.inventory_id = $1 AND LOWER(u.email) = LOWER($2)
+				AND im.deleted_at IS NULL AND u.deleted_at IS NULL
+		)
+	`
+	var exists bool
+	err := m.DB.QueryRowContext(context.Background(), query, inventoryID, email).Scan(&exists)
+	return exists, err
 }
 
 func (m *MembershipModel) ListMembers(inventoryID string) ([]*InventoryMembership, error) {
@@ -172,3 +312,115 @@ func (m *MembershipModel) GetMembership(inventoryID, userID string) (*InventoryM
 	}
 	return &member, nil
 }
+
+// GetMembershipForUpdate fetches a user's active membership of an inventory
+// and locks it until the transaction ends.
+func (m *MembershipModel) GetMembershipForUpdate(ctx context.Context, dbtx database.DBTX, inventoryID, userID string) (*InventoryMembership, error) {
+	query := `
+		SELECT id, inventory_id, user_id, role, invited_at, deleted_at
+		FROM inventory_memberships
+		WHERE inventory_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	var member InventoryMembership
+	err := dbtx.QueryRowContext(ctx, query, inventoryID, userID).Scan(
+		&member.ID, &member.InventoryID, &member.UserID, &member.Role, &member.InvitedAt, &member.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// CountAdmins counts the active admins of an inventory other than its owner,
+// whose admin membership can't be changed, locking their memberships so the
+// count holds until the transaction ends.
+func (m *MembershipModel) CountAdmins(ctx context.Context, dbtx database.DBTX, inventoryID string) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM (
+			SELECT id FROM inventory_memberships
+			WHERE inventory_id = $1 AND role = 'admin' AND deleted_at IS NULL
+				AND user_id <> (SELECT owner_user_id FROM inventories WHERE id = $1)
+			FOR UPDATE
+		) admins
+	`
+	var count int
+	err := dbtx.QueryRowContext(ctx, query, inventoryID).Scan(&count)
+	return count, err
+}
+
+// UpdateRole changes the role of an active membership.
+func (m *MembershipModel) UpdateRole(ctx context.Context, dbtx database.DBTX, membershipID, role string) error {
+	query := `
+		UPDATE inventory_memberships
+		SET role = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+	result, err := dbtx.ExecContext(ctx, query, role, membershipID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EndMembership soft-deletes an active membership.
+func (m *MembershipModel) EndMembership(ctx context.Context, dbtx database.DBTX, membershipID string, now time.Time) error {
+	query := `
+		UPDATE inventory_memberships
+		SET deleted_at = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+	_, err := dbtx.ExecContext(ctx, query, now, membershipID)
+	return err
+}
+
+// OldestAdmin returns the user ID of the longest-standing admin of an
+// inventory other than excludeUserID. It returns sql.ErrNoRows when there is
+// none.
+func (m *MembershipModel) OldestAdmin(ctx context.Context, dbtx database.DBTX, inventoryID, excludeUserID string) (string, error) {
+	query := `
+		SELECT im.user_id
+		FROM inventory_memberships im
+		JOIN users u ON u.id = im.user_id
+		WHERE im.inventory_id = $1 AND im.user_id <> $2 AND im.role = 'admin'
+			AND im.deleted_at IS NULL AND u.deleted_at IS NULL
+		ORDER BY im.invited_at ASC, im.id ASC
+		LIMIT 1
+	`
+	var userID string
+	err := dbtx.QueryRowContext(ctx, query, inventoryID, excludeUserID).Scan(&userID)
+	return userID, err
+}
+
+// RemoveAllForUser ends every membership a user holds and returns the
+// inventories they belonged to.
+func (m *MembershipModel) RemoveAllForUser(ctx context.Context, dbtx database.DBTX, userID string, now time.Time) ([]string, error) {
+	query := `
+		UPDATE inventory_memberships
+		SET deleted_at = $1
+		WHERE user_id = $2 AND deleted_at IS NULL
+		RETURNING inventory_id
+	`
+	rows, err := dbtx.QueryContext(ctx, query, now, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inventoryIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		inventoryIDs = append(inventoryIDs, id)
+	}
+	return inventoryIDs, rows.Err()
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// OIDCLoginAttempt is a login started at an OpenID Connect provider that
+// hasn't come back yet. It can be finished once, before it expires.
+type OIDCLoginAttempt struct {
+	ID           string
+	Provider     string
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+}
+
+type OIDCLoginModel struct {
+	DB *sql.DB
+}
+
+func (m *OIDCLoginModel) Create(ctx context.Context, dbtx database.DBTX, a *OIDCLoginAttempt) error {
+	query := `
+		INSERT INTO oidc_login_attempts (provider, state_hash, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query, a.Provider, a.StateHash, a.Nonce, a.CodeVerifier, a.ExpiresAt).Scan(&a.ID, &a.CreatedAt)
+}
+
+// Use marks the live attempt with the given state as used and returns it,
+// or sql.ErrNoRows if there isn't one.
+func (m *OIDCLoginModel) Use(ctx context.Context, dbtx database.DBTX, provider, stateHash string, now time.Time) (*OIDCLoginAttempt, error) {
+	query := `
+		UPDATE oidc_login_attempts
+		SET used_at = $1
+		WHERE provider = $2 AND state_hash = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING id, provider, state_hash, nonce, code_verifier, created_at, expires_at, used_at
+	`
+	var a OIDCLoginAttempt
+	err := dbtx.QueryRowContext(ctx, query, now, provider, stateHash).Scan(
+		&a.ID, &a.Provider, &a.StateHash, &a.Nonce, &a.CodeVerifier, &a.CreatedAt, &a.ExpiresAt, &a.UsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// DeleteExpired removes attempts that can no longer be finished.
+func (m *OIDCLoginModel) DeleteExpired(ctx context.Context, dbtx database.DBTX, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `DELETE FROM oidc_login_attempts WHERE expires_at <= $1 OR used_at IS NOT NULL`, now)
+	return err
+}
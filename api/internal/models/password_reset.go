@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// PasswordResetToken is a single-use, expiring grant to choose a new
+// password. Only a hash of the token is stored.
+type PasswordResetToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+func (m *PasswordResetModel) Create(ctx context.Context, dbtx database.DBTX, t *PasswordResetToken) error {
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query, t.UserID, t.TokenHash, t.ExpiresAt).Scan(&t.ID, &t.CreatedAt)
+}
+
+// GetByHashForUpdate fetches a reset token by its hash and locks it until the
+// transaction ends.
+func (m *PasswordResetModel) GetByHashForUpdate(ctx context.Context, dbtx database.DBTX, hash string) (*PasswordResetToken, error) {
+	query := `
+		SELECT id, user_id, token_hash, created_at, expires_at, used_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+	var t PasswordResetToken
+	err := dbtx.QueryRowContext(ctx, query, hash).Scan(&t.ID, &t.UserID, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UseAllForUser marks every outstanding reset token of a user as used, so
+// only the newest link, or none, works.
+func (m *PasswordResetModel) UseAllForUser(ctx context.Context, dbtx database.DBTX, userID string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`, now, userID)
+	return err
+}
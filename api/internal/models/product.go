@@ -23,11 +23,25 @@ type Product struct {
 type ProductVariant struct {
 	ID          string     `json:"id"`
 	ProductID   string     `json:"product_id"`
+	InventoryID string     `json:"inventory_id"`
 	VariantName string     `json:"variant_name"`
 	SKU         *string    `json:"sku,omitempty"`
+	GTIN        *string    `json:"gtin,omitempty"`
 	Unit        *string    `json:"unit,omitempty"`
 	Size        *float64   `json:"size,omitempty"`
 	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+
+	// Join fields
+	Product *Product `json:"product,omitempty"`
+}
+
+// VariantUsage is what still refers to a variant: the stock held of it, the
+// shopping list items waiting to be bought and the transaction items that
+// bought it.
+type VariantUsage struct {
+	StockQuantity     float64
+	OpenShoppingItems int
+	TransactionItems  int
 }
 
 type ProductModel struct {
@@ -69,7 +83,9 @@ func (m *ProductModel) GetByID(ctx context.Context, id string) (*Product, error)
 	return &p, nil
 }
 
-func (m *ProductModel) List(ctx context.Context, inventoryID string, limit, offset int, search string) ([]*Product, error) {
+// List returns the products of an inventory. When categoryID is set, products
+// filed under that category or any of its subcategories are returned.
+func (m *ProductModel) List(ctx context.Context, inventoryID string, limit, offset int, search, categoryID string) ([]*Product, error) {
 	query := `
 		SELECT id, inventory_id, canonical_product_id, brand, name, description, category_id, created_at, deleted_at
 		FROM products
@@ -83,6 +99,11 @@ func (m *ProductModel) List(ctx context.Context, inventoryID string, limit, offs
 		args = append(args, "%"+search+"%")
 		argCount++
 	}
+	if categoryID != "" {
+		query += fmt.Sprintf(" AND category_id IN %s", categorySubtree(argCount))
+		args = append(args, categoryID)
+		argCount++
+	}
 
 	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argCount, argCount+1)
 	args = append(args, limit, offset)
@@ -106,25 +127,42 @@ func (m *ProductModel) List(ctx context.Context, inventoryID string, limit, offs
 	return products, rows.Err()
 }
 
+const variantSelect = `
+	SELECT id, product_id, inventory_id, variant_name, sku, gtin, unit, size, deleted_at
+	FROM product_variants
+`
+
+func scanVariant(scanner interface{ Scan(...any) error }) (*ProductVariant, error) {
+	var v ProductVariant
+	err := scanner.Scan(
+		&v.ID, &v.ProductID, &v.InventoryID, &v.VariantName, &v.SKU, &v.GTIN, &v.Unit, &v.Size, &v.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// CreateVariant adds a variant to a product. The variant belongs to the
+// product's inventory.
 func (m *ProductModel) CreateVariant(ctx context.Context, dbtx database.DBTX, variant *ProductVariant) error {
 	query := `
-		INSERT INTO product_variants (product_id, variant_name, sku, unit, size)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
+		INSERT INTO product_variants (product_id, inventory_id, variant_name, sku, gtin, unit, size)
+		VALUES ($1, (SELECT inventory_id FROM products WHERE id = $1), $2, $3, $4, $5, $6)
+		RETURNING id, inventory_id
 	`
 	return dbtx.QueryRowContext(ctx, query,
 		variant.ProductID,
 		variant.VariantName,
 		variant.SKU,
+		variant.GTIN,
 		variant.Unit,
 		variant.Size,
-	).Scan(&variant.ID)
+	).Scan(&variant.ID, &variant.InventoryID)
 }
 
 func (m *ProductModel) ListVariants(ctx context.Context, productID string) ([]*ProductVariant, error) {
-	query := `
-		SELECT id, product_id, variant_name, sku, unit, size, deleted_at
-		FROM product_variants
+	query := variantSelect + `
 		WHERE product_id = $1 AND deleted_at IS NULL
 		ORDER BY variant_name ASC
 	`
@@ -136,13 +174,11 @@ func (m *ProductModel) ListVariants(ctx context.Context, productID string) ([]*P
 
 	variants := []*ProductVariant{}
 	for rows.Next() {
-		var v ProductVariant
-		if err := rows.Scan(
-			&v.ID, &v.ProductID, &v.VariantName, &v.SKU, &v.Unit, &v.Size, &v.DeletedAt,
-		); err != nil {
+		v, err := scanVariant(rows)
+		if err != nil {
 			return nil, err
 		}
-		variants = append(variants, &v)
+		variants = append(variants, v)
 	}
 	return variants, rows.Err()
 }
@@ -150,10 +186,11 @@ func (m *ProductModel) ListVariants(ctx context.Context, productID string) ([]*P
 func (m *ProductModel) Update(ctx context.Context, dbtx database.DBTX, product *Product) error {
 	query := `
 		UPDATE products
-		SET brand = $1, name = $2, description = $3, category_id = $4
-		WHERE id = $5 AND deleted_at IS NULL
+		SET canonical_product_id = $1, brand = $2, name = $3, description = $4, category_id = $5
+		WHERE id = $6 AND deleted_at IS NULL
 	`
 	result, err := dbtx.ExecContext(ctx, query,
+		product.CanonicalProductID,
 		product.Brand,
 		product.Name,
 		product.Description,
@@ -174,24 +211,154 @@ func (m *ProductModel) Update(ctx context.Context, dbtx database.DBTX, product *
 }
 
 func (m *ProductModel) GetVariant(ctx context.Context, id string) (*ProductVariant, error) {
-	query := `
-		SELECT id, product_id, variant_name, sku, unit, size, deleted_at
-		FROM product_variants
-		WHERE id = $1 AND deleted_at IS NULL
-	`
-	var v ProductVariant
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&v.ID, &v.ProductID, &v.VariantName, &v.SKU, &v.Unit, &v.Size, &v.DeletedAt,
-	)
+	v, err := scanVariant(m.DB.QueryRowContext(ctx, variantSelect+` WHERE id = $1 AND deleted_at IS NULL`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &v, nil
+	return v, nil
+}
+
+// FindVariantsByCode returns the variants of an inventory whose SKU matches
+// code, ignoring case, or whose GTIN matches gtinKey, the code padded to 14
+// digits. Each variant comes with its product.
+func (m *ProductModel) FindVariantsByCode(ctx context.Context, inventoryID, code, gtinKey string) ([]*ProductVariant, error) {
+	query := `
+		SELECT pv.id, pv.product_id, pv.inventory_id, pv.variant_name, pv.sku, pv.gtin, pv.unit, pv.size, pv.deleted_at,
+			p.id, p.inventory_id, p.canonical_product_id, p.brand, p.name, p.description, p.category_id, p.created_at, p.deleted_at
+		FROM product_variants pv
+		JOIN products p ON p.id = pv.product_id
+		WHERE pv.inventory_id = $1 AND pv.deleted_at IS NULL AND p.deleted_at IS NULL
+			AND (LOWER(pv.sku) = LOWER($2) OR ($3 <> '' AND LPAD(pv.gtin, 14, '0') = $3))
+		ORDER BY p.name ASC, pv.variant_name ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, query, inventoryID, code, gtinKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []*ProductVariant{}
+	for rows.Next() {
+		var v ProductVariant
+		var p Product
+		if err := rows.Scan(
+			&v.ID, &v.ProductID, &v.InventoryID, &v.VariantName, &v.SKU, &v.GTIN, &v.Unit, &v.Size, &v.DeletedAt,
+			&p.ID, &p.InventoryID, &p.CanonicalProductID, &p.Brand, &p.Name, &p.Description, &p.CategoryID, &p.CreatedAt, &p.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		v.Product = &p
+		variants = append(variants, &v)
+	}
+	return variants, rows.Err()
+}
+
+// VariantCodesTaken reports whether another live variant of an inventory,
+// other than excludeID, already uses sku or a GTIN with gtinKey. Empty codes
+// are never taken.
+func (m *ProductModel) VariantCodesTaken(ctx context.Context, dbtx database.DBTX, inventoryID, excludeID, sku, gtinKey string) (skuTaken, gtinTaken bool, err error) {
+	query := `
+		SELECT
+			$3 <> '' AND EXISTS (
+				SELECT 1 FROM product_variants
+				WHERE inventory_id = $1 AND id::text <> $2 AND deleted_at IS NULL AND LOWER(sku) = LOWER($3)
+			),
+			$4 <> '' AND EXISTS (
+				SELECT 1 FROM product_variants
+				WHERE inventory_id = $1 AND id::text <> $2 AND deleted_at IS NULL AND LPAD(gtin, 14, '0') = $4
+			)
+	`
+	err = dbtx.QueryRowContext(ctx, query, inventoryID, excludeID, sku, gtinKey).Scan(&skuTaken, &gtinTaken)
+	return skuTaken, gtinTaken, err
+}
+
+func (m *ProductModel) UpdateVariant(ctx context.Context, dbtx database.DBTX, variant *ProductVariant) error {
+	query := `
+		UPDATE product_variants
+		SET variant_name = $1, sku = $2, gtin = $3, unit = $4, size = $5
+		WHERE id = $6 AND deleted_at IS NULL
+	`
+	result, err := dbtx.ExecContext(ctx, query,
+		variant.VariantName,
+		variant.SKU,
+		variant.GTIN,
+		variant.Unit,
+		variant.Size,
+		variant.ID,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
+// GetVariantUsage works out what still refers to a variant. Shopping list
+// items are open until something has been bought against them.
+func (m *ProductModel) GetVariantUsage(ctx context.Context, dbtx database.DBTX, id string) (*VariantUsage, error) {
+	query := `
+		SELECT
+			COALESCE((
+				SELECT SUM(quantity) FROM inventory_products
+				WHERE product_variant_id = $1 AND deleted_at IS NULL
+			), 0),
+			(
+				SELECT COUNT(*) FROM shopping_list_items sli
+				JOIN shopping_lists sl ON sl.id = sli.shopping_list_id
+				WHERE sli.target_type = 'product_variant' AND sli.target_id = $1
+					AND sli.deleted_at IS NULL AND sl.deleted_at IS NULL
+					AND NOT EXISTS (
+						SELECT 1 FROM transaction_items ti
+						JOIN transactions t ON t.id = ti.transaction_id
+						WHERE ti.shopping_list_item_id = sli.id
+							AND ti.deleted_at IS NULL AND t.deleted_at IS NULL
+					)
+			),
+			(
+				SELECT COUNT(*) FROM transaction_items ti
+				JOIN transactions t ON t.id = ti.transaction_id
+				WHERE ti.product_variant_id = $1
+					AND ti.deleted_at IS NULL AND t.deleted_at IS NULL
+			)
+	`
+	var usage VariantUsage
+	err := dbtx.QueryRowContext(ctx, query, id).Scan(&usage.StockQuantity, &usage.OpenShoppingItems, &usage.TransactionItems)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (m *ProductModel) DeleteVariant(ctx context.Context, dbtx database.DBTX, id string) error {
+	query := `
+		UPDATE product_variants
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	result, err := dbtx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete soft deletes a product and its variants.
 func (m *ProductModel) Delete(ctx context.Context, dbtx database.DBTX, id string) error {
 	query := `
 		UPDATE products
@@ -209,5 +376,11 @@ func (m *ProductModel) Delete(ctx context.Context, dbtx database.DBTX, id string
 	if rows == 0 {
 		return sql.ErrNoRows
 	}
-	return nil
+
+	_, err = dbtx.ExecContext(ctx, `
+		UPDATE product_variants
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE product_id = $1 AND deleted_at IS NULL
+	`, id)
+	return err
 }
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// Session is one refresh token in a login's family of rotated tokens. A
+// family is what users see as a session, so it is exposed as the ID.
+type Session struct {
+	ID               string     `json:"-"`
+	FamilyID         string     `json:"id"`
+	UserID           string     `json:"-"`
+	RefreshTokenHash string     `json:"-"`
+	UserAgent        *string    `json:"user_agent,omitempty"`
+	IPAddress        *string    `json:"ip_address,omitempty"`
+	AuthenticatedAt  time.Time  `json:"authenticated_at"`
+	CreatedAt        time.Time  `json:"last_refreshed_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RotatedAt        *time.Time `json:"-"`
+	RevokedAt        *time.Time `json:"-"`
+
+	// Current is set when listing for the session making the request.
+	Current bool `json:"current"`
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+const sessionSelect = `
+		SELECT id, family_id, user_id, refresh_token_hash, user_agent, ip_address, authenticated_at, created_at, expires_at, rotated_at, revoked_at
+		FROM sessions
+`
+
+func scanSession(scanner interface{ Scan(...any) error }) (*Session, error) {
+	var s Session
+	err := scanner.Scan(
+		&s.ID, &s.FamilyID, &s.UserID, &s.RefreshTokenHash, &s.UserAgent, &s.IPAddress, &s.AuthenticatedAt, &s.CreatedAt, &s.ExpiresAt, &s.RotatedAt, &s.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Create stores a session row. A new family is started when FamilyID is
+// empty.
+func (m *SessionModel) Create(ctx context.Context, dbtx database.DBTX, s *Session) error {
+	query := `
+		INSERT INTO sessions (family_id, user_id, refresh_token_hash, user_agent, ip_address, authenticated_at, expires_at)
+		VALUES (COALESCE(NULLIF($1, '')::uuid, uuid_generate_v4()), $2, $3, $4, $5, $6, $7)
+		RETURNING id, family_id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query,
+		s.FamilyID, s.UserID, s.RefreshTokenHash, s.UserAgent, s.IPAddress, s.AuthenticatedAt, s.ExpiresAt,
+	).Scan(&s.ID, &s.FamilyID, &s.CreatedAt)
+}
+
+// GetByTokenHashForUpdate fetches the session a refresh token belongs to and
+// locks it until the transaction ends.
+func (m *SessionModel) GetByTokenHashForUpdate(ctx context.Context, dbtx database.DBTX, hash string) (*Session, error) {
+	return scanSession(dbtx.QueryRowContext(ctx, sessionSelect+` WHERE refresh_token_hash = $1 FOR UPDATE`, hash))
+}
+
+// MarkRotated records that a session's refresh token has been exchanged for
+// a newer one.
+func (m *SessionModel) MarkRotated(ctx context.Context, dbtx database.DBTX, id string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE sessions SET rotated_at = $1 WHERE id = $2`, now, id)
+	return err
+}
+
+// RevokeFamily revokes every token in a session family.
+func (m *SessionModel) RevokeFamily(ctx context.Context, dbtx database.DBTX, familyID string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE sessions SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`, now, familyID)
+	return err
+}
+
+// RevokeUserFamily revokes a session family belonging to a user. It returns
+// sql.ErrNoRows when the user has no live session with that ID.
+func (m *SessionModel) RevokeUserFamily(ctx context.Context, dbtx database.DBTX, userID, familyID string, now time.Time) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE family_id::text = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+	result, err := dbtx.ExecContext(ctx, query, now, familyID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every session of a user, optionally keeping one
+// family alive.
+func (m *SessionModel) RevokeAllForUser(ctx context.Context, dbtx database.DBTX, userID, exceptFamilyID string, now time.Time) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL AND ($3 = '' OR family_id::text <> $3)
+	`
+	_, err := dbtx.ExecContext(ctx, query, now, userID, exceptFamilyID)
+	return err
+}
+
+// IsActive reports whether a session family still has a live refresh token.
+func (m *SessionModel) IsActive(ctx context.Context, userID, familyID string, now time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE family_id = $1 AND user_id = $2
+				AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > $3
+		)
+	`
+	var active bool
+	err := m.DB.QueryRowContext(ctx, query, familyID, userID, now).Scan(&active)
+	return active, err
+}
+
+// GetActive returns the live token of a user's session family, or
+// sql.ErrNoRows when the session has ended.
+func (m *SessionModel) GetActive(ctx context.Context, userID, familyID string, now time.Time) (*Session, error) {
+	query := sessionSelect + `
+		WHERE family_id = $1 AND user_id = $2
+			AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > $3
+	`
+	return scanSession(m.DB.QueryRowContext(ctx, query, familyID, userID, now))
+}
+
+// ListActive returns the newest token of each live session family of a user,
+// most recently refreshed first.
+func (m *SessionModel) ListActive(ctx context.Context, userID string, now time.Time) ([]*Session, error) {
+	query := sessionSelect + `
+		WHERE user_id = $1 AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC
+	`
+	rows, err := m.DB.QueryContext(ctx, query, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
@@ -16,6 +16,18 @@ type ShoppingList struct {
 	CreatedAt     time.Time  `json:"created_at"`
 	LastUpdatedAt time.Time  `json:"last_updated_at"`
 	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+
+	// Derived from the list's items and the purchases linked to them
+	Progress *ShoppingListProgress `json:"progress,omitempty"`
+}
+
+// ShoppingListProgress counts a list's items by fulfilment status.
+type ShoppingListProgress struct {
+	Total              int `json:"total"`
+	Open               int `json:"open"`
+	PartiallyFulfilled int `json:"partially_fulfilled"`
+	Fulfilled          int `json:"fulfilled"`
+	Substituted        int `json:"substituted"`
 }
 
 type ShoppingListItem struct {
@@ -23,6 +35,8 @@ type ShoppingListItem struct {
 	ShoppingListID    string     `json:"shopping_list_id"`
 	TargetType        string     `json:"target_type"` // 'canonical_product' or 'product_variant'
 	TargetID          string     `json:"target_id"`
+	Quantity          *float64   `json:"quantity,omitempty"`
+	Unit              *string    `json:"unit,omitempty"`
 	PreferredOutletID *string    `json:"preferred_outlet_id,omitempty"`
 	Notes             *string    `json:"notes,omitempty"`
 	CreatedAt         time.Time  `json:"created_at"`
@@ -32,6 +46,26 @@ type ShoppingListItem struct {
 	CanonicalProduct *CanonicalProduct `json:"canonical_product,omitempty"`
 	ProductVariant   *ProductVariant   `json:"product_variant,omitempty"`
 	PreferredOutlet  *Outlet           `json:"preferred_outlet,omitempty"`
+
+	// Derived from transaction items linked to this item
+	Status             string   `json:"status"`
+	TransactionItemIDs []string `json:"transaction_item_ids"`
+	PurchasedQuantity  float64  `json:"purchased_quantity"`
+	PurchasedOutletID  *string  `json:"purchased_outlet_id,omitempty"`
+}
+
+// ShoppingListPurchase is a transaction item bought against a shopping list
+// item, with the details needed to judge whether it fulfils the item.
+type ShoppingListPurchase struct {
+	TransactionItemID  string
+	ShoppingListItemID string
+	ProductVariantID   string
+	CanonicalProductID *string
+	Quantity           float64
+	Size               *float64
+	Unit               *string
+	OutletID           *string
+	TransactionDate    time.Time
 }
 
 type ShoppingListRepository interface {
@@ -129,25 +163,25 @@ func (m *ShoppingListModel) DeleteList(ctx context.Context, id string) error {
 
 func (m *ShoppingListModel) AddItem(ctx context.Context, item *ShoppingListItem) error {
 	query := `
-		INSERT INTO shopping_list_items (shopping_list_id, target_type, target_id, preferred_outlet_id, notes)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO shopping_list_items (shopping_list_id, target_type, target_id, quantity, unit, preferred_outlet_id, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at
 	`
 	return m.DB.QueryRowContext(ctx, query,
-		item.ShoppingListID, item.TargetType, item.TargetID, item.PreferredOutletID, item.Notes,
+		item.ShoppingListID, item.TargetType, item.TargetID, item.Quantity, item.Unit, item.PreferredOutletID, item.Notes,
 	).Scan(&item.ID, &item.CreatedAt)
 }
 
 func (m *ShoppingListModel) GetItem(ctx context.Context, id string) (*ShoppingListItem, error) {
 	query := `
-		SELECT id, shopping_list_id, target_type, target_id, preferred_outlet_id, notes, created_at, deleted_at
+		SELECT id, shopping_list_id, target_type, target_id, quantity, unit, preferred_outlet_id, notes, created_at, deleted_at
 		FROM shopping_list_items
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 	var item ShoppingListItem
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&item.ID, &item.ShoppingListID, &item.TargetType, &item.TargetID,
-		&item.PreferredOutletID, &item.Notes, &item.CreatedAt, &item.DeletedAt,
+		&item.Quantity, &item.Unit, &item.PreferredOutletID, &item.Notes, &item.CreatedAt, &item.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -155,10 +189,23 @@ func (m *ShoppingListModel) GetItem(ctx context.Context, id string) (*ShoppingLi
 	return &item, nil
 }
 
+// GetItemInventoryID returns the inventory of the list a live item is on.
+func (m *ShoppingListModel) GetItemInventoryID(ctx context.Context, itemID string) (string, error) {
+	query := `
+		SELECT sl.inventory_id
+		FROM shopping_list_items sli
+		JOIN shopping_lists sl ON sl.id = sli.shopping_list_id
+		WHERE sli.id = $1 AND sli.deleted_at IS NULL AND sl.deleted_at IS NULL
+	`
+	var inventoryID string
+	err := m.DB.QueryRowContext(ctx, query, itemID).Scan(&inventoryID)
+	return inventoryID, err
+}
+
 func (m *ShoppingListModel) ListItems(ctx context.Context, listID string) ([]*ShoppingListItem, error) {
 	query := `
 		SELECT 
-			sli.id, sli.shopping_list_id, sli.target_type, sli.target_id, sli.preferred_outlet_id, sli.notes, sli.created_at, sli.deleted_at,
+			sli.id, sli.shopping_list_id, sli.target_type, sli.target_id, sli.quantity, sli.unit, sli.preferred_outlet_id, sli.notes, sli.created_at, sli.deleted_at,
 			cp.id, cp.name, cp.category_id,
 			pv.id, pv.product_id, pv.variant_name, pv.sku, pv.unit, pv.size,
 			p.id, p.name, p.brand,
@@ -195,7 +242,7 @@ func (m *ShoppingListModel) ListItems(ctx context.Context, listID string) ([]*Sh
 		var oName, oAddress *string
 
 		err := rows.Scan(
-			&item.ID, &item.ShoppingListID, &item.TargetType, &item.TargetID, &item.PreferredOutletID, &item.Notes, &item.CreatedAt, &item.DeletedAt,
+			&item.ID, &item.ShoppingListID, &item.TargetType, &item.TargetID, &item.Quantity, &item.Unit, &item.PreferredOutletID, &item.Notes, &item.CreatedAt, &item.DeletedAt,
 			&cpID, &cpName, &cpCategory,
 			&pvID, &pvProdID, &pvName, &pvSku, &pvUnit, &pvSize,
 			&pID, &pName, &pBrand,
@@ -251,10 +298,10 @@ func (m *ShoppingListModel) ListItems(ctx context.Context, listID string) ([]*Sh
 func (m *ShoppingListModel) UpdateItem(ctx context.Context, item *ShoppingListItem) error {
 	query := `
 		UPDATE shopping_list_items
-		SET notes = $1, preferred_outlet_id = $2
-		WHERE id = $3 AND deleted_at IS NULL
+		SET notes = $1, preferred_outlet_id = $2, quantity = $3, unit = $4
+		WHERE id = $5 AND deleted_at IS NULL
 	`
-	_, err := m.DB.ExecContext(ctx, query, item.Notes, item.PreferredOutletID, item.ID)
+	_, err := m.DB.ExecContext(ctx, query, item.Notes, item.PreferredOutletID, item.Quantity, item.Unit, item.ID)
 	return err
 }
 
@@ -267,3 +314,65 @@ func (m *ShoppingListModel) DeleteItem(ctx context.Context, id string) error {
 	_, err := m.DB.ExecContext(ctx, query, id)
 	return err
 }
+
+// ListItemTargets returns the items of the given lists without their joined
+// product details, for working out list progress.
+func (m *ShoppingListModel) ListItemTargets(ctx context.Context, listIDs []string) ([]*ShoppingListItem, error) {
+	query := `
+		SELECT id, shopping_list_id, target_type, target_id, quantity, unit
+		FROM shopping_list_items
+		WHERE shopping_list_id = ANY($1::uuid[]) AND deleted_at IS NULL
+	`
+	rows, err := m.DB.QueryContext(ctx, query, listIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ShoppingListItem{}
+	for rows.Next() {
+		var item ShoppingListItem
+		if err := rows.Scan(&item.ID, &item.ShoppingListID, &item.TargetType, &item.TargetID, &item.Quantity, &item.Unit); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// ListPurchases returns the live transaction items linked to items on the
+// given lists, oldest first. Voided transactions are deleted, and only
+// transactions of the list's own inventory count.
+func (m *ShoppingListModel) ListPurchases(ctx context.Context, listIDs []string) ([]*ShoppingListPurchase, error) {
+	query := `
+		SELECT ti.id, ti.shopping_list_item_id, ti.product_variant_id, p.canonical_product_id,
+			ti.quantity, pv.size, pv.unit, t.outlet_id, t.transaction_date
+		FROM transaction_items ti
+		JOIN shopping_list_items sli ON ti.shopping_list_item_id = sli.id
+		JOIN shopping_lists sl ON sli.shopping_list_id = sl.id
+		JOIN transactions t ON ti.transaction_id = t.id AND t.inventory_id = sl.inventory_id
+		JOIN product_variants pv ON ti.product_variant_id = pv.id
+		JOIN products p ON pv.product_id = p.id
+		WHERE sli.shopping_list_id = ANY($1::uuid[])
+			AND ti.deleted_at IS NULL AND t.deleted_at IS NULL
+		ORDER BY t.transaction_date ASC, ti.id ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, query, listIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purchases := []*ShoppingListPurchase{}
+	for rows.Next() {
+		var p ShoppingListPurchase
+		if err := rows.Scan(
+			&p.TransactionItemID, &p.ShoppingListItemID, &p.ProductVariantID, &p.CanonicalProductID,
+			&p.Quantity, &p.Size, &p.Unit, &p.OutletID, &p.TransactionDate,
+		); err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, &p)
+	}
+	return purchases, rows.Err()
+}
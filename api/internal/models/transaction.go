@@ -130,6 +130,72 @@ func (m *TransactionModel) GetByID(ctx context.Context, id string) (*Transaction
 	return &t, nil
 }
 
+// GetForUpdate fetches a transaction and locks it until the database
+// transaction ends, so concurrent edits cannot reverse it twice.
+func (m *TransactionModel) GetForUpdate(ctx context.Context, dbtx database.DBTX, id string) (*Transaction, error) {
+	query := `
+		SELECT id, inventory_id, outlet_id, created_by_user_id, transaction_date, total_amount, deleted_at
+		FROM transactions
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	var t Transaction
+	err := dbtx.QueryRowContext(ctx, query, id).Scan(
+		&t.ID,
+		&t.InventoryID,
+		&t.OutletID,
+		&t.CreatedByUserID,
+		&t.TransactionDate,
+		&t.TotalAmount,
+		&t.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (m *TransactionModel) Update(ctx context.Context, dbtx database.DBTX, t *Transaction) error {
+	query := `
+		UPDATE transactions
+		SET outlet_id = $1, transaction_date = $2, total_amount = $3
+		WHERE id = $4 AND deleted_at IS NULL
+		RETURNING transaction_date
+	`
+	return dbtx.QueryRowContext(ctx, query, t.OutletID, t.TransactionDate, t.TotalAmount, t.ID).Scan(&t.TransactionDate)
+}
+
+// Delete soft-deletes a transaction along with its items.
+func (m *TransactionModel) Delete(ctx context.Context, dbtx database.DBTX, id string) error {
+	if err := m.DeleteItems(ctx, dbtx, id); err != nil {
+		return err
+	}
+
+	result, err := dbtx.ExecContext(ctx, `UPDATE transactions SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteItems soft-deletes the items of a transaction.
+func (m *TransactionModel) DeleteItems(ctx context.Context, dbtx database.DBTX, transactionID string) error {
+	query := `
+		UPDATE transaction_items
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE transaction_id = $1 AND deleted_at IS NULL
+	`
+	_, err := dbtx.ExecContext(ctx, query, transactionID)
+	return err
+}
+
 func (m *TransactionModel) ListByInventory(ctx context.Context, inventoryID string, limit, offset int) ([]*Transaction, error) {
 	query := `
 		SELECT id, inventory_id, outlet_id, created_by_user_id, transaction_date, total_amount, deleted_at
@@ -166,13 +232,13 @@ func (m *TransactionModel) ListByInventory(ctx context.Context, inventoryID stri
 	return transactions, nil
 }
 
-func (m *TransactionModel) GetItems(ctx context.Context, transactionID string) ([]*TransactionItem, error) {
+func (m *TransactionModel) GetItems(ctx context.Context, dbtx database.DBTX, transactionID string) ([]*TransactionItem, error) {
 	query := `
 		SELECT id, transaction_id, product_variant_id, quantity, price_per_unit, shopping_list_item_id, deleted_at
 		FROM transaction_items
 		WHERE transaction_id = $1 AND deleted_at IS NULL
 	`
-	rows, err := m.DB.QueryContext(ctx, query, transactionID)
+	rows, err := dbtx.QueryContext(ctx, query, transactionID)
 	if err != nil {
 		return nil, err
 	}
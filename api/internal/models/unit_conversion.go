@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// UnitConversion is a product-specific edge in the unit graph, such as the
+// density of a liquid or the typical weight of one piece. One FromUnit is
+// Factor ToUnit, with Confidence saying how reliable that estimate is.
+type UnitConversion struct {
+	ID                 string     `json:"id"`
+	CanonicalProductID string     `json:"canonical_product_id"`
+	FromUnit           string     `json:"from_unit"`
+	ToUnit             string     `json:"to_unit"`
+	Factor             float64    `json:"factor"`
+	Confidence         float64    `json:"confidence"`
+	Note               *string    `json:"note,omitempty"`
+	CreatedByUserID    *string    `json:"created_by_user_id,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	DeletedAt          *time.Time `json:"deleted_at,omitempty"`
+}
+
+type UnitConversionModel struct {
+	DB *sql.DB
+}
+
+func (m *UnitConversionModel) Create(ctx context.Context, dbtx database.DBTX, c *UnitConversion) error {
+	query := `
+		INSERT INTO unit_conversions (
+			canonical_product_id, from_unit, to_unit, factor, confidence, note, created_by_user_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query,
+		c.CanonicalProductID,
+		c.FromUnit,
+		c.ToUnit,
+		c.Factor,
+		c.Confidence,
+		c.Note,
+		c.CreatedByUserID,
+	).Scan(&c.ID, &c.CreatedAt)
+}
+
+func (m *UnitConversionModel) GetByID(ctx context.Context, id string) (*UnitConversion, error) {
+	query := `
+		SELECT id, canonical_product_id, from_unit, to_unit, factor, confidence, note,
+		       created_by_user_id, created_at, deleted_at
+		FROM unit_conversions
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	var c UnitConversion
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&c.ID, &c.CanonicalProductID, &c.FromUnit, &c.ToUnit, &c.Factor, &c.Confidence, &c.Note,
+		&c.CreatedByUserID, &c.CreatedAt, &c.DeletedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *UnitConversionModel) ListByCanonicalProduct(ctx context.Context, canonicalProductID string) ([]*UnitConversion, error) {
+	query := `
+		SELECT id, canonical_product_id, from_unit, to_unit, factor, confidence, note,
+		       created_by_user_id, created_at, deleted_at
+		FROM unit_conversions
+		WHERE canonical_product_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, query, canonicalProductID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversions []*UnitConversion
+	for rows.Next() {
+		var c UnitConversion
+		if err := rows.Scan(
+			&c.ID, &c.CanonicalProductID, &c.FromUnit, &c.ToUnit, &c.Factor, &c.Confidence, &c.Note,
+			&c.CreatedByUserID, &c.CreatedAt, &c.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		conversions = append(conversions, &c)
+	}
+	return conversions, rows.Err()
+}
+
+func (m *UnitConversionModel) Delete(ctx context.Context, dbtx database.DBTX, id string) error {
+	query := `UPDATE unit_conversions SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`
+	result, err := dbtx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
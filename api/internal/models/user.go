@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"time"
+	"ukoni/internal/database"
 )
 
 type User struct {
@@ -13,6 +14,11 @@ type User struct {
 	PasswordHash string     `json:"-"`
 	CreatedAt    time.Time  `json:"created_at"`
 	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	FailedLoginCount int        `json:"-"`
+	LockedUntil      *time.Time `json:"-"`
 }
 
 type UserModel struct {
@@ -20,6 +26,14 @@ type UserModel struct {
 }
 
 func (m *UserModel) Insert(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.InsertTx(ctx, m.DB, user)
+}
+
+// InsertTx creates a user as part of a larger transaction.
+func (m *UserModel) InsertTx(ctx context.Context, dbtx database.DBTX, user *User) error {
 	query := `
 		INSERT INTO users (email, name, password_hash)
 		VALUES ($1, $2, $3)
@@ -27,29 +41,60 @@ func (m *UserModel) Insert(user *User) error {
 
 	args := []interface{}{user.Email, user.Name, user.PasswordHash}
 
+	return dbtx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt)
+}
+
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, email, name, password_hash, created_at, deleted_at, email_verified_at,
+			failed_login_count, locked_until
+		FROM users
+		WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL`
+
+	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt)
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.DeletedAt,
+		&user.EmailVerifiedAt,
+		&user.FailedLoginCount,
+		&user.LockedUntil,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
 }
 
-func (m *UserModel) GetByEmail(email string) (*User, error) {
+func (m *UserModel) GetByID(id string) (*User, error) {
 	query := `
-		SELECT id, email, name, password_hash, created_at, deleted_at
+		SELECT id, email, name, password_hash, created_at, deleted_at, email_verified_at,
+			failed_login_count, locked_until
 		FROM users
-		WHERE email = $1 AND deleted_at IS NULL`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Name,
 		&user.PasswordHash,
 		&user.CreatedAt,
 		&user.DeletedAt,
+		&user.EmailVerifiedAt,
+		&user.FailedLoginCount,
+		&user.LockedUntil,
 	)
 
 	if err != nil {
@@ -58,3 +103,125 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 
 	return &user, nil
 }
+
+// UpdatePassword replaces a user's password hash. Someone able to set the
+// password owns the account, so any login lockout is lifted too.
+func (m *UserModel) UpdatePassword(ctx context.Context, dbtx database.DBTX, id, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL
+		WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := dbtx.ExecContext(ctx, query, passwordHash, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkEmailVerified records that a user proved they own email. Nothing
+// changes if the user's email is no longer that address.
+func (m *UserModel) MarkEmailVerified(ctx context.Context, dbtx database.DBTX, id, email string, now time.Time) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = $1
+		WHERE id = $2 AND LOWER(email) = LOWER($3) AND deleted_at IS NULL`
+
+	result, err := dbtx.ExecContext(ctx, query, now, id, email)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EmailTaken reports whether another live user already has email, compared
+// case-insensitively.
+func (m *UserModel) EmailTaken(ctx context.Context, email, exceptID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM users
+			WHERE LOWER(email) = LOWER($1) AND id::text <> $2 AND deleted_at IS NULL
+		)`
+
+	var taken bool
+	err := m.DB.QueryRowContext(ctx, query, email, exceptID).Scan(&taken)
+	return taken, err
+}
+
+// UpdateProfile saves a user's name and email. Changing the email clears its
+// verification.
+func (m *UserModel) UpdateProfile(ctx context.Context, dbtx database.DBTX, user *User) error {
+	query := `
+		UPDATE users
+		SET name = $1,
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END,
+			email = $2
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING email_verified_at`
+
+	return dbtx.QueryRowContext(ctx, query, user.Name, user.Email, user.ID).Scan(&user.EmailVerifiedAt)
+}
+
+// DeleteAnonymised soft-deletes a user and scrubs their personal details,
+// freeing the email for a new account.
+func (m *UserModel) DeleteAnonymised(ctx context.Context, dbtx database.DBTX, id string, now time.Time) error {
+	query := `
+		UPDATE users
+		SET deleted_at = $1,
+			name = 'Deleted user',
+			email = 'deleted-' || id || '@deleted.invalid',
+			password_hash = '',
+			email_verified_at = NULL
+		WHERE id = $2 AND deleted_at IS NULL`
+
+	_, err := dbtx.ExecContext(ctx, query, now, id)
+	return err
+}
+
+// RecordFailedLogin counts a failed login and returns how many there have
+// been in a row. Failures from before since no longer count.
+func (m *UserModel) RecordFailedLogin(ctx context.Context, dbtx database.DBTX, id string, since, now time.Time) (int, error) {
+	query := `
+		UPDATE users
+		SET failed_login_count = CASE WHEN last_failed_login_at > $2 THEN failed_login_count + 1 ELSE 1 END,
+			last_failed_login_at = $3
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING failed_login_count`
+
+	var failures int
+	err := dbtx.QueryRowContext(ctx, query, id, since, now).Scan(&failures)
+	return failures, err
+}
+
+// LockUntil stops a user logging in before until.
+func (m *UserModel) LockUntil(ctx context.Context, dbtx database.DBTX, id string, until time.Time) error {
+	query := `UPDATE users SET locked_until = $2 WHERE id = $1 AND deleted_at IS NULL`
+
+	_, err := dbtx.ExecContext(ctx, query, id, until)
+	return err
+}
+
+// ClearFailedLogins forgets a user's failed logins after a successful one.
+func (m *UserModel) ClearFailedLogins(ctx context.Context, dbtx database.DBTX, id string) error {
+	query := `
+		UPDATE users
+		SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL
+		WHERE id = $1`
+
+	_, err := dbtx.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"ukoni/internal/database"
+)
+
+// UserIdentity links a user to their account at an OpenID Connect provider.
+type UserIdentity struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"-"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       *string    `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+type UserIdentityModel struct {
+	DB *sql.DB
+}
+
+func (m *UserIdentityModel) Create(ctx context.Context, dbtx database.DBTX, identity *UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return dbtx.QueryRowContext(ctx, query,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.LastLoginAt,
+	).Scan(&identity.ID, &identity.CreatedAt)
+}
+
+// GetByProviderSubject finds the identity a provider account is linked to.
+func (m *UserIdentityModel) GetByProviderSubject(ctx context.Context, dbtx database.DBTX, provider, subject string) (*UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+	var i UserIdentity
+	err := dbtx.QueryRowContext(ctx, query, provider, subject).Scan(
+		&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// MarkUsed records a login through an identity and the email the provider
+// now reports for it.
+func (m *UserIdentityModel) MarkUsed(ctx context.Context, dbtx database.DBTX, id string, email *string, now time.Time) error {
+	_, err := dbtx.ExecContext(ctx, `UPDATE user_identities SET last_login_at = $1, email = $2 WHERE id = $3`, now, email, id)
+	return err
+}
+
+// DeleteAllForUser unlinks every provider account from a user.
+func (m *UserIdentityModel) DeleteAllForUser(ctx context.Context, dbtx database.DBTX, userID string) error {
+	_, err := dbtx.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = $1`, userID)
+	return err
+}
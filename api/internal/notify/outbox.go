@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"ukoni/internal/database"
+	"ukoni/internal/models"
+)
+
+const (
+	defaultMaxAttempts = 8
+	defaultBatchSize   = 20
+	maxRetryDelay      = time.Hour
+)
+
+// Outbox queues rendered emails alongside the writes that caused them and
+// delivers them once committed, retrying failures with exponential backoff.
+type Outbox struct {
+	Model  *models.EmailOutboxModel
+	Mailer Mailer
+	Links  Links
+	Logger *slog.Logger
+
+	// MaxAttempts is how many sends are tried before an email is marked
+	// failed. Zero means defaultMaxAttempts.
+	MaxAttempts int
+}
+
+// Enqueue renders an email and queues it in dbtx, so it is only sent if the
+// surrounding transaction commits.
+func (o *Outbox) Enqueue(ctx context.Context, dbtx database.DBTX, to string, email Email) error {
+	subject, body, err := Render(email)
+	if err != nil {
+		return err
+	}
+
+	return o.Model.Enqueue(ctx, dbtx, &models.OutboxEmail{
+		Recipient: to,
+		Template:  email.TemplateName(),
+		Subject:   subject,
+		Body:      body,
+	})
+}
+
+// Flush sends every email that is due and returns how many were sent.
+func (o *Outbox) Flush(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		n, claimed, err := o.flushBatch(ctx)
+		sent += n
+		if err != nil || claimed < defaultBatchSize {
+			return sent, err
+		}
+	}
+}
+
+func (o *Outbox) flushBatch(ctx context.Context) (sent, claimed int, err error) {
+	tx, err := o.Model.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	emails, err := o.Model.ClaimDue(ctx, tx, now, defaultBatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, email := range emails {
+		sendErr := o.Mailer.Send(ctx, Message{To: email.Recipient, Subject: email.Subject, Body: email.Body})
+		if sendErr == nil {
+			if err := o.Model.MarkSent(ctx, tx, email.ID, time.Now()); err != nil {
+				return 0, 0, err
+			}
+			sent++
+			continue
+		}
+
+		attempts := email.Attempts + 1
+		var next *time.Time
+		if attempts < o.maxAttempts() {
+			retryAt := now.Add(retryDelay(attempts))
+			next = &retryAt
+		}
+		if err := o.Model.MarkFailed(ctx, tx, email.ID, sendErr.Error(), next); err != nil {
+			return 0, 0, err
+		}
+		if o.Logger != nil {
+			o.Logger.Warn("email send failed", "id", email.ID, "template", email.Template, "attempts", attempts, "error", sendErr)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return sent, len(emails), nil
+}
+
+// Run flushes the outbox every interval until ctx is done.
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := o.Flush(ctx); err != nil && o.Logger != nil {
+				o.Logger.Error("email outbox flush failed", "error", err)
+			}
+		}
+	}
+}
+
+func (o *Outbox) maxAttempts() int {
+	if o.MaxAttempts > 0 {
+		return o.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// retryDelay doubles from a minute with each failed attempt, up to an hour.
+func retryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Email is the data for one of the message templates.
+type Email interface {
+	TemplateName() string
+}
+
+// InvitationEmail invites someone to join an inventory.
+type InvitationEmail struct {
+	InventoryName string
+	InviterName   string
+	Role          string
+	AcceptURL     string
+	ExpiresAt     *time.Time
+}
+
+func (InvitationEmail) TemplateName() string { return "invitation" }
+
+// PasswordResetEmail carries a link for choosing a new password.
+type PasswordResetEmail struct {
+	Name      string
+	ResetURL  string
+	ExpiresAt time.Time
+}
+
+func (PasswordResetEmail) TemplateName() string { return "password_reset" }
+
+// EmailVerificationEmail asks a user to confirm they own an address.
+type EmailVerificationEmail struct {
+	Name      string
+	VerifyURL string
+	ExpiresAt time.Time
+}
+
+func (EmailVerificationEmail) TemplateName() string { return "email_verification" }
+
+// LowStockDigestEmail summarises the items running low in an inventory.
+type LowStockDigestEmail struct {
+	Name          string
+	InventoryName string
+	Items         []LowStockItem
+}
+
+type LowStockItem struct {
+	Name     string
+	Quantity float64
+	Unit     string
+}
+
+func (LowStockDigestEmail) TemplateName() string { return "low_stock_digest" }
+
+// Each template defines a "subject" and a "body".
+var templates = map[string]*template.Template{
+	"invitation": mustParse("invitation", `
+{{- define "subject"}}{{.InviterName}} invited you to {{.InventoryName}} on Ukoni{{end}}
+{{- define "body"}}Hi,
+
+{{.InviterName}} has invited you to join "{{.InventoryName}}" on Ukoni as {{article .Role}} {{.Role}}.
+
+Accept the invitation here:
+{{.AcceptURL}}
+{{if .ExpiresAt}}
+This invitation expires on {{date .ExpiresAt}}.
+{{end}}
+If you weren't expecting this, you can ignore this email.
+{{end}}`),
+
+	"password_reset": mustParse("password_reset", `
+{{- define "subject"}}Reset your Ukoni password{{end}}
+{{- define "body"}}Hi {{.Name}},
+
+Someone asked to reset the password for your Ukoni account. Choose a new one here:
+{{.ResetURL}}
+
+The link expires on {{date .ExpiresAt}}. If you didn't ask for this, you can ignore this email and your password will stay the same.
+{{end}}`),
+
+	"email_verification": mustParse("email_verification", `
+{{- define "subject"}}Confirm your email for Ukoni{{end}}
+{{- define "body"}}Hi {{.Name}},
+
+Please confirm this is your email address by opening this link:
+{{.VerifyURL}}
+
+The link expires on {{date .ExpiresAt}}. If you didn't sign up for Ukoni, you can ignore this email.
+{{end}}`),
+
+	"low_stock_digest": mustParse("low_stock_digest", `
+{{- define "subject"}}Running low in {{.InventoryName}}{{end}}
+{{- define "body"}}Hi {{.Name}},
+
+These items are running low in "{{.InventoryName}}":
+{{range .Items}}
+  - {{.Name}}: {{quantity .Quantity}}{{if .Unit}} {{.Unit}}{{end}}
+{{- end}}
+{{end}}`),
+}
+
+var templateFuncs = template.FuncMap{
+	"date": func(t any) string {
+		switch v := t.(type) {
+		case time.Time:
+			return v.UTC().Format("2 January 2006 15:04 MST")
+		case *time.Time:
+			return v.UTC().Format("2 January 2006 15:04 MST")
+		}
+		return ""
+	},
+	"quantity": func(q float64) string {
+		return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", q), "0"), ".")
+	},
+	"article": func(word string) string {
+		if word != "" && strings.ContainsRune("aeiouAEIOU", rune(word[0])) {
+			return "an"
+		}
+		return "a"
+	},
+}
+
+func mustParse(name, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(templateFuncs).Parse(text))
+}
+
+// Render fills in the subject and body of an email's template.
+func Render(email Email) (subject, body string, err error) {
+	tmpl, ok := templates[email.TemplateName()]
+	if !ok {
+		return "", "", fmt.Errorf("notify: unknown template %q", email.TemplateName())
+	}
+
+	var s, b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&s, "subject", email); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.ExecuteTemplate(&b, "body", email); err != nil {
+		return "", "", err
+	}
+	return s.String(), b.String(), nil
+}
+
+// Links builds the web app URLs that emails point to.
+type Links struct {
+	BaseURL string
+}
+
+func (l Links) AcceptInvitation(token string) string {
+	return l.url("/invitations/accept", token)
+}
+
+func (l Links) ResetPassword(token string) string {
+	return l.url("/reset-password", token)
+}
+
+func (l Links) VerifyEmail(token string) string {
+	return l.url("/verify-email", token)
+}
+
+func (l Links) url(path, token string) string {
+	return strings.TrimRight(l.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
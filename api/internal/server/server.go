@@ -15,6 +15,8 @@ import (
 	"ukoni/internal/handlers"
 	"ukoni/internal/middleware"
 	"ukoni/internal/models"
+	"ukoni/internal/notify"
+	"ukoni/internal/oidc"
 	"ukoni/internal/services"
 )
 
@@ -22,13 +24,18 @@ type Server struct {
 	Config *config.Config
 	DB     database.Service
 	Logger *slog.Logger
+
+	// RateLimitStore holds rate limit state. It defaults to memory, which
+	// limits each instance separately.
+	RateLimitStore middleware.RateLimitStore
 }
 
 func New(cfg *config.Config, db database.Service, logger *slog.Logger) *Server {
 	return &Server{
-		Config: cfg,
-		DB:     db,
-		Logger: logger,
+		Config:         cfg,
+		DB:             db,
+		Logger:         logger,
+		RateLimitStore: middleware.NewMemoryRateLimitStore(),
 	}
 }
 
@@ -45,39 +52,125 @@ func (s *Server) SetupRouter() *http.ServeMux {
 	shoppingListModel := &models.ShoppingListModel{DB: s.DB.GetDB()}
 	transactionModel := &models.TransactionModel{DB: s.DB.GetDB()}
 	inventoryProductModel := &models.InventoryProductModel{DB: s.DB.GetDB()}
+	inventoryAdjustmentModel := &models.InventoryAdjustmentModel{DB: s.DB.GetDB()}
 	consumptionModel := &models.ConsumptionModel{DB: s.DB.GetDB()}
+	unitConversionModel := &models.UnitConversionModel{DB: s.DB.GetDB()}
+	categoryModel := &models.CategoryModel{DB: s.DB.GetDB()}
+	emailOutboxModel := &models.EmailOutboxModel{DB: s.DB.GetDB()}
+	sessionModel := &models.SessionModel{DB: s.DB.GetDB()}
+	passwordResetModel := &models.PasswordResetModel{DB: s.DB.GetDB()}
+	emailVerificationModel := &models.EmailVerificationModel{DB: s.DB.GetDB()}
+	apiKeyModel := &models.APIKeyModel{DB: s.DB.GetDB()}
+	identityModel := &models.UserIdentityModel{DB: s.DB.GetDB()}
+	oidcLoginModel := &models.OIDCLoginModel{DB: s.DB.GetDB()}
+	inventoryTransferModel := &models.InventoryTransferModel{DB: s.DB.GetDB()}
+
+	outbox := &notify.Outbox{
+		Model: emailOutboxModel,
+		Links: notify.Links{BaseURL: s.Config.AppBaseURL},
+	}
 
 	// Initialize services
-	authService := &services.AuthService{
-		UserModel: userModel,
-		JWTSecret: s.Config.JWTSecret,
+	authorizer := &services.Authorizer{
+		InventoryModel:  inventoryModel,
+		MembershipModel: membershipModel,
 	}
 
 	activityLogService := &services.ActivityLogService{
-		Model: activityLogModel,
+		Model:        activityLogModel,
+		ProductModel: productModel,
+		Authorizer:   authorizer,
 	}
 
 	inventoryService := &services.InventoryService{
-		DB:                 s.DB.GetDB(),
+		DB:                   s.DB.GetDB(),
+		InventoryModel:       inventoryModel,
+		MembershipModel:      membershipModel,
+		UserModel:            userModel,
+		TransferModel:        inventoryTransferModel,
+		Authorizer:           authorizer,
+		ActivityLogService:   activityLogService,
+		RequireVerifiedEmail: s.Config.RequireVerifiedEmail,
+	}
+
+	membershipService := &services.MembershipService{
+		MembershipModel:      membershipModel,
+		InventoryModel:       inventoryModel,
+		UserModel:            userModel,
+		Authorizer:           authorizer,
+		ActivityLogService:   activityLogService,
+		Outbox:               outbox,
+		RequireVerifiedEmail: s.Config.RequireVerifiedEmail,
+	}
+
+	authService := &services.AuthService{
+		UserModel:              userModel,
+		SessionModel:           sessionModel,
+		PasswordResetModel:     passwordResetModel,
+		EmailVerificationModel: emailVerificationModel,
+		MembershipService:      membershipService,
+		ActivityLogService:     activityLogService,
+		Outbox:                 outbox,
+		JWTSecret:              s.Config.JWTSecret,
+		AccessTokenTTL:         s.Config.AccessTokenTTL,
+		RefreshTokenTTL:        s.Config.RefreshTokenTTL,
+		LoginLockoutThreshold:  s.Config.LoginLockoutThreshold,
+		LoginLockoutBase:       s.Config.LoginLockoutBase,
+	}
+
+	userService := &services.UserService{
+		UserModel:          userModel,
 		InventoryModel:     inventoryModel,
 		MembershipModel:    membershipModel,
+		SessionModel:       sessionModel,
+		APIKeyModel:        apiKeyModel,
+		IdentityModel:      identityModel,
+		ActivityLogModel:   activityLogModel,
+		TransferModel:      inventoryTransferModel,
+		AuthService:        authService,
 		ActivityLogService: activityLogService,
 	}
 
-	membershipService := &services.MembershipService{
-		MembershipModel:    membershipModel,
-		InventoryModel:     inventoryModel,
+	oidcProviders := make(map[string]*oidc.Provider)
+	for _, provider := range s.Config.OIDCProviders {
+		oidcProviders[provider.Name] = oidc.NewProvider(provider)
+	}
+	oidcService := &services.OIDCService{
+		Providers:          oidcProviders,
+		UserModel:          userModel,
+		IdentityModel:      identityModel,
+		LoginModel:         oidcLoginModel,
+		AuthService:        authService,
+		ActivityLogService: activityLogService,
+	}
+
+	apiKeyService := &services.APIKeyService{
+		Model:              apiKeyModel,
+		Authorizer:         authorizer,
+		ActivityLogService: activityLogService,
+	}
+
+	categoryService := &services.CategoryService{
+		DB:                 s.DB.GetDB(),
+		CategoryModel:      categoryModel,
+		Authorizer:         authorizer,
 		ActivityLogService: activityLogService,
 	}
 
 	productService := &services.ProductService{
-		DB:           s.DB.GetDB(),
-		ProductModel: productModel,
+		DB:                    s.DB.GetDB(),
+		ProductModel:          productModel,
+		CanonicalProductModel: canonicalProductModel,
+		CategoryService:       categoryService,
+		Authorizer:            authorizer,
+		ActivityLogService:    activityLogService,
 	}
 
 	canonicalProductService := &services.CanonicalProductService{
 		DB:                    s.DB.GetDB(),
 		CanonicalProductModel: canonicalProductModel,
+		CategoryService:       categoryService,
+		Authorizer:            authorizer,
 	}
 
 	sellerService := &services.SellerService{
@@ -90,68 +183,127 @@ func (s *Server) SetupRouter() *http.ServeMux {
 		OutletModel: outletModel,
 	}
 
+	unitService := &services.UnitService{
+		DB:                    s.DB.GetDB(),
+		UnitConversionModel:   unitConversionModel,
+		CanonicalProductModel: canonicalProductModel,
+		Authorizer:            authorizer,
+		ActivityLogService:    activityLogService,
+	}
+
 	shoppingListService := &services.ShoppingListService{
 		ShoppingListModel:  shoppingListModel,
-		InventoryModel:     inventoryModel,
-		MembershipModel:    membershipModel,
+		ProductModel:       productModel,
+		UnitService:        unitService,
+		Authorizer:         authorizer,
 		ActivityLogService: activityLogService,
 	}
 
 	inventoryProductService := &services.InventoryProductService{
-		InventoryProductModel: inventoryProductModel,
-		ProductModel:          productModel,
+		DB:                       s.DB.GetDB(),
+		InventoryProductModel:    inventoryProductModel,
+		InventoryAdjustmentModel: inventoryAdjustmentModel,
+		ProductModel:             productModel,
+		CanonicalProductModel:    canonicalProductModel,
+		UnitService:              unitService,
+		Authorizer:               authorizer,
+		ActivityLogService:       activityLogService,
 	}
 
 	transactionService := &services.TransactionService{
 		DB:                      s.DB.GetDB(),
 		TransactionModel:        transactionModel,
-		MembershipModel:         membershipModel,
+		Authorizer:              authorizer,
 		OutletModel:             outletModel,
+		ProductModel:            productModel,
+		ShoppingListModel:       shoppingListModel,
 		ActivityLogService:      activityLogService,
 		InventoryProductService: inventoryProductService,
 	}
 
 	consumptionService := &services.ConsumptionService{
-		DB:                 s.DB.GetDB(),
-		ConsumptionModel:   consumptionModel,
-		MembershipModel:    membershipModel,
-		ActivityLogService: activityLogService,
+		DB:                      s.DB.GetDB(),
+		ConsumptionModel:        consumptionModel,
+		Authorizer:              authorizer,
+		ActivityLogService:      activityLogService,
+		InventoryProductService: inventoryProductService,
 	}
 
 	// Initialize handlers
 	authHandler := &handlers.AuthHandler{Service: authService}
+	userHandler := &handlers.UserHandler{Service: userService}
+	apiKeyHandler := &handlers.APIKeyHandler{Service: apiKeyService}
+	oidcHandler := &handlers.OIDCHandler{Service: oidcService}
 	inventoryHandler := &handlers.InventoryHandler{Service: inventoryService}
 	membershipHandler := &handlers.MembershipHandler{Service: membershipService}
-	productHandler := &handlers.ProductHandler{
-		Service:           productService,
-		MembershipService: membershipService,
-	}
-	canonicalProductHandler := &handlers.CanonicalProductHandler{
-		Service:           canonicalProductService,
-		MembershipService: membershipService,
-	}
+	productHandler := &handlers.ProductHandler{Service: productService}
+	canonicalProductHandler := &handlers.CanonicalProductHandler{Service: canonicalProductService}
 	sellerHandler := &handlers.SellerHandler{Service: sellerService}
 	outletHandler := &handlers.OutletHandler{Service: outletService}
 	shoppingListHandler := &handlers.ShoppingListHandler{Service: shoppingListService}
 	transactionHandler := &handlers.TransactionHandler{Service: transactionService}
 	consumptionHandler := &handlers.ConsumptionHandler{Service: consumptionService}
+	inventoryProductHandler := &handlers.InventoryProductHandler{Service: inventoryProductService}
+	unitHandler := &handlers.UnitHandler{Service: unitService}
+	categoryHandler := &handlers.CategoryHandler{Service: categoryService}
+	activityLogHandler := &handlers.ActivityLogHandler{Service: activityLogService}
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(s.Config)
+	authMiddleware := middleware.NewAuthMiddleware(s.Config, sessionModel, apiKeyService)
 
 	// Setup router
 	router := http.NewServeMux()
-	router.HandleFunc("POST /signup", authHandler.Signup)
-	router.HandleFunc("POST /login", authHandler.Login)
+	// Unauthenticated auth endpoints are limited per client IP, and those
+	// that name an account are also limited per email address.
+	authLimit := middleware.RateLimit(s.RateLimitStore, "auth", s.Config.AuthRateLimit, middleware.ByClientIP(s.Config.TrustedProxies))
+	accountLimit := middleware.RateLimit(s.RateLimitStore, "account", s.Config.AccountRateLimit, middleware.ByEmail)
+
+	router.HandleFunc("POST /signup", authLimit(accountLimit(authHandler.Signup)))
+	router.HandleFunc("POST /login", authLimit(accountLimit(authHandler.Login)))
+	router.HandleFunc("POST /auth/refresh", authLimit(authHandler.Refresh))
+	router.HandleFunc("GET /auth/oidc/providers", oidcHandler.ListProviders)
+	router.HandleFunc("POST /auth/oidc/{provider}/start", authLimit(oidcHandler.StartLogin))
+	router.HandleFunc("POST /auth/oidc/{provider}/callback", authLimit(oidcHandler.FinishLogin))
+	router.HandleFunc("POST /auth/logout", authMiddleware.RequireSession(authHandler.Logout))
+	router.HandleFunc("POST /auth/logout-all", authMiddleware.RequireSession(authHandler.LogoutAll))
+	router.HandleFunc("GET /auth/sessions", authMiddleware.RequireSession(authHandler.ListSessions))
+	router.HandleFunc("DELETE /auth/sessions/{id}", authMiddleware.RequireSession(authHandler.RevokeSession))
+	router.HandleFunc("POST /auth/password/forgot", authLimit(accountLimit(authHandler.ForgotPassword)))
+	router.HandleFunc("POST /auth/password/reset", authLimit(authHandler.ResetPassword))
+	router.HandleFunc("POST /auth/verify-email", authLimit(authHandler.VerifyEmail))
+	router.HandleFunc("POST /auth/verify-email/resend", authMiddleware.RequireSession(authHandler.ResendVerification))
+	router.HandleFunc("GET /me", authMiddleware.Auth(userHandler.GetMe))
+	router.HandleFunc("PATCH /me", authMiddleware.RequireSession(userHandler.UpdateMe))
+	router.HandleFunc("DELETE /me", authMiddleware.RequireSession(userHandler.DeleteMe))
+	router.HandleFunc("POST /me/password", authMiddleware.RequireSession(authHandler.ChangePassword))
+	router.HandleFunc("GET /me/api-keys", authMiddleware.RequireSession(apiKeyHandler.ListAPIKeys))
+	router.HandleFunc("POST /me/api-keys", authMiddleware.RequireSession(apiKeyHandler.CreateAPIKey))
+	router.HandleFunc("DELETE /me/api-keys/{id}", authMiddleware.RequireSession(apiKeyHandler.RevokeAPIKey))
 
 	router.HandleFunc("POST /inventories", authMiddleware.Auth(inventoryHandler.CreateInventory))
 	router.HandleFunc("GET /inventories", authMiddleware.Auth(inventoryHandler.ListInventories))
 	router.HandleFunc("GET /inventories/{id}", authMiddleware.Auth(inventoryHandler.GetInventory))
+	router.HandleFunc("PATCH /inventories/{id}", authMiddleware.Auth(inventoryHandler.UpdateInventory))
+	router.HandleFunc("DELETE /inventories/{id}", authMiddleware.RequireSession(inventoryHandler.DeleteInventory))
+	router.HandleFunc("POST /inventories/{id}/archive", authMiddleware.Auth(inventoryHandler.ArchiveInventory))
+	router.HandleFunc("POST /inventories/{id}/unarchive", authMiddleware.Auth(inventoryHandler.UnarchiveInventory))
+	router.HandleFunc("POST /inventories/{id}/transfer", authMiddleware.RequireSession(inventoryHandler.TransferOwnership))
+	router.HandleFunc("GET /inventories/{id}/transfer", authMiddleware.Auth(inventoryHandler.GetPendingTransfer))
+	router.HandleFunc("DELETE /inventories/{id}/transfer", authMiddleware.RequireSession(inventoryHandler.CancelTransfer))
+	router.HandleFunc("POST /inventories/{id}/transfer/accept", authMiddleware.RequireSession(inventoryHandler.AcceptTransfer))
+	router.HandleFunc("POST /inventories/{id}/transfer/decline", authMiddleware.RequireSession(inventoryHandler.DeclineTransfer))
 
 	router.HandleFunc("POST /inventories/{id}/invitations", authMiddleware.Auth(membershipHandler.InviteUser))
 	router.HandleFunc("GET /inventories/{id}/members", authMiddleware.Auth(membershipHandler.ListMembers))
+	router.HandleFunc("PATCH /inventories/{id}/members/{userId}", authMiddleware.Auth(membershipHandler.UpdateMember))
 	router.HandleFunc("DELETE /inventories/{id}/members/{userId}", authMiddleware.Auth(membershipHandler.RemoveMember))
-	router.HandleFunc("POST /invitations/{id}/accept", authMiddleware.Auth(membershipHandler.AcceptInvite))
+	router.HandleFunc("POST /inventories/{id}/leave", authMiddleware.RequireSession(membershipHandler.LeaveInventory))
+	router.HandleFunc("GET /inventories/{id}/invitations", authMiddleware.Auth(membershipHandler.ListInvitations))
+	router.HandleFunc("POST /invitations/accept", authMiddleware.RequireSession(membershipHandler.AcceptInviteByToken))
+	router.HandleFunc("POST /invitations/{id}/accept", authMiddleware.RequireSession(membershipHandler.AcceptInvite))
+	router.HandleFunc("POST /invitations/{id}/resend", authMiddleware.Auth(membershipHandler.ResendInvitation))
+	router.HandleFunc("DELETE /invitations/{id}", authMiddleware.Auth(membershipHandler.RevokeInvitation))
+	router.HandleFunc("GET /me/invitations", authMiddleware.Auth(membershipHandler.ListMyInvitations))
 
 	router.HandleFunc("POST /inventories/{id}/products", authMiddleware.Auth(productHandler.CreateProduct))
 	router.HandleFunc("GET /inventories/{id}/products", authMiddleware.Auth(productHandler.ListProducts))
@@ -160,6 +312,11 @@ func (s *Server) SetupRouter() *http.ServeMux {
 	router.HandleFunc("DELETE /products/{id}", authMiddleware.Auth(productHandler.DeleteProduct))
 	router.HandleFunc("POST /products/{id}/variants", authMiddleware.Auth(productHandler.CreateVariant))
 	router.HandleFunc("GET /products/{id}/variants", authMiddleware.Auth(productHandler.ListVariants))
+	router.HandleFunc("GET /variants/{id}", authMiddleware.Auth(productHandler.GetVariant))
+	router.HandleFunc("PUT /variants/{id}", authMiddleware.Auth(productHandler.UpdateVariant))
+	router.HandleFunc("DELETE /variants/{id}", authMiddleware.Auth(productHandler.DeleteVariant))
+	router.HandleFunc("GET /inventories/{id}/variants/lookup", authMiddleware.Auth(productHandler.LookupVariants))
+	router.HandleFunc("GET /products/{id}/history", authMiddleware.Auth(activityLogHandler.GetProductHistory))
 
 	router.HandleFunc("POST /inventories/{id}/canonical-products", authMiddleware.Auth(canonicalProductHandler.CreateCanonicalProduct))
 	router.HandleFunc("GET /inventories/{id}/canonical-products", authMiddleware.Auth(canonicalProductHandler.ListCanonicalProducts))
@@ -167,17 +324,24 @@ func (s *Server) SetupRouter() *http.ServeMux {
 	router.HandleFunc("PUT /canonical-products/{id}", authMiddleware.Auth(canonicalProductHandler.UpdateCanonicalProduct))
 	router.HandleFunc("DELETE /canonical-products/{id}", authMiddleware.Auth(canonicalProductHandler.DeleteCanonicalProduct))
 
-	router.HandleFunc("POST /sellers", authMiddleware.Auth(sellerHandler.CreateSeller))
+	router.HandleFunc("POST /inventories/{id}/categories", authMiddleware.Auth(categoryHandler.CreateCategory))
+	router.HandleFunc("GET /inventories/{id}/categories", authMiddleware.Auth(categoryHandler.ListCategories))
+	router.HandleFunc("GET /inventories/{id}/categories/tree", authMiddleware.Auth(categoryHandler.GetTree))
+	router.HandleFunc("GET /categories/{id}", authMiddleware.Auth(categoryHandler.GetCategory))
+	router.HandleFunc("PUT /categories/{id}", authMiddleware.Auth(categoryHandler.UpdateCategory))
+	router.HandleFunc("DELETE /categories/{id}", authMiddleware.Auth(categoryHandler.DeleteCategory))
+
+	router.HandleFunc("POST /sellers", authMiddleware.RequireUnrestricted(sellerHandler.CreateSeller))
 	router.HandleFunc("GET /sellers", authMiddleware.Auth(sellerHandler.ListSellers))
 	router.HandleFunc("GET /sellers/{id}", authMiddleware.Auth(sellerHandler.GetSeller))
-	router.HandleFunc("PUT /sellers/{id}", authMiddleware.Auth(sellerHandler.UpdateSeller))
-	router.HandleFunc("DELETE /sellers/{id}", authMiddleware.Auth(sellerHandler.DeleteSeller))
+	router.HandleFunc("PUT /sellers/{id}", authMiddleware.RequireUnrestricted(sellerHandler.UpdateSeller))
+	router.HandleFunc("DELETE /sellers/{id}", authMiddleware.RequireUnrestricted(sellerHandler.DeleteSeller))
 
-	router.HandleFunc("POST /sellers/{id}/outlets", authMiddleware.Auth(outletHandler.CreateOutlet))
+	router.HandleFunc("POST /sellers/{id}/outlets", authMiddleware.RequireUnrestricted(outletHandler.CreateOutlet))
 	router.HandleFunc("GET /sellers/{id}/outlets", authMiddleware.Auth(outletHandler.ListOutlets))
 	router.HandleFunc("GET /outlets/{id}", authMiddleware.Auth(outletHandler.GetOutlet))
-	router.HandleFunc("PUT /outlets/{id}", authMiddleware.Auth(outletHandler.UpdateOutlet))
-	router.HandleFunc("DELETE /outlets/{id}", authMiddleware.Auth(outletHandler.DeleteOutlet))
+	router.HandleFunc("PUT /outlets/{id}", authMiddleware.RequireUnrestricted(outletHandler.UpdateOutlet))
+	router.HandleFunc("DELETE /outlets/{id}", authMiddleware.RequireUnrestricted(outletHandler.DeleteOutlet))
 
 	router.HandleFunc("POST /inventories/{id}/shopping-lists", authMiddleware.Auth(shoppingListHandler.CreateList))
 	router.HandleFunc("GET /inventories/{id}/shopping-lists", authMiddleware.Auth(shoppingListHandler.ListLists))
@@ -192,9 +356,26 @@ func (s *Server) SetupRouter() *http.ServeMux {
 	router.HandleFunc("POST /inventories/{id}/transactions", authMiddleware.Auth(transactionHandler.CreateTransaction))
 	router.HandleFunc("GET /inventories/{id}/transactions", authMiddleware.Auth(transactionHandler.ListTransactions))
 	router.HandleFunc("GET /transactions/{id}", authMiddleware.Auth(transactionHandler.GetTransaction))
+	router.HandleFunc("PUT /transactions/{id}", authMiddleware.Auth(transactionHandler.UpdateTransaction))
+	router.HandleFunc("DELETE /transactions/{id}", authMiddleware.Auth(transactionHandler.DeleteTransaction))
 
 	router.HandleFunc("POST /inventories/{id}/consumption-events", authMiddleware.Auth(consumptionHandler.CreateConsumptionEvent))
 	router.HandleFunc("GET /inventories/{id}/consumption-events", authMiddleware.Auth(consumptionHandler.ListConsumptionEvents))
+	router.HandleFunc("DELETE /consumption-events/{id}", authMiddleware.Auth(consumptionHandler.DeleteConsumptionEvent))
+
+	router.HandleFunc("GET /inventories/{id}/stock", authMiddleware.Auth(inventoryProductHandler.ListStock))
+	router.HandleFunc("GET /inventories/{id}/stock/{variantId}", authMiddleware.Auth(inventoryProductHandler.GetStock))
+	router.HandleFunc("POST /inventories/{id}/stock/{variantId}/adjustments", authMiddleware.Auth(inventoryProductHandler.AdjustStock))
+	router.HandleFunc("GET /inventories/{id}/stock/{variantId}/adjustments", authMiddleware.Auth(inventoryProductHandler.ListAdjustments))
+	router.HandleFunc("GET /canonical-products/{id}/stock", authMiddleware.Auth(inventoryProductHandler.GetStockTotal))
+
+	router.HandleFunc("GET /inventories/{id}/activity", authMiddleware.Auth(activityLogHandler.ListActivity))
+
+	router.HandleFunc("GET /units", authMiddleware.Auth(unitHandler.ListUnits))
+	router.HandleFunc("GET /units/convert", authMiddleware.Auth(unitHandler.Convert))
+	router.HandleFunc("GET /canonical-products/{id}/unit-conversions", authMiddleware.Auth(unitHandler.ListConversions))
+	router.HandleFunc("POST /canonical-products/{id}/unit-conversions", authMiddleware.Auth(unitHandler.CreateConversion))
+	router.HandleFunc("DELETE /unit-conversions/{id}", authMiddleware.Auth(unitHandler.DeleteConversion))
 
 	router.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -204,12 +385,17 @@ func (s *Server) SetupRouter() *http.ServeMux {
 	return router
 }
 
-func (s *Server) Run() error {
-	router := s.SetupRouter()
+// Handler is the router wrapped in the middleware that applies to every
+// request.
+func (s *Server) Handler() http.Handler {
+	apiLimit := middleware.RateLimit(s.RateLimitStore, "api", s.Config.APIRateLimit, middleware.ByClientIP(s.Config.TrustedProxies))
+	return middleware.RequestID(s.Logger, apiLimit(s.SetupRouter().ServeHTTP))
+}
 
+func (s *Server) Run() error {
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", s.Config.Port),
-		Handler:      router,
+		Handler:      s.Handler(),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -219,6 +405,26 @@ func (s *Server) Run() error {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	invitationSweeper := &services.MembershipService{
+		MembershipModel:    &models.MembershipModel{DB: s.DB.GetDB()},
+		ActivityLogService: &services.ActivityLogService{Model: &models.ActivityLogModel{DB: s.DB.GetDB()}},
+	}
+	go invitationSweeper.RunExpirySweep(workerCtx, s.Config.InvitationSweepInterval, s.Logger)
+
+	mailer, err := notify.NewMailer(s.Config)
+	if err != nil {
+		return err
+	}
+	outbox := &notify.Outbox{
+		Model:  &models.EmailOutboxModel{DB: s.DB.GetDB()},
+		Mailer: mailer,
+		Logger: s.Logger,
+	}
+	go outbox.Run(workerCtx, s.Config.OutboxPollInterval)
+
 	go func() {
 		s.Logger.Info("starting server", "port", s.Config.Port, "env", s.Config.Env)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -229,6 +435,7 @@ func (s *Server) Run() error {
 
 	<-done
 	s.Logger.Info("server stopped")
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
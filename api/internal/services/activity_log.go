@@ -2,12 +2,49 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 	"ukoni/internal/database"
 	"ukoni/internal/models"
 )
 
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
 type ActivityLogService struct {
-	Model *models.ActivityLogModel
+	Model        *models.ActivityLogModel
+	ProductModel *models.ProductModel
+	Authorizer   *Authorizer
+}
+
+// ActivityQuery holds the filters accepted when reading activity. Action may
+// name a single action such as "transaction.created" or, ending in ".*", every
+// action under a prefix such as "transaction.*".
+type ActivityQuery struct {
+	UserID     string
+	Action     string
+	EntityType string
+	EntityID   string
+	Since      *time.Time
+	Until      *time.Time
+	Cursor     string
+	Limit      int
+}
+
+// ActivityPage is one page of activity, newest first. NextCursor is set when
+// there are older entries to fetch.
+type ActivityPage struct {
+	Items      []*models.ActivityLog `json:"items"`
+	NextCursor *string               `json:"next_cursor"`
 }
 
 func (s *ActivityLogService) LogActivity(ctx context.Context, dbtx database.DBTX, inventoryID, userID *string, action, entityType string, entityID *string, metadata map[string]interface{}) error {
@@ -22,3 +59,118 @@ func (s *ActivityLogService) LogActivity(ctx context.Context, dbtx database.DBTX
 
 	return s.Model.Create(ctx, dbtx, logEntry)
 }
+
+func (s *ActivityLogService) ListActivity(ctx context.Context, userID, inventoryID string, q ActivityQuery) (*ActivityPage, error) {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionActivityView); err != nil {
+		return nil, err
+	}
+
+	filter, err := activityFilter(q)
+	if err != nil {
+		return nil, err
+	}
+	filter.InventoryID = inventoryID
+	filter.UserID = q.UserID
+	filter.EntityType = q.EntityType
+	filter.EntityID = q.EntityID
+	if strings.HasSuffix(q.Action, ".*") {
+		filter.ActionPrefix = strings.TrimSuffix(q.Action, "*")
+	} else {
+		filter.Action = q.Action
+	}
+
+	return s.page(ctx, filter)
+}
+
+// GetProductHistory returns the activity recorded against a product and its
+// variants.
+func (s *ActivityLogService) GetProductHistory(ctx context.Context, userID, productID string, q ActivityQuery) (*ActivityPage, error) {
+	product, err := s.ProductModel.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, product.InventoryID, ActionActivityView); err != nil {
+		return nil, err
+	}
+
+	filter, err := activityFilter(q)
+	if err != nil {
+		return nil, err
+	}
+	filter.InventoryID = product.InventoryID
+	filter.ProductID = product.ID
+
+	return s.page(ctx, filter)
+}
+
+// activityFilter applies the time range, cursor and page size shared by every
+// activity listing.
+func activityFilter(q ActivityQuery) (models.ActivityLogFilter, error) {
+	filter := models.ActivityLogFilter{
+		Since: q.Since,
+		Until: q.Until,
+		Limit: q.Limit,
+	}
+	if filter.Since != nil && filter.Until != nil && !filter.Since.Before(*filter.Until) {
+		return filter, fmt.Errorf("%w: since must be before until", ErrInvalidInput)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultActivityLimit
+	}
+	if filter.Limit > maxActivityLimit {
+		filter.Limit = maxActivityLimit
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeActivityCursor(q.Cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.Before = cursor
+	}
+	return filter, nil
+}
+
+// page fetches one entry beyond the limit to learn whether another page
+// follows, and if so points the cursor at the last entry returned.
+func (s *ActivityLogService) page(ctx context.Context, filter models.ActivityLogFilter) (*ActivityPage, error) {
+	limit := filter.Limit
+	filter.Limit = limit + 1
+
+	entries, err := s.Model.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ActivityPage{Items: entries}
+	if len(entries) > limit {
+		page.Items = entries[:limit]
+		last := page.Items[limit-1]
+		cursor := encodeActivityCursor(last.CreatedAt, last.ID)
+		page.NextCursor = &cursor
+	}
+	return page, nil
+}
+
+func encodeActivityCursor(createdAt time.Time, id string) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeActivityCursor(cursor string) (*models.ActivityLogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &models.ActivityLogCursor{CreatedAt: t, ID: id}, nil
+}
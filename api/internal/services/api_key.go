@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"ukoni/internal/models"
+)
+
+const (
+	APIKeyScopeRead      = "read"
+	APIKeyScopeReadWrite = "read_write"
+
+	// APIKeyPrefix starts every API key, which tells them apart from JWTs.
+	APIKeyPrefix = "uk_"
+	// apiKeyShownPrefix is how much of a key is kept in the clear to
+	// identify it.
+	apiKeyShownPrefix = len(APIKeyPrefix) + 8
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid or expired api key")
+)
+
+type APIKeyService struct {
+	Model              *models.APIKeyModel
+	Authorizer         *Authorizer
+	ActivityLogService *ActivityLogService
+}
+
+type CreateAPIKeyInput struct {
+	Name string
+
+	// InventoryID, if set, limits the key to one inventory.
+	InventoryID *string
+
+	// Scope is read or read_write, defaulting to read_write.
+	Scope string
+
+	ExpiresAt *time.Time
+}
+
+// CreateAPIKey creates an API key for a user. The key itself is returned
+// only here; afterwards only its prefix can be seen.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, userID string, input CreateAPIKeyInput) (*models.APIKey, string, error) {
+	name := strings.TrimSpace(input.Name)
+	scope := input.Scope
+	if scope == "" {
+		scope = APIKeyScopeReadWrite
+	}
+	now := time.Now()
+
+	v := &ValidationError{}
+	validateName(v, "name", name)
+	if scope != APIKeyScopeRead && scope != APIKeyScopeReadWrite {
+		v.Add("scope", CodeInvalid, "scope must be read or read_write")
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(now) {
+		v.Add("expires_at", CodeInvalid, "expires_at must be in the future")
+	}
+	if err := v.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// A key can't reach further than its creator.
+	if input.InventoryID != nil {
+		if err := s.Authorizer.Authorize(ctx, userID, *input.InventoryID, ActionInventoryView); err != nil {
+			return nil, "", err
+		}
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	token := APIKeyPrefix + secret
+
+	key := &models.APIKey{
+		UserID:      userID,
+		Name:        name,
+		Prefix:      token[:apiKeyShownPrefix],
+		TokenHash:   hashToken(token),
+		InventoryID: input.InventoryID,
+		Scope:       scope,
+		ExpiresAt:   input.ExpiresAt,
+	}
+
+	tx, err := s.Model.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	if err := s.Model.Create(ctx, tx, key); err != nil {
+		return nil, "", err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &userID, "api_key.created", "api_key", &key.ID, map[string]interface{}{
+			"name":         key.Name,
+			"prefix":       key.Prefix,
+			"scope":        key.Scope,
+			"inventory_id": key.InventoryID,
+		}); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+
+	return key, token, nil
+}
+
+// ListAPIKeys lists the keys a user hasn't revoked.
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID string) ([]*models.APIKey, error) {
+	return s.Model.ListForUser(ctx, userID)
+}
+
+// RevokeAPIKey stops one of a user's keys working.
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	tx, err := s.Model.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.Model.Revoke(ctx, tx, userID, keyID, time.Now()); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &userID, "api_key.revoked", "api_key", &keyID, nil); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Authenticate returns the key a token belongs to if it may still be used,
+// and records that it has been.
+func (s *APIKeyService) Authenticate(ctx context.Context, token string) (*models.APIKey, error) {
+	key, err := s.Model.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.Model.MarkUsed(ctx, key.ID, now); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// apiKeyFromContext returns the API key a request was authenticated with, or
+// nil for a normal login.
+func apiKeyFromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value("apiKey").(*models.APIKey)
+	return key
+}
+
+// apiKeyAllows reports whether the key a request was made with, if any,
+// permits action on an inventory.
+func apiKeyAllows(ctx context.Context, inventoryID string, action Action) bool {
+	key := apiKeyFromContext(ctx)
+	if key == nil {
+		return true
+	}
+	if key.InventoryID != nil && *key.InventoryID != inventoryID {
+		return false
+	}
+	if key.Scope == APIKeyScopeRead && !action.IsRead() {
+		return false
+	}
+	return true
+}
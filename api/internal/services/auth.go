@@ -1,57 +1,397 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
+	"ukoni/internal/database"
 	"ukoni/internal/models"
+	"ukoni/internal/notify"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService struct {
-	UserModel *models.UserModel
-	JWTSecret string
+	UserModel              *models.UserModel
+	SessionModel           *models.SessionModel
+	PasswordResetModel     *models.PasswordResetModel
+	EmailVerificationModel *models.EmailVerificationModel
+	MembershipService      *MembershipService
+	ActivityLogService     *ActivityLogService
+	Outbox                 *notify.Outbox
+	JWTSecret              string
+
+	// AccessTokenTTL and RefreshTokenTTL default to 15 minutes and 30 days.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// LoginLockoutThreshold failed logins in a row lock the account for
+	// LoginLockoutBase, doubling with every further failure. Zero disables
+	// lockout.
+	LoginLockoutThreshold int
+	LoginLockoutBase      time.Duration
 }
 
+// Signup creates an account and emails a link to verify its address.
 func (s *AuthService) Signup(name, email, password string) (*models.User, error) {
+	ctx := context.Background()
+	user, err := s.newUser(ctx, name, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.UserModel.InsertTx(ctx, tx, user); err != nil {
+		return nil, emailConflict(err)
+	}
+
+	if err := s.sendVerification(ctx, tx, user); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// SignupWithInvitation creates an account and accepts the invitation the
+// token belongs to in one step. Nothing is created if the invitation cannot
+// be accepted. Holding a token that was emailed to the address proves the
+// user owns it, so the account starts out verified.
+func (s *AuthService) SignupWithInvitation(name, email, password, invitationToken string) (*models.User, *models.Invitation, error) {
+	ctx := context.Background()
+	user, err := s.newUser(ctx, name, email, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.UserModel.InsertTx(ctx, tx, user); err != nil {
+		return nil, nil, emailConflict(err)
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	invitation, err := s.MembershipService.AcceptInvitationTx(ctx, tx, user, invitationToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.UserModel.MarkEmailVerified(ctx, tx, user.ID, user.Email, now); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return user, invitation, nil
+}
+
+// newUser validates signup details and builds the user to insert, with its
+// email normalised and its password hashed.
+func (s *AuthService) newUser(ctx context.Context, name, email, password string) (*models.User, error) {
+	name = strings.TrimSpace(name)
+	email = NormalizeEmail(email)
+
+	v := &ValidationError{}
+	validateName(v, "name", name)
+	validateEmail(v, "email", email)
+	validatePassword(v, "password", password)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	taken, err := s.UserModel.EmailTaken(ctx, email, "")
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, errEmailTaken("email")
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
 
-	user := &models.User{
+	return &models.User{
 		Name:         name,
 		Email:        email,
 		PasswordHash: string(hash),
+	}, nil
+}
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrIncorrectPassword   = errors.New("password is incorrect")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused; session revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+
+	ErrReauthenticationRequired = errors.New("sign in again to confirm this request")
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// ClientInfo describes the device a session was started from.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair is a short-lived access token and the refresh token that renews
+// it.
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    string    `json:"session_id"`
+}
+
+// Login checks a user's credentials and starts a new session.
+func (s *AuthService) Login(email, password string, client ClientInfo) (*TokenPair, error) {
+	email = NormalizeEmail(email)
+
+	v := &ValidationError{}
+	if email == "" {
+		v.Add("email", CodeRequired, "email is required")
+	}
+	if password == "" {
+		v.Add("password", CodeRequired, "password is required")
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserModel.GetByEmail(email)
+	if err != nil {
+		return nil, ErrInvalidCredentials
 	}
 
-	if err := s.UserModel.Insert(user); err != nil {
+	ctx := context.Background()
+	now := time.Now()
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return nil, accountLocked(user.LockedUntil.Sub(now))
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		lockout, err := s.recordFailedLogin(ctx, user, client, now)
+		if err != nil {
+			return nil, err
+		}
+		if lockout > 0 {
+			return nil, accountLocked(lockout)
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.FailedLoginCount > 0 || user.LockedUntil != nil {
+		if err := s.UserModel.ClearFailedLogins(ctx, s.UserModel.DB, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.StartSession(ctx, s.SessionModel.DB, user.ID, client)
+}
+
+// StartSession opens a new session family for a user who has just
+// authenticated.
+func (s *AuthService) StartSession(ctx context.Context, dbtx database.DBTX, userID string, client ClientInfo) (*TokenPair, error) {
+	now := time.Now()
+	return s.issueTokens(ctx, dbtx, &models.Session{
+		UserID:          userID,
+		UserAgent:       optionalString(client.UserAgent),
+		IPAddress:       optionalString(client.IPAddress),
+		AuthenticatedAt: now,
+	}, now)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// works once; presenting one that has already been exchanged is treated as
+// theft and revokes the whole session.
+func (s *AuthService) Refresh(refreshToken string, client ClientInfo) (*TokenPair, error) {
+	ctx := context.Background()
+	tx, err := s.SessionModel.DB.BeginTx(ctx, nil)
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	return user, nil
+	now := time.Now()
+	session, err := s.SessionModel.GetByTokenHashForUpdate(ctx, tx, hashToken(refreshToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if session.RevokedAt != nil || !session.ExpiresAt.After(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if session.RotatedAt != nil {
+		if err := s.SessionModel.RevokeFamily(ctx, tx, session.FamilyID, now); err != nil {
+			return nil, err
+		}
+		if s.ActivityLogService != nil {
+			if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &session.UserID, "session.token_reused", "session", &session.FamilyID, map[string]interface{}{
+				"user_agent": client.UserAgent,
+				"ip_address": client.IPAddress,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if err := s.SessionModel.MarkRotated(ctx, tx, session.ID, now); err != nil {
+		return nil, err
+	}
+
+	next := &models.Session{
+		FamilyID:        session.FamilyID,
+		UserID:          session.UserID,
+		UserAgent:       session.UserAgent,
+		IPAddress:       session.IPAddress,
+		AuthenticatedAt: session.AuthenticatedAt,
+	}
+	if client.UserAgent != "" {
+		next.UserAgent = &client.UserAgent
+	}
+	if client.IPAddress != "" {
+		next.IPAddress = &client.IPAddress
+	}
+
+	pair, err := s.issueTokens(ctx, tx, next, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pair, nil
 }
 
-func (s *AuthService) Login(email, password string) (string, error) {
-	user, err := s.UserModel.GetByEmail(email)
+// Logout ends a single session.
+func (s *AuthService) Logout(userID, sessionID string) error {
+	err := s.SessionModel.RevokeUserFamily(context.Background(), s.SessionModel.DB, userID, sessionID, time.Now())
+	if err == sql.ErrNoRows {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
+// LogoutAll ends every session of a user, on every device.
+func (s *AuthService) LogoutAll(userID string) error {
+	return s.SessionModel.RevokeAllForUser(context.Background(), s.SessionModel.DB, userID, "", time.Now())
+}
+
+// ListSessions lists a user's live sessions, marking the one in use.
+func (s *AuthService) ListSessions(userID, currentSessionID string) ([]*models.Session, error) {
+	sessions, err := s.SessionModel.ListActive(context.Background(), userID, time.Now())
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.FamilyID == currentSessionID
 	}
+	return sessions, nil
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+// issueTokens stores a session row with a fresh refresh token and signs an
+// access token tied to its family.
+func (s *AuthService) issueTokens(ctx context.Context, dbtx database.DBTX, session *models.Session, now time.Time) (*TokenPair, error) {
+	refreshToken, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+	session.RefreshTokenHash = hashToken(refreshToken)
+	session.ExpiresAt = now.Add(s.refreshTokenTTL())
+
+	if err := s.SessionModel.Create(ctx, dbtx, session); err != nil {
+		return nil, err
 	}
 
+	expiresAt := now.Add(s.accessTokenTTL())
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
+		"sub": session.UserID,
+		"sid": session.FamilyID,
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
 	})
 
 	tokenString, err := token.SignedString([]byte(s.JWTSecret))
 	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+		SessionID:    session.FamilyID,
+	}, nil
+}
+
+func (s *AuthService) accessTokenTTL() time.Duration {
+	if s.AccessTokenTTL > 0 {
+		return s.AccessTokenTTL
+	}
+	return defaultAccessTokenTTL
+}
+
+func (s *AuthService) refreshTokenTTL() time.Duration {
+	if s.RefreshTokenTTL > 0 {
+		return s.RefreshTokenTTL
+	}
+	return defaultRefreshTokenTTL
+}
+
+// generateSecret returns a random URL-safe token for credentials that are
+// stored only as a hash.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	return tokenString, nil
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
 }
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"ukoni/internal/models"
+)
+
+var (
+	ErrForbidden         = errors.New("forbidden")
+	ErrInventoryArchived = errors.New("inventory is archived and read-only")
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+
+	// RoleOwner is the effective role of an inventory's owner. It is never
+	// stored on a membership.
+	RoleOwner = "owner"
+)
+
+// Action names something a user can do within an inventory.
+type Action string
+
+const (
+	ActionInventoryView     Action = "inventory.view"
+	ActionInventoryUpdate   Action = "inventory.update"
+	ActionInventoryArchive  Action = "inventory.archive"
+	ActionInventoryDelete   Action = "inventory.delete"
+	ActionInventoryTransfer Action = "inventory.transfer"
+
+	ActionMemberView   Action = "member.view"
+	ActionMemberInvite Action = "member.invite"
+	ActionMemberUpdate Action = "member.update"
+	ActionMemberRemove Action = "member.remove"
+
+	ActionInvitationView   Action = "invitation.view"
+	ActionInvitationRevoke Action = "invitation.revoke"
+
+	ActionProductView   Action = "product.view"
+	ActionProductCreate Action = "product.create"
+	ActionProductUpdate Action = "product.update"
+	ActionProductDelete Action = "product.delete"
+
+	ActionCanonicalProductView   Action = "canonical_product.view"
+	ActionCanonicalProductCreate Action = "canonical_product.create"
+	ActionCanonicalProductUpdate Action = "canonical_product.update"
+	ActionCanonicalProductDelete Action = "canonical_product.delete"
+
+	ActionCategoryView   Action = "category.view"
+	ActionCategoryCreate Action = "category.create"
+	ActionCategoryUpdate Action = "category.update"
+	ActionCategoryDelete Action = "category.delete"
+
+	ActionShoppingListView   Action = "shopping_list.view"
+	ActionShoppingListCreate Action = "shopping_list.create"
+	ActionShoppingListUpdate Action = "shopping_list.update"
+	ActionShoppingListDelete Action = "shopping_list.delete"
+
+	ActionTransactionView   Action = "transaction.view"
+	ActionTransactionCreate Action = "transaction.create"
+	ActionTransactionUpdate Action = "transaction.update"
+	ActionTransactionDelete Action = "transaction.delete"
+
+	ActionConsumptionView   Action = "consumption.view"
+	ActionConsumptionCreate Action = "consumption.create"
+	ActionConsumptionDelete Action = "consumption.delete"
+
+	ActionStockView   Action = "stock.view"
+	ActionStockAdjust Action = "stock.adjust"
+
+	ActionActivityView Action = "activity.view"
+)
+
+// IsRead reports whether an action only looks at data.
+func (a Action) IsRead() bool {
+	return strings.HasSuffix(string(a), ".view")
+}
+
+// allowedWhenArchived reports whether an action may be taken on an archived
+// inventory, which is otherwise read-only.
+func (a Action) allowedWhenArchived() bool {
+	switch a {
+	case ActionInventoryArchive, ActionInventoryDelete, ActionInventoryTransfer:
+		return true
+	}
+	return a.IsRead()
+}
+
+var (
+	anyRole    = []string{RoleAdmin, RoleEditor, RoleViewer}
+	editorRole = []string{RoleAdmin, RoleEditor}
+	adminRole  = []string{RoleAdmin}
+)
+
+// rolePolicy lists the membership roles allowed to perform each action. The
+// inventory owner is allowed everything regardless of this table.
+var rolePolicy = map[Action][]string{
+	ActionInventoryView:    anyRole,
+	ActionInventoryUpdate:  adminRole,
+	ActionInventoryArchive: adminRole,
+	// Only the owner may delete or give away an inventory.
+	ActionInventoryDelete:   nil,
+	ActionInventoryTransfer: nil,
+
+	ActionMemberView:   anyRole,
+	ActionMemberInvite: adminRole,
+	ActionMemberUpdate: adminRole,
+	ActionMemberRemove: adminRole,
+
+	ActionInvitationView:   adminRole,
+	ActionInvitationRevoke: adminRole,
+
+	ActionProductView:   anyRole,
+	ActionProductCreate: editorRole,
+	ActionProductUpdate: editorRole,
+	ActionProductDelete: editorRole,
+
+	ActionCanonicalProductView:   anyRole,
+	ActionCanonicalProductCreate: editorRole,
+	ActionCanonicalProductUpdate: editorRole,
+	ActionCanonicalProductDelete: editorRole,
+
+	ActionCategoryView:   anyRole,
+	ActionCategoryCreate: editorRole,
+	ActionCategoryUpdate: editorRole,
+	ActionCategoryDelete: editorRole,
+
+	ActionShoppingListView:   anyRole,
+	ActionShoppingListCreate: editorRole,
+	ActionShoppingListUpdate: editorRole,
+	ActionShoppingListDelete: editorRole,
+
+	ActionTransactionView:   anyRole,
+	ActionTransactionCreate: editorRole,
+	ActionTransactionUpdate: editorRole,
+	ActionTransactionDelete: editorRole,
+
+	ActionConsumptionView:   anyRole,
+	ActionConsumptionCreate: editorRole,
+	ActionConsumptionDelete: editorRole,
+
+	ActionStockView:   anyRole,
+	ActionStockAdjust: editorRole,
+
+	ActionActivityView: anyRole,
+}
+
+// Authorizer decides whether a user may perform an action on an inventory.
+type Authorizer struct {
+	InventoryModel  *models.InventoryModel
+	MembershipModel *models.MembershipModel
+}
+
+// Access is a user's standing in an inventory, as worked out by Resolve.
+type Access struct {
+	Inventory *models.Inventory
+
+	// Role is the user's effective role: RoleOwner for the owner, otherwise
+	// their membership role.
+	Role string
+}
+
+// Can reports whether the role allows an action. The owner may do
+// anything.
+func (a *Access) Can(action Action) bool {
+	if a.Role == RoleOwner {
+		return true
+	}
+	for _, role := range rolePolicy[action] {
+		if a.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOwner reports whether the user owns the inventory.
+func (a *Access) IsOwner() bool {
+	return a.Role == RoleOwner
+}
+
+// Resolve works out a user's effective role in an inventory. It is the one
+// place that decides who belongs to an inventory: it returns ErrForbidden if
+// the inventory doesn't exist or the user is neither its owner nor a current
+// member.
+func (a *Authorizer) Resolve(ctx context.Context, userID, inventoryID string) (*Access, error) {
+	inv, err := a.InventoryModel.GetByID(inventoryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrForbidden
+		}
+		return nil, err
+	}
+	if inv.OwnerUserID == userID {
+		return &Access{Inventory: inv, Role: RoleOwner}, nil
+	}
+
+	member, err := a.MembershipModel.GetMembership(inv.ID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrForbidden
+		}
+		return nil, err
+	}
+	return &Access{Inventory: inv, Role: member.Role}, nil
+}
+
+// Authorize returns ErrForbidden unless the user's effective role allows the
+// action. Requests made with an API key are also held to the key's
+// inventory and scope. Archived inventories only allow reading, and
+// unarchiving, deleting or transferring them.
+func (a *Authorizer) Authorize(ctx context.Context, userID, inventoryID string, action Action) error {
+	_, err := a.Require(ctx, userID, inventoryID, action)
+	return err
+}
+
+// Require is Authorize for callers that also need the user's access, such as
+// their role or the inventory itself.
+func (a *Authorizer) Require(ctx context.Context, userID, inventoryID string, action Action) (*Access, error) {
+	if !apiKeyAllows(ctx, inventoryID, action) {
+		return nil, ErrForbidden
+	}
+
+	access, err := a.Resolve(ctx, userID, inventoryID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.Can(action) {
+		return nil, ErrForbidden
+	}
+
+	if access.Inventory.ArchivedAt != nil && !action.allowedWhenArchived() {
+		return nil, ErrInventoryArchived
+	}
+	return access, nil
+}
+
+// IsValidRole reports whether role is one of the membership roles.
+func IsValidRole(role string) bool {
+	for _, r := range anyRole {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -10,9 +10,11 @@ import (
 type CanonicalProductService struct {
 	DB                    *sql.DB
 	CanonicalProductModel *models.CanonicalProductModel
+	CategoryService       *CategoryService
+	Authorizer            *Authorizer
 }
 
-func (s *CanonicalProductService) CreateCanonicalProduct(ctx context.Context, inventoryID, name, description, categoryID string) (*models.CanonicalProduct, error) {
+func (s *CanonicalProductService) CreateCanonicalProduct(ctx context.Context, userID, inventoryID, name, description, categoryID string) (*models.CanonicalProduct, error) {
 	if inventoryID == "" {
 		return nil, fmt.Errorf("%w: inventory id is required", ErrInvalidInput)
 	}
@@ -20,6 +22,10 @@ func (s *CanonicalProductService) CreateCanonicalProduct(ctx context.Context, in
 		return nil, fmt.Errorf("%w: product name is required", ErrInvalidInput)
 	}
 
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionCanonicalProductCreate); err != nil {
+		return nil, err
+	}
+
 	product := &models.CanonicalProduct{
 		InventoryID: inventoryID,
 		Name:        name,
@@ -28,6 +34,9 @@ func (s *CanonicalProductService) CreateCanonicalProduct(ctx context.Context, in
 		product.Description = &description
 	}
 	if categoryID != "" {
+		if err := s.CategoryService.CheckCategory(ctx, inventoryID, categoryID); err != nil {
+			return nil, err
+		}
 		product.CategoryID = &categoryID
 	}
 
@@ -38,14 +47,17 @@ func (s *CanonicalProductService) CreateCanonicalProduct(ctx context.Context, in
 	return product, nil
 }
 
-func (s *CanonicalProductService) GetCanonicalProduct(ctx context.Context, id string) (*models.CanonicalProduct, error) {
-	return s.CanonicalProductModel.GetByID(ctx, id)
+func (s *CanonicalProductService) GetCanonicalProduct(ctx context.Context, userID, id string) (*models.CanonicalProduct, error) {
+	return s.authorizeCanonicalProduct(ctx, userID, id, ActionCanonicalProductView)
 }
 
-func (s *CanonicalProductService) ListCanonicalProducts(ctx context.Context, inventoryID string, limit, offset int, search string) ([]*models.CanonicalProduct, error) {
+func (s *CanonicalProductService) ListCanonicalProducts(ctx context.Context, userID, inventoryID string, limit, offset int, search string) ([]*models.CanonicalProduct, error) {
 	if inventoryID == "" {
 		return nil, fmt.Errorf("%w: inventory id is required", ErrInvalidInput)
 	}
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionCanonicalProductView); err != nil {
+		return nil, err
+	}
 	if limit <= 0 {
 		limit = 10
 	}
@@ -55,7 +67,7 @@ func (s *CanonicalProductService) ListCanonicalProducts(ctx context.Context, inv
 	return s.CanonicalProductModel.List(ctx, inventoryID, limit, offset, search)
 }
 
-func (s *CanonicalProductService) UpdateCanonicalProduct(ctx context.Context, id, name, description, categoryID string) (*models.CanonicalProduct, error) {
+func (s *CanonicalProductService) UpdateCanonicalProduct(ctx context.Context, userID, id, name, description, categoryID string) (*models.CanonicalProduct, error) {
 	if id == "" {
 		return nil, fmt.Errorf("%w: product id is required", ErrInvalidInput)
 	}
@@ -63,6 +75,11 @@ func (s *CanonicalProductService) UpdateCanonicalProduct(ctx context.Context, id
 		return nil, fmt.Errorf("%w: product name is required", ErrInvalidInput)
 	}
 
+	existing, err := s.authorizeCanonicalProduct(ctx, userID, id, ActionCanonicalProductUpdate)
+	if err != nil {
+		return nil, err
+	}
+
 	product := &models.CanonicalProduct{
 		ID:   id,
 		Name: name,
@@ -71,10 +88,13 @@ func (s *CanonicalProductService) UpdateCanonicalProduct(ctx context.Context, id
 		product.Description = &description
 	}
 	if categoryID != "" {
+		if err := s.CategoryService.CheckCategory(ctx, existing.InventoryID, categoryID); err != nil {
+			return nil, err
+		}
 		product.CategoryID = &categoryID
 	}
 
-	err := s.CanonicalProductModel.Update(ctx, s.DB, product)
+	err = s.CanonicalProductModel.Update(ctx, s.DB, product)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
@@ -85,13 +105,32 @@ func (s *CanonicalProductService) UpdateCanonicalProduct(ctx context.Context, id
 	return s.CanonicalProductModel.GetByID(ctx, id)
 }
 
-func (s *CanonicalProductService) DeleteCanonicalProduct(ctx context.Context, id string) error {
+func (s *CanonicalProductService) DeleteCanonicalProduct(ctx context.Context, userID, id string) error {
 	if id == "" {
 		return fmt.Errorf("%w: product id is required", ErrInvalidInput)
 	}
+	if _, err := s.authorizeCanonicalProduct(ctx, userID, id, ActionCanonicalProductDelete); err != nil {
+		return err
+	}
 	err := s.CanonicalProductModel.Delete(ctx, s.DB, id)
 	if err == sql.ErrNoRows {
 		return ErrNotFound
 	}
 	return err
 }
+
+// authorizeCanonicalProduct loads a canonical product and checks the user may
+// perform action on the inventory it belongs to.
+func (s *CanonicalProductService) authorizeCanonicalProduct(ctx context.Context, userID, id string, action Action) (*models.CanonicalProduct, error) {
+	product, err := s.CanonicalProductModel.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, product.InventoryID, action); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
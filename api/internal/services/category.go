@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"ukoni/internal/models"
+)
+
+var (
+	ErrCategoryNotFound  = errors.New("category not found")
+	ErrCategoryCycle     = errors.New("a category cannot be moved beneath itself")
+	ErrCategoryNameTaken = errors.New("a category with this name already exists here")
+)
+
+type CategoryService struct {
+	DB                 *sql.DB
+	CategoryModel      *models.CategoryModel
+	Authorizer         *Authorizer
+	ActivityLogService *ActivityLogService
+}
+
+func (s *CategoryService) CreateCategory(ctx context.Context, userID, inventoryID, name string, parentCategoryID *string) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: category name is required", ErrInvalidInput)
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionCategoryCreate); err != nil {
+		return nil, err
+	}
+
+	categories, err := s.CategoryModel.ListByInventory(ctx, inventoryID)
+	if err != nil {
+		return nil, err
+	}
+	parentCategoryID = normalizeParent(parentCategoryID)
+	if err := checkPlacement(categories, "", name, parentCategoryID); err != nil {
+		return nil, err
+	}
+
+	category := &models.Category{
+		InventoryID:      inventoryID,
+		Name:             name,
+		ParentCategoryID: parentCategoryID,
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.CategoryModel.Create(ctx, tx, category); err != nil {
+		return nil, err
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, "category.created", "category", &category.ID, map[string]interface{}{
+		"name":               category.Name,
+		"parent_category_id": category.ParentCategoryID,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (s *CategoryService) GetCategory(ctx context.Context, userID, id string) (*models.Category, error) {
+	return s.authorizeCategory(ctx, userID, id, ActionCategoryView)
+}
+
+func (s *CategoryService) ListCategories(ctx context.Context, userID, inventoryID string) ([]*models.Category, error) {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionCategoryView); err != nil {
+		return nil, err
+	}
+	return s.CategoryModel.ListByInventory(ctx, inventoryID)
+}
+
+// GetTree returns the categories of an inventory nested under their parents,
+// with siblings ordered by name.
+func (s *CategoryService) GetTree(ctx context.Context, userID, inventoryID string) ([]*models.CategoryNode, error) {
+	categories, err := s.ListCategories(ctx, userID, inventoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*models.CategoryNode, len(categories))
+	for _, c := range categories {
+		nodes[c.ID] = &models.CategoryNode{Category: c, Children: []*models.CategoryNode{}}
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, c := range categories {
+		node := nodes[c.ID]
+		if c.ParentCategoryID != nil {
+			if parent, ok := nodes[*c.ParentCategoryID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots, nil
+}
+
+// UpdateCategory renames a category and moves it beneath parentCategoryID, or
+// to the top level when parentCategoryID is nil.
+func (s *CategoryService) UpdateCategory(ctx context.Context, userID, id, name string, parentCategoryID *string) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: category name is required", ErrInvalidInput)
+	}
+
+	category, err := s.authorizeCategory(ctx, userID, id, ActionCategoryUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.CategoryModel.ListByInventory(ctx, category.InventoryID)
+	if err != nil {
+		return nil, err
+	}
+	parentCategoryID = normalizeParent(parentCategoryID)
+	if err := checkPlacement(categories, category.ID, name, parentCategoryID); err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{}
+	if category.Name != name {
+		metadata["old_name"] = category.Name
+		metadata["new_name"] = name
+	}
+	if stringValue(category.ParentCategoryID) != stringValue(parentCategoryID) {
+		metadata["old_parent_category_id"] = category.ParentCategoryID
+		metadata["new_parent_category_id"] = parentCategoryID
+	}
+
+	category.Name = name
+	category.ParentCategoryID = parentCategoryID
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.CategoryModel.Update(ctx, tx, category); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &category.InventoryID, &userID, "category.updated", "category", &category.ID, metadata); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// DeleteCategory removes a category, lifting its subcategories and products up
+// to its parent.
+func (s *CategoryService) DeleteCategory(ctx context.Context, userID, id string) error {
+	category, err := s.authorizeCategory(ctx, userID, id, ActionCategoryDelete)
+	if err != nil {
+		return err
+	}
+
+	categories, err := s.CategoryModel.ListByInventory(ctx, category.InventoryID)
+	if err != nil {
+		return err
+	}
+	for _, child := range categories {
+		if child.ParentCategoryID == nil || *child.ParentCategoryID != category.ID {
+			continue
+		}
+		if hasSibling(categories, child.ID, child.Name, category.ParentCategoryID, category.ID) {
+			return fmt.Errorf("%w: %s", ErrCategoryNameTaken, child.Name)
+		}
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.CategoryModel.Delete(ctx, tx, category); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrCategoryNotFound
+		}
+		return err
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &category.InventoryID, &userID, "category.deleted", "category", &category.ID, map[string]interface{}{
+		"name":               category.Name,
+		"parent_category_id": category.ParentCategoryID,
+	}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CheckCategory ensures a category exists in the given inventory, so products
+// cannot be filed under another inventory's categories.
+func (s *CategoryService) CheckCategory(ctx context.Context, inventoryID, categoryID string) error {
+	category, err := s.CategoryModel.GetByID(ctx, categoryID)
+	if err != nil {
+		return err
+	}
+	if category == nil || category.InventoryID != inventoryID {
+		return fmt.Errorf("%w: category not found in this inventory", ErrInvalidInput)
+	}
+	return nil
+}
+
+func (s *CategoryService) authorizeCategory(ctx context.Context, userID, id string, action Action) (*models.Category, error) {
+	category, err := s.CategoryModel.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, ErrCategoryNotFound
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, category.InventoryID, action); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// checkPlacement validates putting a category called name beneath parentID.
+// The parent must belong to the same inventory, must not be the category
+// itself or one of its descendants, and must not already have a child with
+// the same name.
+func checkPlacement(categories []*models.Category, id, name string, parentID *string) error {
+	byID := make(map[string]*models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+
+	if parentID != nil {
+		if _, ok := byID[*parentID]; !ok {
+			return fmt.Errorf("%w: parent category not found in this inventory", ErrInvalidInput)
+		}
+		if id != "" {
+			// Walk up from the new parent; reaching the category means the
+			// move would make it its own ancestor.
+			for current := parentID; current != nil; {
+				if *current == id {
+					return ErrCategoryCycle
+				}
+				parent, ok := byID[*current]
+				if !ok {
+					break
+				}
+				current = parent.ParentCategoryID
+			}
+		}
+	}
+
+	if hasSibling(categories, id, name, parentID, "") {
+		return ErrCategoryNameTaken
+	}
+	return nil
+}
+
+// hasSibling reports whether another category under parentID, other than id
+// and skip, already uses name.
+func hasSibling(categories []*models.Category, id, name string, parentID *string, skip string) bool {
+	for _, c := range categories {
+		if c.ID == id || c.ID == skip {
+			continue
+		}
+		if stringValue(c.ParentCategoryID) == stringValue(parentID) && strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeParent(parentID *string) *string {
+	if parentID == nil || *parentID == "" {
+		return nil
+	}
+	return parentID
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -8,11 +8,16 @@ import (
 	"ukoni/internal/models"
 )
 
+var (
+	ErrConsumptionNotFound = errors.New("consumption event not found")
+)
+
 type ConsumptionService struct {
-	DB                 *sql.DB
-	ConsumptionModel   *models.ConsumptionModel
-	MembershipModel    *models.MembershipModel
-	ActivityLogService *ActivityLogService
+	DB                      *sql.DB
+	ConsumptionModel        *models.ConsumptionModel
+	Authorizer              *Authorizer
+	ActivityLogService      *ActivityLogService
+	InventoryProductService *InventoryProductService
 }
 
 type CreateConsumptionInput struct {
@@ -27,17 +32,9 @@ type CreateConsumptionInput struct {
 }
 
 func (s *ConsumptionService) CreateConsumption(ctx context.Context, input CreateConsumptionInput) (*models.ConsumptionEvent, error) {
-	// Validate membership
-	member, err := s.MembershipModel.GetMembership(input.InventoryID, input.CreatedByUserID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("user is not a member of this inventory")
-		}
+	if err := s.Authorizer.Authorize(ctx, input.CreatedByUserID, input.InventoryID, ActionConsumptionCreate); err != nil {
 		return nil, err
 	}
-	if member == nil {
-		return nil, errors.New("user is not a member of this inventory")
-	}
 
 	event := &models.ConsumptionEvent{
 		InventoryID:        input.InventoryID,
@@ -64,11 +61,30 @@ func (s *ConsumptionService) CreateConsumption(ctx context.Context, input Create
 		return nil, err
 	}
 
+	// Draw the consumed quantity down from stock, oldest first
+	var unallocated float64
+	if event.CanonicalProductID != nil && event.Quantity != nil && *event.Quantity > 0 {
+		allocations, remaining, err := s.InventoryProductService.DrawDown(ctx, tx, event.InventoryID, *event.CanonicalProductID, *event.Quantity, event.Unit)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range allocations {
+			a.ConsumptionEventID = event.ID
+			if err := s.ConsumptionModel.CreateAllocation(ctx, tx, a); err != nil {
+				return nil, err
+			}
+		}
+		event.Allocations = allocations
+		unallocated = remaining
+	}
+
 	if err := s.ActivityLogService.LogActivity(ctx, tx, &input.InventoryID, &input.CreatedByUserID, "consumption.created", "consumption_event", &event.ID, map[string]interface{}{
 		"canonical_product_id": input.CanonicalProductID,
 		"quantity":             input.Quantity,
 		"unit":                 input.Unit,
-		"source":               input.Source,
+		"source":               event.Source,
+		"allocations":          allocationMetadata(event.Allocations),
+		"unallocated_quantity": unallocated,
 	}); err != nil {
 		return nil, err
 	}
@@ -81,17 +97,73 @@ func (s *ConsumptionService) CreateConsumption(ctx context.Context, input Create
 }
 
 func (s *ConsumptionService) ListConsumptionEvents(ctx context.Context, inventoryID, userID string, limit, offset int) ([]*models.ConsumptionEvent, error) {
-	// Validate membership
-	member, err := s.MembershipModel.GetMembership(inventoryID, userID)
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionConsumptionView); err != nil {
+		return nil, err
+	}
+
+	return s.ConsumptionModel.List(ctx, inventoryID, limit, offset)
+}
+
+// DeleteConsumption soft-deletes a consumption event and returns the stock it
+// drew down to the inventory products it was taken from.
+func (s *ConsumptionService) DeleteConsumption(ctx context.Context, eventID, userID string) error {
+	event, err := s.ConsumptionModel.GetByID(ctx, eventID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user is not a member of this inventory")
+			return ErrConsumptionNotFound
 		}
-		return nil, err
+		return err
 	}
-	if member == nil {
-		return nil, errors.New("user is not a member of this inventory")
+
+	if err := s.Authorizer.Authorize(ctx, userID, event.InventoryID, ActionConsumptionDelete); err != nil {
+		return err
 	}
 
-	return s.ConsumptionModel.List(ctx, inventoryID, limit, offset)
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	allocations, err := s.ConsumptionModel.ListAllocations(ctx, tx, event.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.InventoryProductService.RestoreAllocations(ctx, tx, allocations); err != nil {
+		return err
+	}
+
+	if err := s.ConsumptionModel.ReverseAllocations(ctx, tx, event.ID); err != nil {
+		return err
+	}
+
+	if err := s.ConsumptionModel.Delete(ctx, tx, event.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrConsumptionNotFound
+		}
+		return err
+	}
+
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &event.InventoryID, &userID, "consumption.deleted", "consumption_event", &event.ID, map[string]interface{}{
+		"restored_allocations": allocationMetadata(allocations),
+	}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func allocationMetadata(allocations []*models.ConsumptionAllocation) []map[string]interface{} {
+	metadata := make([]map[string]interface{}, 0, len(allocations))
+	for _, a := range allocations {
+		metadata = append(metadata, map[string]interface{}{
+			"inventory_product_id": a.InventoryProductID,
+			"product_variant_id":   a.ProductVariantID,
+			"quantity":             a.Quantity,
+			"unit":                 a.Unit,
+			"confidence":           a.Confidence,
+		})
+	}
+	return metadata
 }
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error is an error as API clients see it: a stable code to branch on, a
+// message that is safe to show, the HTTP status to respond with and, for some
+// errors, details about what went wrong.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+
+	// RetryAfter tells a client that has been throttled when to try again.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError creates an Error that is reported to clients as is.
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest reports a request that could not be understood, such as a body
+// that isn't valid JSON or a missing path parameter.
+func BadRequest(message string) *Error {
+	return NewError(http.StatusBadRequest, "bad_request", message)
+}
+
+// TooManyRequests reports a client that must wait before trying again.
+func TooManyRequests(code, message string, retryAfter time.Duration) *Error {
+	return &Error{Status: http.StatusTooManyRequests, Code: code, Message: message, RetryAfter: retryAfter}
+}
+
+var (
+	ErrUnauthorized = NewError(http.StatusUnauthorized, "unauthorized", "authentication required")
+	ErrInternal     = NewError(http.StatusInternalServerError, "internal", "internal server error")
+)
+
+// errorMappings gives each service error its status and code. It is the one
+// place that decides how errors are reported; handlers pass errors through
+// unchanged.
+var errorMappings = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrInvalidInput, http.StatusBadRequest, "invalid_input"},
+	{ErrForbidden, http.StatusForbidden, "forbidden"},
+	{ErrNotFound, http.StatusNotFound, "not_found"},
+	{sql.ErrNoRows, http.StatusNotFound, "not_found"},
+
+	{ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{ErrIncorrectPassword, http.StatusForbidden, "incorrect_password"},
+	{ErrInvalidRefreshToken, http.StatusUnauthorized, "invalid_refresh_token"},
+	{ErrRefreshTokenReused, http.StatusUnauthorized, "refresh_token_reused"},
+	{ErrSessionNotFound, http.StatusNotFound, "session_not_found"},
+	{ErrReauthenticationRequired, http.StatusForbidden, "reauthentication_required"},
+	{ErrAPIKeyNotFound, http.StatusNotFound, "api_key_not_found"},
+	{ErrInvalidAPIKey, http.StatusUnauthorized, "invalid_api_key"},
+	{ErrInvalidResetToken, http.StatusBadRequest, "invalid_reset_token"},
+	{ErrInvalidVerificationToken, http.StatusBadRequest, "invalid_verification_token"},
+	{ErrEmailAlreadyVerified, http.StatusConflict, "email_already_verified"},
+	{ErrEmailNotVerified, http.StatusForbidden, "email_not_verified"},
+	{ErrOIDCProviderNotFound, http.StatusNotFound, "provider_not_found"},
+	{ErrOIDCLoginFailed, http.StatusUnauthorized, "provider_login_failed"},
+	{ErrOIDCEmailUnverified, http.StatusForbidden, "provider_email_unverified"},
+	{ErrOIDCAccountExists, http.StatusConflict, "account_exists"},
+
+	{ErrInviteNotFound, http.StatusNotFound, "invitation_not_found"},
+	{ErrInvitationNotPending, http.StatusConflict, "invitation_not_pending"},
+	{ErrInvitationExpired, http.StatusGone, "invitation_expired"},
+	{ErrInvalidInvitationToken, http.StatusForbidden, "invalid_invitation_token"},
+	{ErrInvitationEmailMismatch, http.StatusForbidden, "invitation_email_mismatch"},
+	{ErrAlreadyMember, http.StatusConflict, "already_member"},
+	{ErrMemberNotFound, http.StatusNotFound, "member_not_found"},
+	{ErrLastAdmin, http.StatusConflict, "last_admin"},
+	{ErrOwnerMembership, http.StatusConflict, "owner_membership"},
+	{ErrInventoryArchived, http.StatusConflict, "inventory_archived"},
+	{ErrTransferNotFound, http.StatusNotFound, "transfer_not_found"},
+
+	{ErrCategoryNotFound, http.StatusNotFound, "category_not_found"},
+	{ErrCategoryCycle, http.StatusBadRequest, "category_cycle"},
+	{ErrCategoryNameTaken, http.StatusConflict, "category_name_taken"},
+	{ErrVariantNotFound, http.StatusNotFound, "variant_not_found"},
+	{ErrVariantInUse, http.StatusConflict, "variant_in_use"},
+	{ErrUnknownUnit, http.StatusBadRequest, "unknown_unit"},
+	{ErrNoConversion, http.StatusUnprocessableEntity, "no_conversion"},
+	{ErrUnitConversionNotFound, http.StatusNotFound, "unit_conversion_not_found"},
+	{ErrUnitConversionExists, http.StatusConflict, "unit_conversion_exists"},
+	{ErrStockNotFound, http.StatusNotFound, "stock_not_found"},
+	{ErrStockConsumed, http.StatusConflict, "stock_consumed"},
+	{ErrStockRemoved, http.StatusConflict, "stock_removed"},
+	{ErrTransactionNotFound, http.StatusNotFound, "transaction_not_found"},
+	{ErrConsumptionNotFound, http.StatusNotFound, "consumption_not_found"},
+	{ErrShoppingListNotFound, http.StatusNotFound, "shopping_list_not_found"},
+	{ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+}
+
+// ToError converts err into the Error reported to clients. Errors without a
+// mapping are internal: ToError returns ErrInternal and false, and the caller
+// should log the original error rather than show it.
+func ToError(err error) (*Error, bool) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr, apiErr.Status < http.StatusInternalServerError
+	}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		status := http.StatusBadRequest
+		if verr.Has(CodeTaken) {
+			status = http.StatusConflict
+		}
+		return &Error{Status: status, Code: "validation_failed", Message: "some fields are invalid", Details: verr.Errors}, true
+	}
+
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			return &Error{Status: m.status, Code: m.code, Message: clientMessage(err, m.err)}, true
+		}
+	}
+
+	return ErrInternal, false
+}
+
+// clientMessage is the message reported for err, which wraps the mapped
+// error target. Services add detail as "<target>: <detail>", and that is
+// kept; anything else in the chain, such as database errors wrapped on the
+// way up, is dropped in favour of the target's own message.
+func clientMessage(err, target error) string {
+	if target == sql.ErrNoRows {
+		return ErrNotFound.Error()
+	}
+	message := target.Error()
+	if text := err.Error(); strings.HasPrefix(text, message+": ") {
+		return text
+	}
+	return message
+}
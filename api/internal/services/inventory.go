@@ -3,7 +3,8 @@ package services
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"strings"
+	"time"
 	"ukoni/internal/models"
 )
 
@@ -11,12 +12,37 @@ type InventoryService struct {
 	DB                 *sql.DB
 	InventoryModel     *models.InventoryModel
 	MembershipModel    *models.MembershipModel
+	UserModel          *models.UserModel
+	TransferModel      *models.InventoryTransferModel
+	Authorizer         *Authorizer
 	ActivityLogService *ActivityLogService
+
+	// RequireVerifiedEmail stops users creating inventories before they
+	// have verified their email.
+	RequireVerifiedEmail bool
 }
 
 func (s *InventoryService) CreateInventory(ctx context.Context, userID, name string) (*models.Inventory, error) {
-	if name == "" {
-		return nil, errors.New("inventory name cannot be empty")
+	name = strings.TrimSpace(name)
+	v := &ValidationError{}
+	validateName(v, "name", name)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	// API keys limited to one inventory or to reading can't create more.
+	if key := apiKeyFromContext(ctx); key != nil && (key.InventoryID != nil || key.Scope == APIKeyScopeRead) {
+		return nil, ErrForbidden
+	}
+
+	if s.RequireVerifiedEmail {
+		user, err := s.UserModel.GetByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := requireVerifiedEmail(true, user); err != nil {
+			return nil, err
+		}
 	}
 
 	tx, err := s.DB.BeginTx(ctx, nil)
@@ -53,10 +79,169 @@ func (s *InventoryService) CreateInventory(ctx context.Context, userID, name str
 	return inventory, nil
 }
 
-func (s *InventoryService) GetInventory(id string) (*models.Inventory, error) {
-	return s.InventoryModel.GetByID(id)
+// GetInventory returns an inventory the user belongs to.
+func (s *InventoryService) GetInventory(ctx context.Context, userID, inventoryID string) (*models.Inventory, error) {
+	access, err := s.Authorizer.Require(ctx, userID, inventoryID, ActionInventoryView)
+	if err != nil {
+		return nil, err
+	}
+	return access.Inventory, nil
 }
 
-func (s *InventoryService) ListInventories(userID string) ([]*models.Inventory, error) {
-	return s.InventoryModel.ListByUserID(userID)
+// ListInventories lists the inventories a user belongs to, with their role,
+// member count and latest activity, or only the one their API key is limited
+// to.
+func (s *InventoryService) ListInventories(ctx context.Context, userID string) ([]*models.InventorySummary, error) {
+	inventories, err := s.InventoryModel.ListForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := apiKeyFromContext(ctx)
+	if key == nil || key.InventoryID == nil {
+		return inventories, nil
+	}
+	filtered := []*models.InventorySummary{}
+	for _, inv := range inventories {
+		if inv.ID == *key.InventoryID {
+			filtered = append(filtered, inv)
+		}
+	}
+	return filtered, nil
+}
+
+// UpdateInventoryInput holds the inventory fields to change; nil fields are
+// left alone.
+type UpdateInventoryInput struct {
+	Name *string
+}
+
+// UpdateInventory renames an inventory.
+func (s *InventoryService) UpdateInventory(ctx context.Context, userID, inventoryID string, input UpdateInventoryInput) (*models.Inventory, error) {
+	access, err := s.Authorizer.Require(ctx, userID, inventoryID, ActionInventoryUpdate)
+	if err != nil {
+		return nil, err
+	}
+	inventory := access.Inventory
+	if input.Name == nil {
+		return inventory, nil
+	}
+
+	name := strings.TrimSpace(*input.Name)
+	v := &ValidationError{}
+	validateName(v, "name", name)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if name == inventory.Name {
+		return inventory, nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.InventoryModel.Rename(ctx, tx, inventoryID, name); err != nil {
+		return nil, err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, "inventory.updated", "inventory", &inventoryID, map[string]interface{}{
+			"old_name": inventory.Name,
+			"new_name": name,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	inventory.Name = name
+	return inventory, nil
+}
+
+// ArchiveInventory makes an inventory read-only for every member.
+func (s *InventoryService) ArchiveInventory(ctx context.Context, userID, inventoryID string) (*models.Inventory, error) {
+	return s.setArchived(ctx, userID, inventoryID, true)
+}
+
+// UnarchiveInventory makes an archived inventory editable again.
+func (s *InventoryService) UnarchiveInventory(ctx context.Context, userID, inventoryID string) (*models.Inventory, error) {
+	return s.setArchived(ctx, userID, inventoryID, false)
+}
+
+func (s *InventoryService) setArchived(ctx context.Context, userID, inventoryID string, archived bool) (*models.Inventory, error) {
+	access, err := s.Authorizer.Require(ctx, userID, inventoryID, ActionInventoryArchive)
+	if err != nil {
+		return nil, err
+	}
+	inventory := access.Inventory
+	if (inventory.ArchivedAt != nil) == archived {
+		return inventory, nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	action := "inventory.archived"
+	if archived {
+		now := time.Now()
+		err = s.InventoryModel.Archive(ctx, tx, inventoryID, now)
+		inventory.ArchivedAt = &now
+	} else {
+		action = "inventory.unarchived"
+		err = s.InventoryModel.Unarchive(ctx, tx, inventoryID)
+		inventory.ArchivedAt = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, action, "inventory", &inventoryID, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// DeleteInventory soft deletes an inventory along with its products,
+// shopping lists and stock. Only the owner can delete an inventory.
+func (s *InventoryService) DeleteInventory(ctx context.Context, userID, inventoryID string) error {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionInventoryDelete); err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := s.TransferModel.CancelPending(ctx, tx, inventoryID, now); err != nil {
+		return err
+	}
+	if err := s.InventoryModel.SoftDelete(ctx, tx, inventoryID, now); err != nil {
+		return err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, "inventory.deleted", "inventory", &inventoryID, nil); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
@@ -2,42 +2,415 @@ package services
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"ukoni/internal/database"
 	"ukoni/internal/models"
 )
 
+var (
+	ErrStockNotFound = errors.New("stock not found")
+	ErrStockConsumed = errors.New("stock from this transaction has already been used")
+	ErrStockRemoved  = errors.New("stock this was drawn from has since been removed")
+)
+
 type InventoryProductService struct {
-	InventoryProductModel *models.InventoryProductModel
-	ProductModel          *models.ProductModel
+	DB                       *sql.DB
+	InventoryProductModel    *models.InventoryProductModel
+	InventoryAdjustmentModel *models.InventoryAdjustmentModel
+	ProductModel             *models.ProductModel
+	CanonicalProductModel    *models.CanonicalProductModel
+	UnitService              *UnitService
+	Authorizer               *Authorizer
+	ActivityLogService       *ActivityLogService
+}
+
+type AdjustStockInput struct {
+	InventoryID      string
+	ProductVariantID string
+	UserID           string
+	Type             string
+	Quantity         float64
+	Note             *string
 }
 
 func (s *InventoryProductService) UpdateFromTransaction(ctx context.Context, dbtx database.DBTX, transaction *models.Transaction, items []*models.TransactionItem) error {
 	for _, item := range items {
-		// Fetch variant
-		variant, err := s.ProductModel.GetVariant(ctx, item.ProductVariantID)
+		variant, qtyChange, err := s.transactionItemStock(ctx, item)
 		if err != nil {
-			return fmt.Errorf("failed to get variant %s: %w", item.ProductVariantID, err)
+			return err
 		}
-		if variant == nil {
-			// Skip unknown variants, or should this be an error?
-			// For data integrity, it should probably be an error, but if it was soft deleted during transaction?
-			// Let's error.
-			return fmt.Errorf("variant %s not found", item.ProductVariantID)
+
+		// Update inventory
+		_, err = s.InventoryProductModel.Upsert(ctx, dbtx, transaction.InventoryID, item.ProductVariantID, qtyChange, variant.Unit)
+		if err != nil {
+			return fmt.Errorf("failed to upsert inventory product: %w", err)
 		}
+	}
+	return nil
+}
 
-		// Calculate quantity to add
-		// Inventory Quantity = Item Quantity * (Variant Size if present else 1)
-		qtyChange := item.Quantity
-		if variant.Size != nil {
-			qtyChange = item.Quantity * (*variant.Size)
+// ReverseTransaction takes back the stock that items of a transaction added.
+// It fails with ErrStockConsumed rather than leave stock negative when some
+// of it has since been used or adjusted away.
+func (s *InventoryProductService) ReverseTransaction(ctx context.Context, dbtx database.DBTX, transaction *models.Transaction, items []*models.TransactionItem) error {
+	for _, item := range items {
+		_, qtyChange, err := s.transactionItemStock(ctx, item)
+		if err != nil {
+			return err
 		}
 
-		// Update inventory
-		err = s.InventoryProductModel.Upsert(ctx, dbtx, transaction.InventoryID, item.ProductVariantID, qtyChange, variant.Unit)
+		stock, err := s.InventoryProductModel.GetForUpdate(ctx, dbtx, transaction.InventoryID, item.ProductVariantID)
 		if err != nil {
-			return fmt.Errorf("failed to upsert inventory product: %w", err)
+			return err
+		}
+		if stock == nil || roundQuantity(stock.Quantity-qtyChange) < 0 {
+			return fmt.Errorf("%w: variant %s", ErrStockConsumed, item.ProductVariantID)
+		}
+
+		if err := s.InventoryProductModel.AdjustQuantity(ctx, dbtx, stock.ID, -qtyChange); err != nil {
+			return fmt.Errorf("failed to debit inventory product %s: %w", stock.ID, err)
 		}
 	}
 	return nil
 }
+
+// transactionItemStock returns the variant bought by a transaction item and
+// the stock it amounts to: the item quantity times the variant size, if any.
+func (s *InventoryProductService) transactionItemStock(ctx context.Context, item *models.TransactionItem) (*models.ProductVariant, float64, error) {
+	variant, err := s.ProductModel.GetVariant(ctx, item.ProductVariantID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get variant %s: %w", item.ProductVariantID, err)
+	}
+	if variant == nil {
+		return nil, 0, fmt.Errorf("%w: variant %s not found", ErrInvalidInput, item.ProductVariantID)
+	}
+
+	qtyChange := item.Quantity
+	if variant.Size != nil {
+		qtyChange = item.Quantity * (*variant.Size)
+	}
+	return variant, qtyChange, nil
+}
+
+// DrawDown debits quantity of a canonical product from the inventory, taking
+// from the oldest stock first. The quantity is converted into each stock row's
+// unit, so 250 g can be taken from stock held in kg. It returns the allocations
+// made and any amount, in the requested unit, that could not be covered.
+func (s *InventoryProductService) DrawDown(ctx context.Context, dbtx database.DBTX, inventoryID, canonicalProductID string, quantity float64, unit *string) ([]*models.ConsumptionAllocation, float64, error) {
+	stock, err := s.InventoryProductModel.ListForCanonicalProduct(ctx, dbtx, inventoryID, canonicalProductID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list stock: %w", err)
+	}
+
+	graph, err := s.UnitService.Graph(ctx, canonicalProductID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load unit conversions: %w", err)
+	}
+
+	remaining := quantity
+	var allocations []*models.ConsumptionAllocation
+	for _, ip := range stock {
+		if remaining <= 0 {
+			break
+		}
+
+		conversion, err := convertStock(graph, remaining, unit, ip.Unit)
+		if err != nil {
+			if errors.Is(err, ErrUnknownUnit) || errors.Is(err, ErrNoConversion) {
+				continue
+			}
+			return nil, 0, err
+		}
+
+		take := conversion.Quantity
+		if take > ip.Quantity {
+			take = ip.Quantity
+		}
+
+		if err := s.InventoryProductModel.AdjustQuantity(ctx, dbtx, ip.ID, -take); err != nil {
+			return nil, 0, fmt.Errorf("failed to debit inventory product %s: %w", ip.ID, err)
+		}
+
+		allocations = append(allocations, &models.ConsumptionAllocation{
+			InventoryProductID: ip.ID,
+			ProductVariantID:   ip.ProductVariantID,
+			Quantity:           take,
+			Unit:               ip.Unit,
+			Confidence:         conversion.Confidence,
+		})
+		if take == conversion.Quantity {
+			remaining = 0
+		} else {
+			remaining = roundQuantity(remaining - take/conversion.Factor)
+		}
+	}
+
+	return allocations, remaining, nil
+}
+
+// RestoreAllocations credits previously drawn-down stock back to the
+// inventory. It fails with ErrStockRemoved when a stock row has since been
+// deleted, rather than credit stock nobody can see.
+func (s *InventoryProductService) RestoreAllocations(ctx context.Context, dbtx database.DBTX, allocations []*models.ConsumptionAllocation) error {
+	for _, a := range allocations {
+		if err := s.InventoryProductModel.AdjustQuantity(ctx, dbtx, a.InventoryProductID, a.Quantity); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%w: inventory product %s", ErrStockRemoved, a.InventoryProductID)
+			}
+			return fmt.Errorf("failed to restore inventory product %s: %w", a.InventoryProductID, err)
+		}
+	}
+	return nil
+}
+
+// convertStock converts quantity from one unit to another. A missing unit on
+// either side is taken to mean the quantities are already comparable.
+func convertStock(graph *UnitGraph, quantity float64, from, to *string) (*Conversion, error) {
+	if from == nil || to == nil {
+		return &Conversion{FromQuantity: quantity, Quantity: quantity, Factor: 1, Confidence: 1}, nil
+	}
+	return graph.Convert(quantity, *from, *to)
+}
+
+func (s *InventoryProductService) ListStock(ctx context.Context, inventoryID, userID string, filter models.StockFilter, limit, offset int) ([]*models.StockItem, error) {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionStockView); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.InventoryProductModel.ListStock(ctx, inventoryID, filter, limit, offset)
+}
+
+// StockTotal is the stock of a canonical product summed across its variants
+// in a single unit. Rows whose unit cannot be converted are listed separately
+// rather than guessed at.
+type StockTotal struct {
+	CanonicalProductID string              `json:"canonical_product_id"`
+	Quantity           float64             `json:"quantity"`
+	Unit               *string             `json:"unit,omitempty"`
+	Confidence         float64             `json:"confidence"`
+	Items              []*models.StockItem `json:"items"`
+	Unconverted        []*models.StockItem `json:"unconverted"`
+}
+
+// GetStockTotal aggregates the stock of a canonical product into unit, or into
+// the unit of its oldest stock when unit is empty.
+func (s *InventoryProductService) GetStockTotal(ctx context.Context, userID, canonicalProductID, unit string) (*StockTotal, error) {
+	product, err := s.CanonicalProductModel.GetByID(ctx, canonicalProductID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, product.InventoryID, ActionStockView); err != nil {
+		return nil, err
+	}
+
+	items, err := s.InventoryProductModel.ListStockByCanonicalProduct(ctx, product.InventoryID, product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := s.UnitService.Graph(ctx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	total := &StockTotal{
+		CanonicalProductID: product.ID,
+		Confidence:         1,
+		Items:              []*models.StockItem{},
+		Unconverted:        []*models.StockItem{},
+	}
+	if unit != "" {
+		if !graph.Knows(unit) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownUnit, unit)
+		}
+		key := unitKey(unit)
+		total.Unit = &key
+	} else {
+		for _, item := range items {
+			if item.Unit != nil {
+				key := unitKey(*item.Unit)
+				total.Unit = &key
+				break
+			}
+		}
+	}
+
+	for _, item := range items {
+		conversion, err := convertStock(graph, item.Quantity, item.Unit, total.Unit)
+		if err != nil {
+			if errors.Is(err, ErrUnknownUnit) || errors.Is(err, ErrNoConversion) {
+				total.Unconverted = append(total.Unconverted, item)
+				continue
+			}
+			return nil, err
+		}
+		total.Quantity += conversion.Quantity
+		if conversion.Confidence < total.Confidence {
+			total.Confidence = conversion.Confidence
+		}
+		total.Items = append(total.Items, item)
+	}
+	total.Quantity = roundQuantity(total.Quantity)
+
+	return total, nil
+}
+
+func (s *InventoryProductService) GetStock(ctx context.Context, inventoryID, productVariantID, userID string) (*models.StockItem, error) {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionStockView); err != nil {
+		return nil, err
+	}
+	item, err := s.InventoryProductModel.GetStock(ctx, inventoryID, productVariantID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrStockNotFound
+	}
+	return item, nil
+}
+
+func (s *InventoryProductService) ListAdjustments(ctx context.Context, inventoryID, productVariantID, userID string, limit, offset int) ([]*models.InventoryAdjustment, error) {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionStockView); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.InventoryAdjustmentModel.ListByVariant(ctx, inventoryID, productVariantID, limit, offset)
+}
+
+// AdjustStock applies a manual stock change. A stock-take records the counted
+// quantity, spoilage removes stock, a gift adds stock and a correction applies
+// a signed change. Every adjustment is recorded rather than overwriting stock.
+func (s *InventoryProductService) AdjustStock(ctx context.Context, input AdjustStockInput) (*models.InventoryAdjustment, error) {
+	switch input.Type {
+	case "stock_take":
+		if input.Quantity < 0 {
+			return nil, fmt.Errorf("%w: counted quantity cannot be negative", ErrInvalidInput)
+		}
+	case "spoilage", "gift":
+		if input.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidInput)
+		}
+	case "correction":
+		if input.Quantity == 0 {
+			return nil, fmt.Errorf("%w: quantity must not be zero", ErrInvalidInput)
+		}
+	default:
+		return nil, fmt.Errorf("%w: adjustment type must be one of stock_take, spoilage, gift, correction", ErrInvalidInput)
+	}
+
+	if err := s.Authorizer.Authorize(ctx, input.UserID, input.InventoryID, ActionStockAdjust); err != nil {
+		return nil, err
+	}
+
+	variant, err := s.ProductModel.GetVariant(ctx, input.ProductVariantID)
+	if err != nil {
+		return nil, err
+	}
+	if variant == nil {
+		return nil, fmt.Errorf("%w: variant not found in this inventory", ErrInvalidInput)
+	}
+	product, err := s.ProductModel.GetByID(ctx, variant.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil || product.InventoryID != input.InventoryID {
+		return nil, fmt.Errorf("%w: variant not found in this inventory", ErrInvalidInput)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := s.InventoryProductModel.GetForUpdate(ctx, tx, input.InventoryID, input.ProductVariantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var before float64
+	unit := variant.Unit
+	if current != nil {
+		before = current.Quantity
+		if current.Unit != nil {
+			unit = current.Unit
+		}
+	}
+
+	var change float64
+	switch input.Type {
+	case "stock_take":
+		change = input.Quantity - before
+	case "spoilage":
+		change = -input.Quantity
+	default:
+		change = input.Quantity
+	}
+
+	after := before + change
+	if after < 0 {
+		return nil, fmt.Errorf("%w: adjustment would leave negative stock", ErrInvalidInput)
+	}
+
+	var inventoryProductID string
+	if current == nil {
+		inventoryProductID, err = s.InventoryProductModel.Upsert(ctx, tx, input.InventoryID, input.ProductVariantID, change, unit)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		inventoryProductID = current.ID
+		if err := s.InventoryProductModel.AdjustQuantity(ctx, tx, current.ID, change); err != nil {
+			return nil, err
+		}
+	}
+
+	adjustment := &models.InventoryAdjustment{
+		InventoryID:        input.InventoryID,
+		InventoryProductID: inventoryProductID,
+		ProductVariantID:   input.ProductVariantID,
+		AdjustmentType:     input.Type,
+		QuantityChange:     change,
+		QuantityBefore:     before,
+		QuantityAfter:      after,
+		Unit:               unit,
+		Note:               input.Note,
+		CreatedByUserID:    input.UserID,
+	}
+	if err := s.InventoryAdjustmentModel.Create(ctx, tx, adjustment); err != nil {
+		return nil, err
+	}
+
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &input.InventoryID, &input.UserID, "inventory_product.adjusted", "inventory_product", &inventoryProductID, map[string]interface{}{
+		"adjustment_id":      adjustment.ID,
+		"adjustment_type":    input.Type,
+		"product_variant_id": input.ProductVariantID,
+		"quantity_change":    change,
+		"quantity_before":    before,
+		"quantity_after":     after,
+		"unit":               unit,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return adjustment, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"ukoni/internal/models"
+)
+
+var ErrTransferNotFound = errors.New("ownership transfer not found")
+
+// TransferOwnership offers an inventory to one of its admins. Ownership only
+// moves once they accept; an earlier offer that is still open is cancelled.
+func (s *InventoryService) TransferOwnership(ctx context.Context, userID, inventoryID, toUserID string) (*models.InventoryTransfer, error) {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionInventoryTransfer); err != nil {
+		return nil, err
+	}
+
+	if toUserID == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidInput)
+	}
+	if toUserID == userID {
+		return nil, fmt.Errorf("%w: you already own this inventory", ErrInvalidInput)
+	}
+	target, err := s.Authorizer.Resolve(ctx, toUserID, inventoryID)
+	if err != nil && err != ErrForbidden {
+		return nil, err
+	}
+	if err == ErrForbidden || target.Role != RoleAdmin {
+		return nil, fmt.Errorf("%w: the new owner must be an admin of the inventory", ErrInvalidInput)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.TransferModel.CancelPending(ctx, tx, inventoryID, time.Now()); err != nil {
+		return nil, err
+	}
+	transfer := &models.InventoryTransfer{
+		InventoryID: inventoryID,
+		FromUserID:  userID,
+		ToUserID:    toUserID,
+	}
+	if err := s.TransferModel.Create(ctx, tx, transfer); err != nil {
+		return nil, err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, "inventory.transfer_requested", "inventory_transfer", &transfer.ID, map[string]interface{}{
+			"to_user_id": toUserID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// GetPendingTransfer returns the open ownership transfer of an inventory.
+func (s *InventoryService) GetPendingTransfer(ctx context.Context, userID, inventoryID string) (*models.InventoryTransfer, error) {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionInventoryView); err != nil {
+		return nil, err
+	}
+
+	transfer, err := s.TransferModel.GetPending(ctx, s.DB, inventoryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTransferNotFound
+		}
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// CancelTransfer withdraws the owner's open offer.
+func (s *InventoryService) CancelTransfer(ctx context.Context, userID, inventoryID string) error {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionInventoryTransfer); err != nil {
+		return err
+	}
+	return s.resolveTransfer(ctx, userID, inventoryID, models.TransferCancelled, func(*models.InventoryTransfer) error {
+		return nil
+	})
+}
+
+// AcceptTransfer makes the user the offer was made to the owner. The
+// previous owner stays on as an admin.
+func (s *InventoryService) AcceptTransfer(ctx context.Context, userID, inventoryID string) error {
+	return s.resolveTransfer(ctx, userID, inventoryID, models.TransferAccepted, func(t *models.InventoryTransfer) error {
+		if t.ToUserID != userID {
+			return ErrTransferNotFound
+		}
+		// The new owner may have been demoted since the offer was made.
+		access, err := s.Authorizer.Resolve(ctx, userID, inventoryID)
+		if err != nil {
+			return err
+		}
+		if access.Role != RoleAdmin {
+			return ErrForbidden
+		}
+		return nil
+	})
+}
+
+// DeclineTransfer turns the offer down, leaving ownership where it is.
+func (s *InventoryService) DeclineTransfer(ctx context.Context, userID, inventoryID string) error {
+	return s.resolveTransfer(ctx, userID, inventoryID, models.TransferDeclined, func(t *models.InventoryTransfer) error {
+		if t.ToUserID != userID {
+			return ErrTransferNotFound
+		}
+		return nil
+	})
+}
+
+// resolveTransfer closes an inventory's open transfer with status once check
+// passes, moving ownership if it was accepted.
+func (s *InventoryService) resolveTransfer(ctx context.Context, userID, inventoryID, status string, check func(*models.InventoryTransfer) error) error {
+	if !apiKeyAllows(ctx, inventoryID, ActionInventoryTransfer) {
+		return ErrForbidden
+	}
+
+	inventory, err := s.InventoryModel.GetByID(inventoryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTransferNotFound
+		}
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	transfer, err := s.TransferModel.GetPending(ctx, tx, inventoryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTransferNotFound
+		}
+		return err
+	}
+	if err := check(transfer); err != nil {
+		return err
+	}
+
+	// An offer made by someone who has since stopped owning the inventory
+	// is void; it is closed as cancelled whatever was asked for.
+	requested := status
+	if transfer.FromUserID != inventory.OwnerUserID {
+		status = models.TransferCancelled
+	}
+	if err := s.TransferModel.Resolve(ctx, tx, transfer, status, time.Now()); err != nil {
+		return err
+	}
+
+	action := "inventory.transfer_" + status
+	var metadata map[string]interface{}
+	if status == models.TransferAccepted {
+		if err := s.InventoryModel.SetOwner(ctx, tx, inventoryID, transfer.ToUserID); err != nil {
+			return err
+		}
+		action = "inventory.ownership_transferred"
+		metadata = map[string]interface{}{
+			"from_user_id": transfer.FromUserID,
+			"to_user_id":   transfer.ToUserID,
+		}
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, action, "inventory_transfer", &transfer.ID, metadata); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if status != requested {
+		return ErrTransferNotFound
+	}
+	return nil
+}
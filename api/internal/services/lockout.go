@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"time"
+	"ukoni/internal/models"
+)
+
+const (
+	// failedLoginWindow is how long a failed login counts towards a lockout.
+	failedLoginWindow = 24 * time.Hour
+	// maxLoginLockout caps how long repeated failures can lock an account.
+	maxLoginLockout = 24 * time.Hour
+)
+
+func accountLocked(retryAfter time.Duration) *Error {
+	return TooManyRequests("account_locked", "too many failed logins; try again later", retryAfter)
+}
+
+// recordFailedLogin counts a wrong password against user. Once there have
+// been LoginLockoutThreshold failures in a row the account is locked, for
+// longer with every further failure, and the returned duration says for how
+// long.
+func (s *AuthService) recordFailedLogin(ctx context.Context, user *models.User, client ClientInfo, now time.Time) (time.Duration, error) {
+	if s.LoginLockoutThreshold <= 0 {
+		return 0, nil
+	}
+
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	failures, err := s.UserModel.RecordFailedLogin(ctx, tx, user.ID, now.Add(-failedLoginWindow), now)
+	if err != nil {
+		return 0, err
+	}
+	if failures < s.LoginLockoutThreshold {
+		return 0, tx.Commit()
+	}
+
+	lockout := s.lockoutFor(failures)
+	until := now.Add(lockout)
+	if err := s.UserModel.LockUntil(ctx, tx, user.ID, until); err != nil {
+		return 0, err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &user.ID, "user.login_locked", "user", &user.ID, map[string]interface{}{
+			"failed_attempts": failures,
+			"locked_until":    until,
+			"user_agent":      client.UserAgent,
+			"ip_address":      client.IPAddress,
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	return lockout, tx.Commit()
+}
+
+// lockoutFor is LoginLockoutBase at the threshold, doubling for each failure
+// beyond it.
+func (s *AuthService) lockoutFor(failures int) time.Duration {
+	base := s.LoginLockoutBase
+	if base <= 0 {
+		base = time.Minute
+	}
+
+	lockout := base
+	for i := s.LoginLockoutThreshold; i < failures; i++ {
+		lockout *= 2
+		if lockout >= maxLoginLockout {
+			return maxLoginLockout
+		}
+	}
+	return lockout
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"ukoni/internal/models"
+	"ukoni/internal/oidc"
+)
+
+// oidcLoginTTL is how long a user has to finish logging in at a provider.
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	ErrOIDCProviderNotFound = errors.New("login provider not found")
+	ErrOIDCLoginFailed      = errors.New("login with provider failed")
+	ErrOIDCEmailUnverified  = errors.New("the provider has not verified this email address")
+	ErrOIDCAccountExists    = errors.New("an account with this email exists but its email is not verified; log in with your password and verify it first")
+)
+
+// OIDCService logs users in through external OpenID Connect providers.
+// Provider accounts are linked to users by their stable subject; the first
+// login links to the user with the same, verified, email or creates one.
+type OIDCService struct {
+	Providers          map[string]*oidc.Provider
+	UserModel          *models.UserModel
+	IdentityModel      *models.UserIdentityModel
+	LoginModel         *models.OIDCLoginModel
+	AuthService        *AuthService
+	ActivityLogService *ActivityLogService
+}
+
+// OIDCLogin is the outcome of logging in through a provider.
+type OIDCLogin struct {
+	User   *models.User
+	Tokens *TokenPair
+
+	// Created is set when the login made a new account.
+	Created bool
+}
+
+// ListProviders returns the names of the providers users can log in with.
+func (s *OIDCService) ListProviders() []string {
+	names := make([]string, 0, len(s.Providers))
+	for name := range s.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartLogin begins a login at a provider and returns the page to send the
+// user to.
+func (s *OIDCService) StartLogin(ctx context.Context, providerName string) (string, error) {
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return "", ErrOIDCProviderNotFound
+	}
+
+	state, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := s.LoginModel.DeleteExpired(ctx, s.LoginModel.DB, now); err != nil {
+		return "", err
+	}
+	if err := s.LoginModel.Create(ctx, s.LoginModel.DB, &models.OIDCLoginAttempt{
+		Provider:     providerName,
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    now.Add(oidcLoginTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	return provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+}
+
+// FinishLogin completes a login with the code and state the provider sent
+// the user back with, and starts a session.
+func (s *OIDCService) FinishLogin(ctx context.Context, providerName, code, state string, client ClientInfo) (*OIDCLogin, error) {
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	v := &ValidationError{}
+	if code == "" {
+		v.Add("code", CodeRequired, "code is required")
+	}
+	if state == "" {
+		v.Add("state", CodeRequired, "state is required")
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	// The attempt is used up outside the login transaction so a failed
+	// login can't be retried with the same state.
+	attempt, err := s.LoginModel.Use(ctx, s.LoginModel.DB, providerName, hashToken(state), time.Now())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOIDCLoginFailed
+		}
+		return nil, err
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, attempt.CodeVerifier)
+	if err != nil {
+		if errors.Is(err, oidc.ErrCodeRejected) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			return nil, ErrOIDCLoginFailed
+		}
+		return nil, err
+	}
+	claims, err := provider.Verify(ctx, rawIDToken, attempt.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidIDToken) {
+			return nil, ErrOIDCLoginFailed
+		}
+		return nil, err
+	}
+
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	login := &OIDCLogin{}
+	var email *string
+	if claims.Email != "" {
+		normalised := NormalizeEmail(claims.Email)
+		email = &normalised
+	}
+
+	identity, err := s.IdentityModel.GetByProviderSubject(ctx, tx, providerName, claims.Subject)
+	switch {
+	case err == nil:
+		login.User, err = s.UserModel.GetByID(identity.UserID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, ErrOIDCLoginFailed
+			}
+			return nil, err
+		}
+		if err := s.IdentityModel.MarkUsed(ctx, tx, identity.ID, email, now); err != nil {
+			return nil, err
+		}
+	case err == sql.ErrNoRows:
+		login.User, login.Created, err = s.linkUser(ctx, tx, providerName, claims, now)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	login.Tokens, err = s.AuthService.StartSession(ctx, tx, login.User.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// linkUser links a provider account seen for the first time to the user
+// with its email, creating the user if there isn't one. Only emails both
+// sides have verified are trusted: linking to an unverified account would
+// hand it to whoever registered the address first.
+func (s *OIDCService) linkUser(ctx context.Context, tx *sql.Tx, providerName string, claims *oidc.Claims, now time.Time) (*models.User, bool, error) {
+	email := NormalizeEmail(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return nil, false, ErrOIDCEmailUnverified
+	}
+
+	created := false
+	user, err := s.UserModel.GetByEmail(email)
+	switch {
+	case err == nil:
+		if user.EmailVerifiedAt == nil {
+			return nil, false, ErrOIDCAccountExists
+		}
+	case err == sql.ErrNoRows:
+		name := strings.TrimSpace(claims.Name)
+		if name == "" {
+			name, _, _ = strings.Cut(email, "@")
+		}
+		if runes := []rune(name); len(runes) > maxNameLength {
+			name = string(runes[:maxNameLength])
+		}
+		// Without a password hash the account can only be logged into
+		// through the provider until the user sets one with a reset link.
+		user = &models.User{Name: name, Email: email}
+		if err := s.UserModel.InsertTx(ctx, tx, user); err != nil {
+			return nil, false, emailConflict(err)
+		}
+		if err := s.UserModel.MarkEmailVerified(ctx, tx, user.ID, email, now); err != nil {
+			return nil, false, err
+		}
+		user.EmailVerifiedAt = &now
+		created = true
+	default:
+		return nil, false, err
+	}
+
+	if err := s.IdentityModel.Create(ctx, tx, &models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    providerName,
+		Subject:     claims.Subject,
+		Email:       &email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &user.ID, "user.identity_linked", "user", &user.ID, map[string]interface{}{
+			"provider":        providerName,
+			"account_created": created,
+		}); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return user, created, nil
+}
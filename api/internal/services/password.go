@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"ukoni/internal/database"
+	"ukoni/internal/models"
+	"ukoni/internal/notify"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL is how long a reset link can be used for.
+const passwordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// ForgotPassword emails a password reset link to the account with the given
+// email. It reports success whether or not the account exists, so callers
+// can't use it to discover who has signed up.
+func (s *AuthService) ForgotPassword(email string) error {
+	user, err := s.UserModel.GetByEmail(NormalizeEmail(email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := s.PasswordResetModel.UseAllForUser(ctx, tx, user.ID, now); err != nil {
+		return err
+	}
+
+	token, err := generateSecret()
+	if err != nil {
+		return err
+	}
+	reset := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+	if err := s.PasswordResetModel.Create(ctx, tx, reset); err != nil {
+		return err
+	}
+
+	if s.Outbox != nil {
+		if err := s.Outbox.Enqueue(ctx, tx, user.Email, notify.PasswordResetEmail{
+			Name:      user.Name,
+			ResetURL:  s.Outbox.Links.ResetPassword(token),
+			ExpiresAt: reset.ExpiresAt,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword sets a new password using a reset token, which then stops
+// working, and signs the user out everywhere.
+func (s *AuthService) ResetPassword(token, newPassword string) error {
+	if err := checkNewPassword("password", newPassword); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	reset, err := s.PasswordResetModel.GetByHashForUpdate(ctx, tx, hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if reset.UsedAt != nil || !reset.ExpiresAt.After(now) {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(ctx, tx, reset.UserID, newPassword, now, "user.password_reset"); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ChangePassword replaces the password of a logged-in user who knows their
+// current one. Every existing session is ended and a new one is started for
+// the caller.
+func (s *AuthService) ChangePassword(userID, currentPassword, newPassword string, client ClientInfo) (*TokenPair, error) {
+	if err := checkNewPassword("new_password", newPassword); err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserModel.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		return nil, ErrIncorrectPassword
+	}
+
+	ctx := context.Background()
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.setPassword(ctx, tx, userID, newPassword, time.Now(), "user.password_changed"); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.StartSession(ctx, tx, userID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// setPassword stores a new password hash, voids outstanding reset links and
+// revokes every session of the user.
+func (s *AuthService) setPassword(ctx context.Context, dbtx database.DBTX, userID, password string, now time.Time, action string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := s.UserModel.UpdatePassword(ctx, dbtx, userID, string(hash)); err != nil {
+		return err
+	}
+	if err := s.PasswordResetModel.UseAllForUser(ctx, dbtx, userID, now); err != nil {
+		return err
+	}
+	if err := s.SessionModel.RevokeAllForUser(ctx, dbtx, userID, "", now); err != nil {
+		return err
+	}
+
+	if s.ActivityLogService != nil {
+		return s.ActivityLogService.LogActivity(ctx, dbtx, nil, &userID, action, "user", &userID, nil)
+	}
+	return nil
+}
+
+func checkNewPassword(field, password string) error {
+	v := &ValidationError{}
+	validatePassword(v, field, password)
+	return v.Err()
+}
@@ -13,11 +13,15 @@ var (
 )
 
 type ProductService struct {
-	DB           *sql.DB
-	ProductModel *models.ProductModel
+	DB                    *sql.DB
+	ProductModel          *models.ProductModel
+	CanonicalProductModel *models.CanonicalProductModel
+	CategoryService       *CategoryService
+	Authorizer            *Authorizer
+	ActivityLogService    *ActivityLogService
 }
 
-func (s *ProductService) CreateProduct(ctx context.Context, inventoryID, brand, name, description, categoryID string) (*models.Product, error) {
+func (s *ProductService) CreateProduct(ctx context.Context, userID, inventoryID, canonicalProductID, brand, name, description, categoryID string) (*models.Product, error) {
 	if inventoryID == "" {
 		return nil, fmt.Errorf("%w: inventory id is required", ErrInvalidInput)
 	}
@@ -25,10 +29,20 @@ func (s *ProductService) CreateProduct(ctx context.Context, inventoryID, brand,
 		return nil, fmt.Errorf("%w: product name is required", ErrInvalidInput)
 	}
 
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionProductCreate); err != nil {
+		return nil, err
+	}
+
 	product := &models.Product{
 		InventoryID: inventoryID,
 		Name:        name,
 	}
+	if canonicalProductID != "" {
+		if err := s.checkCanonicalProduct(ctx, inventoryID, canonicalProductID); err != nil {
+			return nil, err
+		}
+		product.CanonicalProductID = &canonicalProductID
+	}
 	if brand != "" {
 		product.Brand = &brand
 	}
@@ -36,75 +50,84 @@ func (s *ProductService) CreateProduct(ctx context.Context, inventoryID, brand,
 		product.Description = &description
 	}
 	if categoryID != "" {
+		if err := s.CategoryService.CheckCategory(ctx, inventoryID, categoryID); err != nil {
+			return nil, err
+		}
 		product.CategoryID = &categoryID
 	}
 
-	err := s.ProductModel.Create(ctx, s.DB, product)
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	if err := s.ProductModel.Create(ctx, tx, product); err != nil {
+		return nil, err
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, "product.created", "product", &product.ID, map[string]interface{}{
+		"name":                 product.Name,
+		"brand":                product.Brand,
+		"canonical_product_id": product.CanonicalProductID,
+		"category_id":          product.CategoryID,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return product, nil
 }
 
-func (s *ProductService) GetProduct(ctx context.Context, id string) (*models.Product, error) {
-	return s.ProductModel.GetByID(ctx, id)
+func (s *ProductService) GetProduct(ctx context.Context, userID, id string) (*models.Product, error) {
+	return s.authorizeProduct(ctx, userID, id, ActionProductView)
 }
 
-func (s *ProductService) ListProducts(ctx context.Context, inventoryID string, limit, offset int, search string) ([]*models.Product, error) {
+func (s *ProductService) ListProducts(ctx context.Context, userID, inventoryID string, limit, offset int, search, categoryID string) ([]*models.Product, error) {
 	if inventoryID == "" {
 		return nil, fmt.Errorf("%w: inventory id is required", ErrInvalidInput)
 	}
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionProductView); err != nil {
+		return nil, err
+	}
 	if limit <= 0 {
 		limit = 10
 	}
 	if offset < 0 {
 		offset = 0
 	}
-	return s.ProductModel.List(ctx, inventoryID, limit, offset, search)
+	return s.ProductModel.List(ctx, inventoryID, limit, offset, search, categoryID)
 }
 
-func (s *ProductService) CreateVariant(ctx context.Context, productID, variantName, sku, unit string, size *float64) (*models.ProductVariant, error) {
-	if productID == "" {
+// UpdateProduct replaces a product's details. Its canonical product is kept
+// when canonicalProductID is nil and unlinked when it is empty.
+func (s *ProductService) UpdateProduct(ctx context.Context, userID, id string, canonicalProductID *string, brand, name, description, categoryID string) (*models.Product, error) {
+	if id == "" {
 		return nil, fmt.Errorf("%w: product id is required", ErrInvalidInput)
 	}
-	if variantName == "" {
-		return nil, fmt.Errorf("%w: variant name is required", ErrInvalidInput)
-	}
-
-	variant := &models.ProductVariant{
-		ProductID:   productID,
-		VariantName: variantName,
-		Size:        size,
-	}
-	if sku != "" {
-		variant.SKU = &sku
-	}
-	if unit != "" {
-		variant.Unit = &unit
+	if name == "" {
+		return nil, fmt.Errorf("%w: product name is required", ErrInvalidInput)
 	}
 
-	err := s.ProductModel.CreateVariant(ctx, s.DB, variant)
+	existing, err := s.authorizeProduct(ctx, userID, id, ActionProductUpdate)
 	if err != nil {
 		return nil, err
 	}
-	return variant, nil
-}
-
-func (s *ProductService) ListVariants(ctx context.Context, productID string) ([]*models.ProductVariant, error) {
-	return s.ProductModel.ListVariants(ctx, productID)
-}
-
-func (s *ProductService) UpdateProduct(ctx context.Context, id, brand, name, description, categoryID string) (*models.Product, error) {
-	if id == "" {
-		return nil, fmt.Errorf("%w: product id is required", ErrInvalidInput)
-	}
-	if name == "" {
-		return nil, fmt.Errorf("%w: product name is required", ErrInvalidInput)
-	}
 
 	product := &models.Product{
-		ID:   id,
-		Name: name,
+		ID:                 id,
+		Name:               name,
+		CanonicalProductID: existing.CanonicalProductID,
+	}
+	if canonicalProductID != nil {
+		product.CanonicalProductID = nil
+		if *canonicalProductID != "" {
+			if err := s.checkCanonicalProduct(ctx, existing.InventoryID, *canonicalProductID); err != nil {
+				return nil, err
+			}
+			product.CanonicalProductID = canonicalProductID
+		}
 	}
 	if brand != "" {
 		product.Brand = &brand
@@ -113,27 +136,106 @@ func (s *ProductService) UpdateProduct(ctx context.Context, id, brand, name, des
 		product.Description = &description
 	}
 	if categoryID != "" {
+		if err := s.CategoryService.CheckCategory(ctx, existing.InventoryID, categoryID); err != nil {
+			return nil, err
+		}
 		product.CategoryID = &categoryID
 	}
 
-	err := s.ProductModel.Update(ctx, s.DB, product)
+	metadata := map[string]interface{}{}
+	recordChange(metadata, "name", &existing.Name, &product.Name)
+	recordChange(metadata, "brand", existing.Brand, product.Brand)
+	recordChange(metadata, "description", existing.Description, product.Description)
+	recordChange(metadata, "canonical_product_id", existing.CanonicalProductID, product.CanonicalProductID)
+	recordChange(metadata, "category_id", existing.CategoryID, product.CategoryID)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.ProductModel.Update(ctx, tx, product); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &existing.InventoryID, &userID, "product.updated", "product", &existing.ID, metadata); err != nil {
+		return nil, err
+	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return s.ProductModel.GetByID(ctx, id)
 }
 
-func (s *ProductService) DeleteProduct(ctx context.Context, id string) error {
+func (s *ProductService) DeleteProduct(ctx context.Context, userID, id string) error {
 	if id == "" {
 		return fmt.Errorf("%w: product id is required", ErrInvalidInput)
 	}
-	err := s.ProductModel.Delete(ctx, s.DB, id)
-	if err == sql.ErrNoRows {
-		return ErrNotFound
+	product, err := s.authorizeProduct(ctx, userID, id, ActionProductDelete)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.ProductModel.Delete(ctx, tx, id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &product.InventoryID, &userID, "product.deleted", "product", &product.ID, map[string]interface{}{
+		"name": product.Name,
+	}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// authorizeProduct loads a product and checks the user may perform action on
+// the inventory it belongs to.
+func (s *ProductService) authorizeProduct(ctx context.Context, userID, productID string, action Action) (*models.Product, error) {
+	product, err := s.ProductModel.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, product.InventoryID, action); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// checkCanonicalProduct ensures a product is only linked to a canonical product
+// from the same inventory.
+func (s *ProductService) checkCanonicalProduct(ctx context.Context, inventoryID, canonicalProductID string) error {
+	canonical, err := s.CanonicalProductModel.GetByID(ctx, canonicalProductID)
+	if err != nil {
+		return err
+	}
+	if canonical == nil || canonical.InventoryID != inventoryID {
+		return fmt.Errorf("%w: canonical product not found in this inventory", ErrInvalidInput)
+	}
+	return nil
+}
+
+// recordChange adds old_<field> and new_<field> to metadata when the value
+// changes.
+func recordChange(metadata map[string]interface{}, field string, before, after *string) {
+	if stringValue(before) == stringValue(after) {
+		return
 	}
-	return err
+	metadata["old_"+field] = before
+	metadata["new_"+field] = after
 }
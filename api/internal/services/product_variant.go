@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"ukoni/internal/models"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrVariantNotFound = errors.New("product variant not found")
+	ErrVariantInUse    = errors.New("product variant is still in use")
+)
+
+// VariantInput is what a client sets on a product variant. Empty codes and
+// units are left unset.
+type VariantInput struct {
+	VariantName string
+	SKU         string
+	GTIN        string
+	Unit        string
+	Size        *float64
+}
+
+func (s *ProductService) CreateVariant(ctx context.Context, userID, productID string, input VariantInput) (*models.ProductVariant, error) {
+	if productID == "" {
+		return nil, fmt.Errorf("%w: product id is required", ErrInvalidInput)
+	}
+	variant, gtinKey, err := input.variant()
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := s.authorizeProduct(ctx, userID, productID, ActionProductUpdate)
+	if err != nil {
+		return nil, err
+	}
+	variant.ProductID = productID
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkVariantCodes(ctx, tx, product.InventoryID, "", variant, gtinKey); err != nil {
+		return nil, err
+	}
+	if err := s.ProductModel.CreateVariant(ctx, tx, variant); err != nil {
+		return nil, variantCodeConflict(err)
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &product.InventoryID, &userID, "product_variant.created", "product_variant", &variant.ID, map[string]interface{}{
+		"product_id":   productID,
+		"variant_name": variant.VariantName,
+		"sku":          variant.SKU,
+		"gtin":         variant.GTIN,
+		"unit":         variant.Unit,
+		"size":         variant.Size,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+func (s *ProductService) ListVariants(ctx context.Context, userID, productID string) ([]*models.ProductVariant, error) {
+	if _, err := s.authorizeProduct(ctx, userID, productID, ActionProductView); err != nil {
+		return nil, err
+	}
+	return s.ProductModel.ListVariants(ctx, productID)
+}
+
+func (s *ProductService) GetVariant(ctx context.Context, userID, id string) (*models.ProductVariant, error) {
+	return s.authorizeVariant(ctx, userID, id, ActionProductView)
+}
+
+// UpdateVariant replaces what a client can set on a variant. Stock and
+// purchases are counted in the variant's size and unit, so those stay fixed
+// once it has either.
+func (s *ProductService) UpdateVariant(ctx context.Context, userID, id string, input VariantInput) (*models.ProductVariant, error) {
+	if id == "" {
+		return nil, fmt.Errorf("%w: variant id is required", ErrInvalidInput)
+	}
+	variant, gtinKey, err := input.variant()
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.authorizeVariant(ctx, userID, id, ActionProductUpdate)
+	if err != nil {
+		return nil, err
+	}
+	variant.ID = existing.ID
+	variant.ProductID = existing.ProductID
+	variant.InventoryID = existing.InventoryID
+
+	metadata := map[string]interface{}{}
+	recordChange(metadata, "variant_name", &existing.VariantName, &variant.VariantName)
+	recordChange(metadata, "sku", existing.SKU, variant.SKU)
+	recordChange(metadata, "gtin", existing.GTIN, variant.GTIN)
+	recordChange(metadata, "unit", existing.Unit, variant.Unit)
+	if !sameSize(existing.Size, variant.Size) {
+		metadata["old_size"] = existing.Size
+		metadata["new_size"] = variant.Size
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if !sameSize(existing.Size, variant.Size) || stringValue(existing.Unit) != stringValue(variant.Unit) {
+		usage, err := s.ProductModel.GetVariantUsage(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if roundQuantity(usage.StockQuantity) != 0 || usage.TransactionItems > 0 {
+			return nil, fmt.Errorf("%w: its size and unit can't change once it has stock or purchases; create a new variant instead", ErrVariantInUse)
+		}
+	}
+	if err := s.checkVariantCodes(ctx, tx, variant.InventoryID, variant.ID, variant, gtinKey); err != nil {
+		return nil, err
+	}
+	if err := s.ProductModel.UpdateVariant(ctx, tx, variant); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrVariantNotFound
+		}
+		return nil, variantCodeConflict(err)
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &variant.InventoryID, &userID, "product_variant.updated", "product_variant", &variant.ID, metadata); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// DeleteVariant deletes a variant nothing depends on any more. Variants that
+// are still in stock or waiting on a shopping list are refused; purchases
+// and consumption of them stay as history.
+func (s *ProductService) DeleteVariant(ctx context.Context, userID, id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: variant id is required", ErrInvalidInput)
+	}
+	variant, err := s.authorizeVariant(ctx, userID, id, ActionProductDelete)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	usage, err := s.ProductModel.GetVariantUsage(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if roundQuantity(usage.StockQuantity) != 0 {
+		return fmt.Errorf("%w: it is still in stock; adjust the stock to zero first", ErrVariantInUse)
+	}
+	if usage.OpenShoppingItems > 0 {
+		return fmt.Errorf("%w: it is on %d open shopping list item(s)", ErrVariantInUse, usage.OpenShoppingItems)
+	}
+
+	if err := s.ProductModel.DeleteVariant(ctx, tx, id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrVariantNotFound
+		}
+		return err
+	}
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &variant.InventoryID, &userID, "product_variant.deleted", "product_variant", &variant.ID, map[string]interface{}{
+		"product_id":   variant.ProductID,
+		"variant_name": variant.VariantName,
+	}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LookupVariants finds the variants of an inventory with a SKU or barcode,
+// as read by a scanner. SKUs match ignoring case and barcodes match with or
+// without leading zeros.
+func (s *ProductService) LookupVariants(ctx context.Context, userID, inventoryID, code string) ([]*models.ProductVariant, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, fmt.Errorf("%w: code is required", ErrInvalidInput)
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionProductView); err != nil {
+		return nil, err
+	}
+	return s.ProductModel.FindVariantsByCode(ctx, inventoryID, code, gtinKey(code))
+}
+
+// authorizeVariant loads a variant and checks the user may perform action on
+// the inventory it belongs to.
+func (s *ProductService) authorizeVariant(ctx context.Context, userID, id string, action Action) (*models.ProductVariant, error) {
+	variant, err := s.ProductModel.GetVariant(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if variant == nil {
+		return nil, ErrVariantNotFound
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, variant.InventoryID, action); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// checkVariantCodes makes sure no other variant of the inventory, other than
+// excludeID, has the variant's SKU or GTIN.
+func (s *ProductService) checkVariantCodes(ctx context.Context, tx *sql.Tx, inventoryID, excludeID string, variant *models.ProductVariant, gtinKey string) error {
+	skuTaken, gtinTaken, err := s.ProductModel.VariantCodesTaken(ctx, tx, inventoryID, excludeID, stringValue(variant.SKU), gtinKey)
+	if err != nil {
+		return err
+	}
+	v := &ValidationError{}
+	if skuTaken {
+		v.Add("sku", CodeTaken, "another variant in this inventory has this SKU")
+	}
+	if gtinTaken {
+		v.Add("gtin", CodeTaken, "another variant in this inventory has this barcode")
+	}
+	return v.Err()
+}
+
+// variant validates the input and returns the variant it describes along
+// with its GTIN padded to 14 digits.
+func (in VariantInput) variant() (*models.ProductVariant, string, error) {
+	v := &ValidationError{}
+	variant := &models.ProductVariant{
+		VariantName: strings.TrimSpace(in.VariantName),
+		Size:        in.Size,
+	}
+	validateName(v, "variant_name", variant.VariantName)
+
+	if sku := strings.TrimSpace(in.SKU); sku != "" {
+		if utf8.RuneCountInString(sku) > maxNameLength {
+			v.Add("sku", CodeTooLong, "sku is too long")
+		}
+		variant.SKU = &sku
+	}
+	var key string
+	if gtin := strings.TrimSpace(in.GTIN); gtin != "" {
+		if !validGTIN(gtin) {
+			v.Add("gtin", CodeInvalid, "gtin must be an 8, 12, 13 or 14 digit barcode with a valid check digit")
+		}
+		variant.GTIN = &gtin
+		key = gtinKey(gtin)
+	}
+	if unit := strings.TrimSpace(in.Unit); unit != "" {
+		variant.Unit = &unit
+	}
+	if in.Size != nil && *in.Size <= 0 {
+		v.Add("size", CodeInvalid, "size must be positive")
+	}
+
+	if err := v.Err(); err != nil {
+		return nil, "", err
+	}
+	return variant, key, nil
+}
+
+// validGTIN reports whether code is a GTIN-8, -12, -13 or -14 whose last
+// digit is the GS1 check digit of the rest.
+func validGTIN(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		c := code[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		digit := int(c - '0')
+		if i == len(code)-1 {
+			continue
+		}
+		// Weights alternate 3, 1, 3, ... leftwards from the check digit.
+		if (len(code)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
+}
+
+// gtinKey pads a code that could be a GTIN to 14 digits, the form GTINs are
+// compared in. Other codes return "".
+func gtinKey(code string) string {
+	if len(code) == 0 || len(code) > 14 {
+		return ""
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return ""
+		}
+	}
+	return strings.Repeat("0", 14-len(code)) + code
+}
+
+// variantCodeConflict turns a unique violation on a variant's codes, which
+// happens when two writes race past checkVariantCodes, into the field error
+// the check would have returned.
+func variantCodeConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		switch pgErr.ConstraintName {
+		case "product_variants_sku_idx":
+			return fieldError("sku", CodeTaken, "another variant in this inventory has this SKU")
+		case "product_variants_gtin_idx":
+			return fieldError("gtin", CodeTaken, "another variant in this inventory has this barcode")
+		}
+	}
+	return err
+}
+
+func sameSize(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -2,44 +2,69 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"ukoni/internal/models"
 )
 
+var ErrShoppingListNotFound = errors.New("shopping list not found")
+
+// Fulfilment statuses of a shopping list item, derived from the transaction
+// items linked to it.
+const (
+	FulfilmentOpen        = "open"
+	FulfilmentPartial     = "partially_fulfilled"
+	FulfilmentFulfilled   = "fulfilled"
+	FulfilmentSubstituted = "substituted"
+)
+
 type ShoppingListService struct {
 	ShoppingListModel  *models.ShoppingListModel
-	InventoryModel     *models.InventoryModel
-	MembershipModel    *models.MembershipModel
+	ProductModel       *models.ProductModel
+	UnitService        *UnitService
+	Authorizer         *Authorizer
 	ActivityLogService *ActivityLogService
 }
 
-func (s *ShoppingListService) checkAccess(ctx context.Context, userID, inventoryID string) (bool, error) {
-	// Check if owner
-	inv, err := s.InventoryModel.GetByID(inventoryID)
+// authorizeList loads a shopping list and checks the user may perform action
+// on the inventory it belongs to.
+func (s *ShoppingListService) authorizeList(ctx context.Context, userID, listID string, action Action) (*models.ShoppingList, error) {
+	list, err := s.ShoppingListModel.GetList(ctx, listID)
 	if err != nil {
-		return false, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrShoppingListNotFound
+		}
+		return nil, err
 	}
-	if inv.OwnerUserID == userID {
-		return true, nil
+	if err := s.Authorizer.Authorize(ctx, userID, list.InventoryID, action); err != nil {
+		return nil, err
 	}
+	return list, nil
+}
 
-	// Check if member
-	_, err = s.MembershipModel.GetMembership(inventoryID, userID)
-	if err == nil {
-		return true, nil
+// authorizeItem loads a shopping list item along with its list and checks the
+// user may perform action on the owning inventory.
+func (s *ShoppingListService) authorizeItem(ctx context.Context, userID, itemID string, action Action) (*models.ShoppingListItem, *models.ShoppingList, error) {
+	item, err := s.ShoppingListModel.GetItem(ctx, itemID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrShoppingListNotFound
+		}
+		return nil, nil, err
 	}
-	return false, nil
+	list, err := s.authorizeList(ctx, userID, item.ShoppingListID, action)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, list, nil
 }
 
 func (s *ShoppingListService) CreateList(ctx context.Context, userID, inventoryID, name string) (*models.ShoppingList, error) {
-	// Verify access
-	hasAccess, err := s.checkAccess(ctx, userID, inventoryID)
-	if err != nil {
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionShoppingListCreate); err != nil {
 		return nil, err
 	}
-	if !hasAccess {
-		return nil, errors.New("unauthorized")
-	}
 
 	list := &models.ShoppingList{
 		InventoryID: inventoryID,
@@ -59,36 +84,33 @@ func (s *ShoppingListService) CreateList(ctx context.Context, userID, inventoryI
 }
 
 func (s *ShoppingListService) ListLists(ctx context.Context, userID, inventoryID string) ([]*models.ShoppingList, error) {
-	hasAccess, err := s.checkAccess(ctx, userID, inventoryID)
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionShoppingListView); err != nil {
+		return nil, err
+	}
+
+	lists, err := s.ShoppingListModel.ListLists(ctx, inventoryID)
 	if err != nil {
 		return nil, err
 	}
-	if !hasAccess {
-		return nil, errors.New("unauthorized")
+	if err := s.applyProgress(ctx, lists); err != nil {
+		return nil, err
 	}
-
-	return s.ShoppingListModel.ListLists(ctx, inventoryID)
+	return lists, nil
 }
 
 func (s *ShoppingListService) GetList(ctx context.Context, userID, listID string) (*models.ShoppingList, error) {
-	list, err := s.ShoppingListModel.GetList(ctx, listID)
+	list, err := s.authorizeList(ctx, userID, listID, ActionShoppingListView)
 	if err != nil {
 		return nil, err
 	}
-
-	hasAccess, err := s.checkAccess(ctx, userID, list.InventoryID)
-	if err != nil {
+	if err := s.applyProgress(ctx, []*models.ShoppingList{list}); err != nil {
 		return nil, err
 	}
-	if !hasAccess {
-		return nil, errors.New("unauthorized")
-	}
-
 	return list, nil
 }
 
 func (s *ShoppingListService) UpdateList(ctx context.Context, userID, listID, name string) (*models.ShoppingList, error) {
-	list, err := s.GetList(ctx, userID, listID)
+	list, err := s.authorizeList(ctx, userID, listID, ActionShoppingListUpdate)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +128,7 @@ func (s *ShoppingListService) UpdateList(ctx context.Context, userID, listID, na
 }
 
 func (s *ShoppingListService) DeleteList(ctx context.Context, userID, listID string) error {
-	list, err := s.GetList(ctx, userID, listID)
+	list, err := s.authorizeList(ctx, userID, listID, ActionShoppingListDelete)
 	if err != nil {
 		return err
 	}
@@ -123,15 +145,20 @@ func (s *ShoppingListService) DeleteList(ctx context.Context, userID, listID str
 }
 
 func (s *ShoppingListService) AddItem(ctx context.Context, userID, listID string, item *models.ShoppingListItem) (*models.ShoppingListItem, error) {
-	list, err := s.GetList(ctx, userID, listID)
+	list, err := s.authorizeList(ctx, userID, listID, ActionShoppingListUpdate)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := s.checkQuantity(ctx, item); err != nil {
+		return nil, err
+	}
+
 	item.ShoppingListID = listID
 	if err := s.ShoppingListModel.AddItem(ctx, item); err != nil {
 		return nil, err
 	}
+	deriveFulfilment(item, nil, nil)
 
 	if s.ActivityLogService != nil {
 		s.ActivityLogService.LogActivity(ctx, s.ShoppingListModel.DB, &list.InventoryID, &userID, "shopping_list_item.created", "shopping_list_item", &item.ID, nil)
@@ -141,21 +168,24 @@ func (s *ShoppingListService) AddItem(ctx context.Context, userID, listID string
 }
 
 func (s *ShoppingListService) ListItems(ctx context.Context, userID, listID string) ([]*models.ShoppingListItem, error) {
-	_, err := s.GetList(ctx, userID, listID) // check access
-	if err != nil {
+	if _, err := s.authorizeList(ctx, userID, listID, ActionShoppingListView); err != nil {
 		return nil, err
 	}
 
-	return s.ShoppingListModel.ListItems(ctx, listID)
-}
-
-func (s *ShoppingListService) UpdateItem(ctx context.Context, userID, itemID string, notes *string, preferredOutletID *string) (*models.ShoppingListItem, error) {
-	item, err := s.ShoppingListModel.GetItem(ctx, itemID)
+	items, err := s.ShoppingListModel.ListItems(ctx, listID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.applyFulfilment(ctx, []string{listID}, items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
 
-	list, err := s.GetList(ctx, userID, item.ShoppingListID)
+// UpdateItem changes the fields of an item that are given, leaving the rest
+// as they are.
+func (s *ShoppingListService) UpdateItem(ctx context.Context, userID, itemID string, notes, preferredOutletID *string, quantity *float64, unit *string) (*models.ShoppingListItem, error) {
+	item, list, err := s.authorizeItem(ctx, userID, itemID, ActionShoppingListUpdate)
 	if err != nil {
 		return nil, err
 	}
@@ -166,10 +196,22 @@ func (s *ShoppingListService) UpdateItem(ctx context.Context, userID, itemID str
 	if preferredOutletID != nil {
 		item.PreferredOutletID = preferredOutletID
 	}
+	if quantity != nil {
+		item.Quantity = quantity
+	}
+	if unit != nil {
+		item.Unit = unit
+	}
+	if err := s.checkQuantity(ctx, item); err != nil {
+		return nil, err
+	}
 
 	if err := s.ShoppingListModel.UpdateItem(ctx, item); err != nil {
 		return nil, err
 	}
+	if err := s.applyFulfilment(ctx, []string{list.ID}, []*models.ShoppingListItem{item}); err != nil {
+		return nil, err
+	}
 
 	if s.ActivityLogService != nil {
 		s.ActivityLogService.LogActivity(ctx, s.ShoppingListModel.DB, &list.InventoryID, &userID, "shopping_list_item.updated", "shopping_list_item", &item.ID, nil)
@@ -179,23 +221,226 @@ func (s *ShoppingListService) UpdateItem(ctx context.Context, userID, itemID str
 }
 
 func (s *ShoppingListService) DeleteItem(ctx context.Context, userID, itemID string) error {
-	item, err := s.ShoppingListModel.GetItem(ctx, itemID)
+	item, list, err := s.authorizeItem(ctx, userID, itemID, ActionShoppingListUpdate)
 	if err != nil {
 		return err
 	}
 
-	list, err := s.GetList(ctx, userID, item.ShoppingListID)
+	if err := s.ShoppingListModel.DeleteItem(ctx, itemID); err != nil {
+		return err
+	}
+
+	if s.ActivityLogService != nil {
+		s.ActivityLogService.LogActivity(ctx, s.ShoppingListModel.DB, &list.InventoryID, &userID, "shopping_list_item.deleted", "shopping_list_item", &item.ID, nil)
+	}
+
+	return nil
+}
+
+// applyFulfilment derives the fulfilment of items, which must all belong to
+// the given lists.
+func (s *ShoppingListService) applyFulfilment(ctx context.Context, listIDs []string, items []*models.ShoppingListItem) error {
+	purchases, err := s.ShoppingListModel.ListPurchases(ctx, listIDs)
 	if err != nil {
 		return err
 	}
 
-	if err := s.ShoppingListModel.DeleteItem(ctx, itemID); err != nil {
+	byItem := make(map[string][]*models.ShoppingListPurchase)
+	for _, p := range purchases {
+		byItem[p.ShoppingListItemID] = append(byItem[p.ShoppingListItemID], p)
+	}
+
+	graphs := make(map[string]*UnitGraph)
+	for _, item := range items {
+		linked := byItem[item.ID]
+		amounts := make([]*float64, len(linked))
+		for i, p := range linked {
+			var graph *UnitGraph
+			if item.Unit != nil {
+				cpID := stringValue(p.CanonicalProductID)
+				if graph = graphs[cpID]; graph == nil {
+					if graph, err = s.UnitService.Graph(ctx, cpID); err != nil {
+						return err
+					}
+					graphs[cpID] = graph
+				}
+			}
+			if amounts[i], err = measurePurchase(item, p, graph); err != nil {
+				return err
+			}
+		}
+		deriveFulfilment(item, linked, amounts)
+	}
+	return nil
+}
+
+// applyProgress counts the items of each list by fulfilment status.
+func (s *ShoppingListService) applyProgress(ctx context.Context, lists []*models.ShoppingList) error {
+	if len(lists) == 0 {
+		return nil
+	}
+
+	listIDs := make([]string, len(lists))
+	byID := make(map[string]*models.ShoppingList, len(lists))
+	for i, list := range lists {
+		listIDs[i] = list.ID
+		list.Progress = &models.ShoppingListProgress{}
+		byID[list.ID] = list
+	}
+
+	items, err := s.ShoppingListModel.ListItemTargets(ctx, listIDs)
+	if err != nil {
+		return err
+	}
+	if err := s.applyFulfilment(ctx, listIDs, items); err != nil {
 		return err
 	}
 
-	if s.ActivityLogService != nil {
-		s.ActivityLogService.LogActivity(ctx, s.ShoppingListModel.DB, &list.InventoryID, &userID, "shopping_list_item.deleted", "shopping_list_item", &item.ID, nil)
+	for _, item := range items {
+		progress := byID[item.ShoppingListID].Progress
+		progress.Total++
+		switch item.Status {
+		case FulfilmentOpen:
+			progress.Open++
+		case FulfilmentPartial:
+			progress.PartiallyFulfilled++
+		case FulfilmentFulfilled:
+			progress.Fulfilled++
+		case FulfilmentSubstituted:
+			progress.Substituted++
+		}
 	}
+	return nil
+}
+
+// deriveFulfilment sets an item's status from the purchases linked to it,
+// oldest first, and the amount each one counts for in the item's terms (nil
+// when it cannot be measured that way). A purchase matches the item when it
+// is the targeted variant, or any variant of the targeted canonical product;
+// anything else bought against the item is a substitute. Matching purchases
+// fulfil the item once they cover the quantity wanted, or straight away when
+// no quantity is given.
+func deriveFulfilment(item *models.ShoppingListItem, purchases []*models.ShoppingListPurchase, amounts []*float64) {
+	item.TransactionItemIDs = []string{}
+	item.PurchasedQuantity = 0
+	item.PurchasedOutletID = nil
+
+	matched := false
+	matchedQuantity := 0.0
+	for i, p := range purchases {
+		item.TransactionItemIDs = append(item.TransactionItemIDs, p.TransactionItemID)
+		item.PurchasedOutletID = p.OutletID
+		isMatch := purchaseMatches(item, p)
+		matched = matched || isMatch
+		if amount := amounts[i]; amount != nil {
+			item.PurchasedQuantity += *amount
+			if isMatch {
+				matchedQuantity += *amount
+			}
+		}
+	}
+	item.PurchasedQuantity = roundQuantity(item.PurchasedQuantity)
+
+	switch {
+	case len(purchases) == 0:
+		item.Status = FulfilmentOpen
+	case !matched:
+		item.Status = FulfilmentSubstituted
+	case item.Quantity == nil || roundQuantity(matchedQuantity) >= *item.Quantity:
+		item.Status = FulfilmentFulfilled
+	default:
+		item.Status = FulfilmentPartial
+	}
+}
 
+// measurePurchase returns how much of an item a purchase accounts for. Items
+// without a unit are counted in purchased packs; items with one are measured
+// by the variant's size, converted into the item's unit. A purchase that
+// cannot be converted returns nil.
+func measurePurchase(item *models.ShoppingListItem, p *models.ShoppingListPurchase, graph *UnitGraph) (*float64, error) {
+	amount := p.Quantity
+	if item.Unit == nil {
+		return &amount, nil
+	}
+	if p.Size != nil {
+		amount *= *p.Size
+	}
+	conversion, err := convertStock(graph, amount, p.Unit, item.Unit)
+	if err != nil {
+		if errors.Is(err, ErrUnknownUnit) || errors.Is(err, ErrNoConversion) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &conversion.Quantity, nil
+}
+
+// checkQuantity validates the quantity and unit wanted for an item. The unit
+// must be one the targeted product can be measured in.
+func (s *ShoppingListService) checkQuantity(ctx context.Context, item *models.ShoppingListItem) error {
+	if item.Unit != nil {
+		unit := strings.TrimSpace(*item.Unit)
+		item.Unit = &unit
+		if unit == "" {
+			item.Unit = nil
+		}
+	}
+	if item.Quantity == nil {
+		if item.Unit != nil {
+			return fmt.Errorf("%w: a unit needs a quantity", ErrInvalidInput)
+		}
+		return nil
+	}
+	if *item.Quantity <= 0 {
+		return fmt.Errorf("%w: quantity must be greater than zero", ErrInvalidInput)
+	}
+	if item.Unit == nil {
+		return nil
+	}
+
+	canonicalProductID, err := s.targetCanonicalProduct(ctx, item)
+	if err != nil {
+		return err
+	}
+	graph, err := s.UnitService.Graph(ctx, canonicalProductID)
+	if err != nil {
+		return err
+	}
+	if !graph.Knows(*item.Unit) {
+		return fmt.Errorf("%w: %s", ErrUnknownUnit, *item.Unit)
+	}
 	return nil
 }
+
+// targetCanonicalProduct returns the canonical product an item is for, or an
+// empty string when it targets a variant of an unlinked product.
+func (s *ShoppingListService) targetCanonicalProduct(ctx context.Context, item *models.ShoppingListItem) (string, error) {
+	if item.TargetType != "product_variant" {
+		return item.TargetID, nil
+	}
+	variant, err := s.ProductModel.GetVariant(ctx, item.TargetID)
+	if err != nil {
+		return "", err
+	}
+	if variant == nil {
+		return "", fmt.Errorf("%w: product variant not found", ErrInvalidInput)
+	}
+	product, err := s.ProductModel.GetByID(ctx, variant.ProductID)
+	if err != nil {
+		return "", err
+	}
+	if product == nil {
+		return "", fmt.Errorf("%w: product not found", ErrInvalidInput)
+	}
+	return stringValue(product.CanonicalProductID), nil
+}
+
+func purchaseMatches(item *models.ShoppingListItem, p *models.ShoppingListPurchase) bool {
+	switch item.TargetType {
+	case "product_variant":
+		return p.ProductVariantID == item.TargetID
+	case "canonical_product":
+		return p.CanonicalProductID != nil && *p.CanonicalProductID == item.TargetID
+	}
+	return false
+}
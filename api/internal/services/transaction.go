@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 	"ukoni/internal/models"
 )
@@ -15,8 +16,10 @@ var (
 type TransactionService struct {
 	DB                      *sql.DB
 	TransactionModel        *models.TransactionModel
-	MembershipModel         *models.MembershipModel
+	Authorizer              *Authorizer
 	OutletModel             *models.OutletModel
+	ProductModel            *models.ProductModel
+	ShoppingListModel       *models.ShoppingListModel
 	ActivityLogService      *ActivityLogService
 	InventoryProductService *InventoryProductService
 }
@@ -36,33 +39,26 @@ type CreateTransactionItemInput struct {
 	ShoppingListItemID *string
 }
 
+type UpdateTransactionInput struct {
+	TransactionID   string
+	UserID          string
+	OutletID        *string
+	TransactionDate time.Time
+	Items           []CreateTransactionItemInput
+}
+
 type TransactionWithItems struct {
 	*models.Transaction
 	Items []*models.TransactionItem `json:"items"`
 }
 
 func (s *TransactionService) CreateTransaction(ctx context.Context, input CreateTransactionInput) (*models.Transaction, error) {
-	// Validate membership
-	member, err := s.MembershipModel.GetMembership(input.InventoryID, input.CreatedByUserID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("user is not a member of this inventory")
-		}
+	if err := s.Authorizer.Authorize(ctx, input.CreatedByUserID, input.InventoryID, ActionTransactionCreate); err != nil {
 		return nil, err
 	}
-	if member == nil {
-		return nil, errors.New("user is not a member of this inventory")
-	}
 
-	// Validate outlet if present
-	if input.OutletID != nil {
-		_, err := s.OutletModel.Get(*input.OutletID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return nil, errors.New("outlet not found")
-			}
-			return nil, err
-		}
+	if err := s.checkInput(ctx, input.InventoryID, input.OutletID, input.Items); err != nil {
+		return nil, err
 	}
 
 	tx, err := s.DB.BeginTx(ctx, nil)
@@ -71,13 +67,7 @@ func (s *TransactionService) CreateTransaction(ctx context.Context, input Create
 	}
 	defer tx.Rollback()
 
-	// Calculate total amount
-	var totalAmount float64
-	for _, item := range input.Items {
-		if item.PricePerUnit != nil {
-			totalAmount += *item.PricePerUnit * item.Quantity
-		}
-	}
+	totalAmount := transactionTotal(input.Items)
 
 	t := &models.Transaction{
 		InventoryID:     input.InventoryID,
@@ -91,17 +81,7 @@ func (s *TransactionService) CreateTransaction(ctx context.Context, input Create
 		return nil, err
 	}
 
-	createdItems := make([]*models.TransactionItem, 0, len(input.Items))
-	for _, itemInput := range input.Items {
-		item := &models.TransactionItem{
-			TransactionID:      t.ID,
-			ProductVariantID:   itemInput.ProductVariantID,
-			Quantity:           itemInput.Quantity,
-			PricePerUnit:       itemInput.PricePerUnit,
-			ShoppingListItemID: itemInput.ShoppingListItemID,
-		}
-		createdItems = append(createdItems, item)
-	}
+	createdItems := transactionItems(t.ID, input.Items)
 
 	if err := s.TransactionModel.CreateItems(ctx, tx, createdItems); err != nil {
 		return nil, err
@@ -135,17 +115,9 @@ func (s *TransactionService) CreateTransaction(ctx context.Context, input Create
 }
 
 func (s *TransactionService) ListTransactions(ctx context.Context, inventoryID, userID string, limit, offset int) ([]*models.Transaction, error) {
-	// Validate membership
-	member, err := s.MembershipModel.GetMembership(inventoryID, userID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("user is not a member of this inventory")
-		}
+	if err := s.Authorizer.Authorize(ctx, userID, inventoryID, ActionTransactionView); err != nil {
 		return nil, err
 	}
-	if member == nil {
-		return nil, errors.New("user is not a member of this inventory")
-	}
 
 	return s.TransactionModel.ListByInventory(ctx, inventoryID, limit, offset)
 }
@@ -159,25 +131,248 @@ func (s *TransactionService) GetTransaction(ctx context.Context, transactionID,
 		return nil, err
 	}
 
-	// Validate membership
-	member, err := s.MembershipModel.GetMembership(t.InventoryID, userID)
+	if err := s.Authorizer.Authorize(ctx, userID, t.InventoryID, ActionTransactionView); err != nil {
+		return nil, err
+	}
+
+	items, err := s.TransactionModel.GetItems(ctx, s.DB, transactionID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("user is not a member of this inventory")
-		}
 		return nil, err
 	}
-	if member == nil {
-		return nil, errors.New("user is not a member of this inventory")
+
+	return &TransactionWithItems{
+		Transaction: t,
+		Items:       items,
+	}, nil
+}
+
+// UpdateTransaction replaces the details and items of a transaction. The
+// stock the old items added is taken back and the new items' stock is added
+// in the same database transaction, so a correction never double counts.
+// As with any replacement, the transaction date must be given again.
+func (s *TransactionService) UpdateTransaction(ctx context.Context, input UpdateTransactionInput) (*TransactionWithItems, error) {
+	if input.TransactionDate.IsZero() {
+		v := &ValidationError{}
+		v.Add("transaction_date", CodeRequired, "transaction date is required")
+		return nil, v.Err()
+	}
+
+	existing, err := s.authorizeTransaction(ctx, input.UserID, input.TransactionID, ActionTransactionUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkInput(ctx, existing.InventoryID, input.OutletID, input.Items); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	items, err := s.TransactionModel.GetItems(ctx, transactionID)
+	t, oldItems, err := s.lockTransaction(ctx, tx, existing.ID)
 	if err != nil {
 		return nil, err
 	}
+	before := transactionSnapshot(t, oldItems)
+
+	totalAmount := transactionTotal(input.Items)
+	t.OutletID = input.OutletID
+	t.TransactionDate = input.TransactionDate
+	t.TotalAmount = &totalAmount
+	if err := s.TransactionModel.Update(ctx, tx, t); err != nil {
+		return nil, err
+	}
+
+	if err := s.TransactionModel.DeleteItems(ctx, tx, t.ID); err != nil {
+		return nil, err
+	}
+	newItems := transactionItems(t.ID, input.Items)
+	if err := s.TransactionModel.CreateItems(ctx, tx, newItems); err != nil {
+		return nil, err
+	}
+
+	// Add the new stock before taking back the old, so an edit that keeps a
+	// variant only has to find the difference still on hand.
+	if err := s.InventoryProductService.UpdateFromTransaction(ctx, tx, t, newItems); err != nil {
+		return nil, err
+	}
+	if err := s.InventoryProductService.ReverseTransaction(ctx, tx, t, oldItems); err != nil {
+		return nil, err
+	}
+
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &t.InventoryID, &input.UserID, "transaction.updated", "transaction", &t.ID, map[string]interface{}{
+		"before": before,
+		"after":  transactionSnapshot(t, newItems),
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return &TransactionWithItems{
 		Transaction: t,
-		Items:       items,
+		Items:       newItems,
 	}, nil
 }
+
+// DeleteTransaction voids a transaction, soft-deleting it and taking back the
+// stock it added.
+func (s *TransactionService) DeleteTransaction(ctx context.Context, transactionID, userID string) error {
+	if _, err := s.authorizeTransaction(ctx, userID, transactionID, ActionTransactionDelete); err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t, items, err := s.lockTransaction(ctx, tx, transactionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.InventoryProductService.ReverseTransaction(ctx, tx, t, items); err != nil {
+		return err
+	}
+	if err := s.TransactionModel.Delete(ctx, tx, t.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTransactionNotFound
+		}
+		return err
+	}
+
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &t.InventoryID, &userID, "transaction.deleted", "transaction", &t.ID, map[string]interface{}{
+		"before": transactionSnapshot(t, items),
+	}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *TransactionService) authorizeTransaction(ctx context.Context, userID, transactionID string, action Action) (*models.Transaction, error) {
+	t, err := s.TransactionModel.GetByID(ctx, transactionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, t.InventoryID, action); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// lockTransaction re-reads a transaction and its items inside tx, holding a
+// lock on it until tx ends.
+func (s *TransactionService) lockTransaction(ctx context.Context, tx *sql.Tx, transactionID string) (*models.Transaction, []*models.TransactionItem, error) {
+	t, err := s.TransactionModel.GetForUpdate(ctx, tx, transactionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrTransactionNotFound
+		}
+		return nil, nil, err
+	}
+	items, err := s.TransactionModel.GetItems(ctx, tx, transactionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, items, nil
+}
+
+// checkInput validates the items of a transaction in inventoryID. Their
+// variants, and the shopping list items they fulfil, must belong to the same
+// inventory.
+func (s *TransactionService) checkInput(ctx context.Context, inventoryID string, outletID *string, items []CreateTransactionItemInput) error {
+	// Validate outlet if present
+	if outletID != nil {
+		_, err := s.OutletModel.Get(*outletID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%w: outlet not found", ErrInvalidInput)
+			}
+			return err
+		}
+	}
+
+	for _, item := range items {
+		if item.ProductVariantID == "" {
+			return fmt.Errorf("%w: product variant id is required", ErrInvalidInput)
+		}
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: quantity must be greater than zero", ErrInvalidInput)
+		}
+
+		variant, err := s.ProductModel.GetVariant(ctx, item.ProductVariantID)
+		if err != nil {
+			return err
+		}
+		if variant == nil || variant.InventoryID != inventoryID {
+			return fmt.Errorf("%w: product variant %s not found in this inventory", ErrInvalidInput, item.ProductVariantID)
+		}
+
+		if item.ShoppingListItemID != nil {
+			listInventoryID, err := s.ShoppingListModel.GetItemInventoryID(ctx, *item.ShoppingListItemID)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if listInventoryID != inventoryID {
+				return fmt.Errorf("%w: shopping list item %s not found in this inventory", ErrInvalidInput, *item.ShoppingListItemID)
+			}
+		}
+	}
+	return nil
+}
+
+func transactionTotal(items []CreateTransactionItemInput) float64 {
+	var totalAmount float64
+	for _, item := range items {
+		if item.PricePerUnit != nil {
+			totalAmount += *item.PricePerUnit * item.Quantity
+		}
+	}
+	return totalAmount
+}
+
+func transactionItems(transactionID string, inputs []CreateTransactionItemInput) []*models.TransactionItem {
+	items := make([]*models.TransactionItem, 0, len(inputs))
+	for _, itemInput := range inputs {
+		items = append(items, &models.TransactionItem{
+			TransactionID:      transactionID,
+			ProductVariantID:   itemInput.ProductVariantID,
+			Quantity:           itemInput.Quantity,
+			PricePerUnit:       itemInput.PricePerUnit,
+			ShoppingListItemID: itemInput.ShoppingListItemID,
+		})
+	}
+	return items
+}
+
+// transactionSnapshot records a transaction as it stands, for the before and
+// after of an edit in the activity log.
+func transactionSnapshot(t *models.Transaction, items []*models.TransactionItem) map[string]interface{} {
+	snapshotItems := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		snapshotItems = append(snapshotItems, map[string]interface{}{
+			"id":                    item.ID,
+			"product_variant_id":    item.ProductVariantID,
+			"quantity":              item.Quantity,
+			"price_per_unit":        item.PricePerUnit,
+			"shopping_list_item_id": item.ShoppingListItemID,
+		})
+	}
+	return map[string]interface{}{
+		"outlet_id":        t.OutletID,
+		"transaction_date": t.TransactionDate,
+		"total_amount":     t.TotalAmount,
+		"items":            snapshotItems,
+	}
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"ukoni/internal/models"
+)
+
+var (
+	ErrUnknownUnit            = errors.New("unknown unit")
+	ErrNoConversion           = errors.New("no conversion between units")
+	ErrUnitConversionNotFound = errors.New("unit conversion not found")
+	ErrUnitConversionExists   = errors.New("unit conversion already exists")
+)
+
+const (
+	DimensionMass   = "mass"
+	DimensionVolume = "volume"
+	DimensionCount  = "count"
+)
+
+// Unit is an entry in the unit registry. ToBase is how many of the dimension's
+// base unit (g, ml or piece) make up one of this unit.
+type Unit struct {
+	Code       string   `json:"code"`
+	Name       string   `json:"name"`
+	Dimension  string   `json:"dimension"`
+	ToBase     float64  `json:"to_base"`
+	Confidence float64  `json:"confidence"`
+	Aliases    []string `json:"aliases,omitempty"`
+}
+
+var baseUnits = map[string]string{
+	DimensionMass:   "g",
+	DimensionVolume: "ml",
+	DimensionCount:  "piece",
+}
+
+// unitRegistry lists the units Ukoni understands out of the box. Volumes use
+// imperial measures where UK and US differ, and cups are marked as less certain
+// because their size varies from country to country.
+var unitRegistry = []*Unit{
+	{Code: "mg", Name: "milligram", Dimension: DimensionMass, ToBase: 0.001, Confidence: 1, Aliases: []string{"milligram", "milligrams", "mgs"}},
+	{Code: "g", Name: "gram", Dimension: DimensionMass, ToBase: 1, Confidence: 1, Aliases: []string{"gram", "grams", "gr", "grm"}},
+	{Code: "kg", Name: "kilogram", Dimension: DimensionMass, ToBase: 1000, Confidence: 1, Aliases: []string{"kilogram", "kilograms", "kilo", "kilos", "kgs"}},
+	{Code: "oz", Name: "ounce", Dimension: DimensionMass, ToBase: 28.349523125, Confidence: 1, Aliases: []string{"ounce", "ounces"}},
+	{Code: "lb", Name: "pound", Dimension: DimensionMass, ToBase: 453.59237, Confidence: 1, Aliases: []string{"pound", "pounds", "lbs"}},
+
+	{Code: "ml", Name: "millilitre", Dimension: DimensionVolume, ToBase: 1, Confidence: 1, Aliases: []string{"millilitre", "millilitres", "milliliter", "milliliters", "mls"}},
+	{Code: "cl", Name: "centilitre", Dimension: DimensionVolume, ToBase: 10, Confidence: 1, Aliases: []string{"centilitre", "centilitres", "centiliter", "centiliters"}},
+	{Code: "l", Name: "litre", Dimension: DimensionVolume, ToBase: 1000, Confidence: 1, Aliases: []string{"litre", "litres", "liter", "liters", "ltr", "ltrs"}},
+	{Code: "tsp", Name: "teaspoon", Dimension: DimensionVolume, ToBase: 5, Confidence: 1, Aliases: []string{"teaspoon", "teaspoons", "tsps"}},
+	{Code: "tbsp", Name: "tablespoon", Dimension: DimensionVolume, ToBase: 15, Confidence: 1, Aliases: []string{"tablespoon", "tablespoons", "tbsps", "tbs"}},
+	{Code: "cup", Name: "cup", Dimension: DimensionVolume, ToBase: 250, Confidence: 0.9, Aliases: []string{"cups"}},
+	{Code: "fl_oz", Name: "fluid ounce", Dimension: DimensionVolume, ToBase: 28.4130625, Confidence: 1, Aliases: []string{"fl oz", "floz", "fluid ounce", "fluid ounces"}},
+	{Code: "pint", Name: "pint", Dimension: DimensionVolume, ToBase: 568.26125, Confidence: 1, Aliases: []string{"pints", "pt", "pts"}},
+	{Code: "gallon", Name: "gallon", Dimension: DimensionVolume, ToBase: 4546.09, Confidence: 1, Aliases: []string{"gallons", "gal"}},
+
+	{Code: "piece", Name: "piece", Dimension: DimensionCount, ToBase: 1, Confidence: 1, Aliases: []string{"pieces", "pc", "pcs", "each", "ea", "item", "items", "unit", "units", "x"}},
+	{Code: "pair", Name: "pair", Dimension: DimensionCount, ToBase: 2, Confidence: 1, Aliases: []string{"pairs"}},
+	{Code: "dozen", Name: "dozen", Dimension: DimensionCount, ToBase: 12, Confidence: 1, Aliases: []string{"dozens", "doz"}},
+}
+
+var unitIndex = indexUnits(unitRegistry)
+
+func indexUnits(units []*Unit) map[string]*Unit {
+	index := make(map[string]*Unit)
+	for _, u := range units {
+		index[u.Code] = u
+		for _, alias := range u.Aliases {
+			index[alias] = u
+		}
+	}
+	return index
+}
+
+// normalizeUnit lower-cases a free-text unit and tidies its whitespace so that
+// "  Fl  Oz. " and "fl oz" are treated the same.
+func normalizeUnit(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	return strings.TrimSuffix(name, ".")
+}
+
+// LookupUnit finds a registered unit by its code or one of its aliases.
+func LookupUnit(name string) (*Unit, bool) {
+	u, ok := unitIndex[normalizeUnit(name)]
+	return u, ok
+}
+
+// unitKey is the node a free-text unit maps to in the graph: the registry code
+// for known units, otherwise the normalised text itself.
+func unitKey(name string) string {
+	if u, ok := LookupUnit(name); ok {
+		return u.Code
+	}
+	return normalizeUnit(name)
+}
+
+// Conversion is the result of converting a quantity between two units.
+// Confidence is the product of the confidences of every edge on the path.
+type Conversion struct {
+	FromQuantity float64  `json:"from_quantity"`
+	FromUnit     string   `json:"from_unit"`
+	Quantity     float64  `json:"quantity"`
+	Unit         string   `json:"unit"`
+	Factor       float64  `json:"factor"`
+	Confidence   float64  `json:"confidence"`
+	Path         []string `json:"path"`
+}
+
+type unitEdge struct {
+	to         string
+	factor     float64
+	confidence float64
+}
+
+// UnitGraph holds the registry conversions plus any product-specific edges.
+// Units are not forced onto a single base; any connected path will do.
+type UnitGraph struct {
+	edges map[string][]unitEdge
+}
+
+// NewUnitGraph builds a graph from the registry and the given product-specific
+// conversions.
+func NewUnitGraph(conversions []*models.UnitConversion) *UnitGraph {
+	g := &UnitGraph{edges: make(map[string][]unitEdge)}
+	for _, u := range unitRegistry {
+		if base := baseUnits[u.Dimension]; u.Code != base {
+			g.addEdge(u.Code, base, u.ToBase, u.Confidence)
+		}
+	}
+	for _, c := range conversions {
+		g.addEdge(unitKey(c.FromUnit), unitKey(c.ToUnit), c.Factor, c.Confidence)
+	}
+	return g
+}
+
+func (g *UnitGraph) addEdge(from, to string, factor, confidence float64) {
+	g.edges[from] = append(g.edges[from], unitEdge{to: to, factor: factor, confidence: confidence})
+	g.edges[to] = append(g.edges[to], unitEdge{to: from, factor: 1 / factor, confidence: confidence})
+}
+
+// Knows reports whether the graph can say anything about unit.
+func (g *UnitGraph) Knows(unit string) bool {
+	return len(g.edges[unitKey(unit)]) > 0
+}
+
+// Convert converts quantity from one unit to another along the most confident
+// path in the graph, preferring fewer hops when confidences tie.
+func (g *UnitGraph) Convert(quantity float64, from, to string) (*Conversion, error) {
+	src, dst := unitKey(from), unitKey(to)
+	if src == "" || dst == "" {
+		return nil, fmt.Errorf("%w: both units are required", ErrInvalidInput)
+	}
+
+	if src == dst {
+		return &Conversion{
+			FromQuantity: quantity,
+			FromUnit:     src,
+			Quantity:     quantity,
+			Unit:         dst,
+			Factor:       1,
+			Confidence:   1,
+			Path:         []string{src},
+		}, nil
+	}
+	if !g.Knows(src) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownUnit, from)
+	}
+	if !g.Knows(dst) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownUnit, to)
+	}
+
+	type state struct {
+		factor     float64
+		confidence float64
+		hops       int
+		prev       string
+	}
+	best := map[string]*state{src: {factor: 1, confidence: 1}}
+	visited := make(map[string]bool)
+
+	for {
+		// Pick the most confident unvisited node; the graph is small enough
+		// that a linear scan beats maintaining a heap.
+		var node string
+		var current *state
+		for n, st := range best {
+			if visited[n] {
+				continue
+			}
+			if current == nil || st.confidence > current.confidence ||
+				(st.confidence == current.confidence && (st.hops < current.hops || (st.hops == current.hops && n < node))) {
+				node, current = n, st
+			}
+		}
+		if current == nil || node == dst {
+			break
+		}
+		visited[node] = true
+
+		for _, e := range g.edges[node] {
+			if visited[e.to] {
+				continue
+			}
+			confidence := current.confidence * e.confidence
+			existing, ok := best[e.to]
+			if !ok || confidence > existing.confidence ||
+				(confidence == existing.confidence && current.hops+1 < existing.hops) {
+				best[e.to] = &state{
+					factor:     current.factor * e.factor,
+					confidence: confidence,
+					hops:       current.hops + 1,
+					prev:       node,
+				}
+			}
+		}
+	}
+
+	result, ok := best[dst]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s to %s", ErrNoConversion, from, to)
+	}
+
+	path := []string{dst}
+	for n := dst; n != src; {
+		n = best[n].prev
+		path = append([]string{n}, path...)
+	}
+
+	return &Conversion{
+		FromQuantity: quantity,
+		FromUnit:     src,
+		Quantity:     roundQuantity(quantity * result.factor),
+		Unit:         dst,
+		Factor:       roundQuantity(result.factor),
+		Confidence:   roundQuantity(result.confidence),
+		Path:         path,
+	}, nil
+}
+
+// roundQuantity trims floating point noise so 0.1 l shows as 100 ml rather
+// than 100.00000000000001 ml.
+func roundQuantity(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
+
+type UnitService struct {
+	DB                    *sql.DB
+	UnitConversionModel   *models.UnitConversionModel
+	CanonicalProductModel *models.CanonicalProductModel
+	Authorizer            *Authorizer
+	ActivityLogService    *ActivityLogService
+}
+
+type CreateUnitConversionInput struct {
+	CanonicalProductID string
+	UserID             string
+	FromUnit           string
+	ToUnit             string
+	Factor             float64
+	Confidence         *float64
+	Note               *string
+}
+
+// ListUnits returns the unit registry ordered by dimension.
+func (s *UnitService) ListUnits() []*Unit {
+	units := make([]*Unit, len(unitRegistry))
+	copy(units, unitRegistry)
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].Dimension < units[j].Dimension
+	})
+	return units
+}
+
+// Graph builds the unit graph, adding the conversions specific to the given
+// canonical product when one is provided.
+func (s *UnitService) Graph(ctx context.Context, canonicalProductID string) (*UnitGraph, error) {
+	var conversions []*models.UnitConversion
+	if canonicalProductID != "" {
+		var err error
+		conversions, err = s.UnitConversionModel.ListByCanonicalProduct(ctx, canonicalProductID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewUnitGraph(conversions), nil
+}
+
+// Convert converts a quantity between units, using the conversions of a
+// canonical product if one is given.
+func (s *UnitService) Convert(ctx context.Context, userID string, quantity float64, from, to, canonicalProductID string) (*Conversion, error) {
+	if canonicalProductID != "" {
+		if _, err := s.authorizeCanonicalProduct(ctx, userID, canonicalProductID, ActionCanonicalProductView); err != nil {
+			return nil, err
+		}
+	}
+	graph, err := s.Graph(ctx, canonicalProductID)
+	if err != nil {
+		return nil, err
+	}
+	return graph.Convert(quantity, from, to)
+}
+
+func (s *UnitService) ListConversions(ctx context.Context, userID, canonicalProductID string) ([]*models.UnitConversion, error) {
+	if _, err := s.authorizeCanonicalProduct(ctx, userID, canonicalProductID, ActionCanonicalProductView); err != nil {
+		return nil, err
+	}
+	return s.UnitConversionModel.ListByCanonicalProduct(ctx, canonicalProductID)
+}
+
+// CreateConversion records a product-specific conversion such as a density or
+// a piece weight.
+func (s *UnitService) CreateConversion(ctx context.Context, input CreateUnitConversionInput) (*models.UnitConversion, error) {
+	from, to := unitKey(input.FromUnit), unitKey(input.ToUnit)
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("%w: from_unit and to_unit are required", ErrInvalidInput)
+	}
+	if from == to {
+		return nil, fmt.Errorf("%w: from_unit and to_unit must differ", ErrInvalidInput)
+	}
+	if input.Factor <= 0 {
+		return nil, fmt.Errorf("%w: factor must be positive", ErrInvalidInput)
+	}
+	confidence := 1.0
+	if input.Confidence != nil {
+		confidence = *input.Confidence
+	}
+	if confidence <= 0 || confidence > 1 {
+		return nil, fmt.Errorf("%w: confidence must be greater than 0 and at most 1", ErrInvalidInput)
+	}
+	fromUnit, fromKnown := LookupUnit(from)
+	toUnit, toKnown := LookupUnit(to)
+	if fromKnown && toKnown && fromUnit.Dimension == toUnit.Dimension {
+		return nil, fmt.Errorf("%w: %s and %s already convert through the unit registry", ErrInvalidInput, from, to)
+	}
+
+	product, err := s.authorizeCanonicalProduct(ctx, input.UserID, input.CanonicalProductID, ActionCanonicalProductUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.UnitConversionModel.ListByCanonicalProduct(ctx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range existing {
+		if (c.FromUnit == from && c.ToUnit == to) || (c.FromUnit == to && c.ToUnit == from) {
+			return nil, ErrUnitConversionExists
+		}
+	}
+
+	conversion := &models.UnitConversion{
+		CanonicalProductID: product.ID,
+		FromUnit:           from,
+		ToUnit:             to,
+		Factor:             input.Factor,
+		Confidence:         confidence,
+		Note:               input.Note,
+		CreatedByUserID:    &input.UserID,
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.UnitConversionModel.Create(ctx, tx, conversion); err != nil {
+		return nil, err
+	}
+
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &product.InventoryID, &input.UserID, "unit_conversion.created", "unit_conversion", &conversion.ID, map[string]interface{}{
+		"canonical_product_id": product.ID,
+		"from_unit":            from,
+		"to_unit":              to,
+		"factor":               input.Factor,
+		"confidence":           confidence,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return conversion, nil
+}
+
+func (s *UnitService) DeleteConversion(ctx context.Context, userID, id string) error {
+	conversion, err := s.UnitConversionModel.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if conversion == nil {
+		return ErrUnitConversionNotFound
+	}
+	product, err := s.authorizeCanonicalProduct(ctx, userID, conversion.CanonicalProductID, ActionCanonicalProductUpdate)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.UnitConversionModel.Delete(ctx, tx, id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUnitConversionNotFound
+		}
+		return err
+	}
+
+	if err := s.ActivityLogService.LogActivity(ctx, tx, &product.InventoryID, &userID, "unit_conversion.deleted", "unit_conversion", &conversion.ID, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *UnitService) authorizeCanonicalProduct(ctx context.Context, userID, id string, action Action) (*models.CanonicalProduct, error) {
+	product, err := s.CanonicalProductModel.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.Authorizer.Authorize(ctx, userID, product.InventoryID, action); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"ukoni/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// deletedUserLabel stands in for a deleted user's name and email in the
+// activity history.
+const deletedUserLabel = "deleted user"
+
+// recentLoginWindow is how soon after signing in a user without a password,
+// who has nothing to confirm with, may delete their account.
+const recentLoginWindow = 10 * time.Minute
+
+type UserService struct {
+	UserModel        *models.UserModel
+	InventoryModel   *models.InventoryModel
+	MembershipModel  *models.MembershipModel
+	SessionModel     *models.SessionModel
+	APIKeyModel      *models.APIKeyModel
+	IdentityModel    *models.UserIdentityModel
+	ActivityLogModel *models.ActivityLogModel
+	TransferModel    *models.InventoryTransferModel
+
+	// AuthService sends the verification email when the address changes.
+	AuthService        *AuthService
+	ActivityLogService *ActivityLogService
+}
+
+// UpdateProfileInput holds the profile fields to change; nil fields are left
+// as they are.
+type UpdateProfileInput struct {
+	Name  *string
+	Email *string
+}
+
+func (s *UserService) GetProfile(userID string) (*models.User, error) {
+	user, err := s.UserModel.GetByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateProfile changes a user's name or email. A new email must be verified
+// again, so a verification link is sent to it.
+func (s *UserService) UpdateProfile(userID string, input UpdateProfileInput) (*models.User, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldName, oldEmail := user.Name, user.Email
+	ctx := context.Background()
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		v := &ValidationError{}
+		validateName(v, "name", name)
+		if err := v.Err(); err != nil {
+			return nil, err
+		}
+		user.Name = name
+	}
+
+	emailChanged := false
+	if input.Email != nil {
+		email := NormalizeEmail(*input.Email)
+		v := &ValidationError{}
+		validateEmail(v, "email", email)
+		if err := v.Err(); err != nil {
+			return nil, err
+		}
+		if email != user.Email {
+			taken, err := s.UserModel.EmailTaken(ctx, email, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				return nil, errEmailTaken("email")
+			}
+			user.Email = email
+			emailChanged = true
+		}
+	}
+
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.UserModel.UpdateProfile(ctx, tx, user); err != nil {
+		return nil, emailConflict(err)
+	}
+
+	if emailChanged {
+		if err := s.AuthService.sendVerification(ctx, tx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.ActivityLogService != nil {
+		metadata := map[string]interface{}{}
+		recordChange(metadata, "name", &oldName, &user.Name)
+		recordChange(metadata, "email", &oldEmail, &user.Email)
+		if len(metadata) > 0 {
+			if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &user.ID, "user.updated", "user", &user.ID, metadata); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeleteAccount closes a user's account after checking their password, or,
+// for users who only sign in through an identity provider, that sessionID
+// signed in within recentLoginWindow. Ownership transfers they offered or
+// were offered are cancelled. Each inventory they own passes to its
+// longest-standing admin, or is archived for good when there is none. Their
+// memberships and sessions end, and their name and email are scrubbed from
+// the account and the activity history.
+func (s *UserService) DeleteAccount(userID, sessionID, password string) error {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if user.PasswordHash == "" {
+		if err := s.requireRecentLogin(ctx, userID, sessionID); err != nil {
+			return err
+		}
+	} else if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := s.TransferModel.CancelPendingForUser(ctx, tx, userID, now); err != nil {
+		return err
+	}
+	owned, err := s.InventoryModel.ListOwnedForUpdate(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, inventory := range owned {
+		if err := s.handOver(ctx, tx, inventory, userID, now); err != nil {
+			return err
+		}
+	}
+
+	left, err := s.MembershipModel.RemoveAllForUser(ctx, tx, userID, now)
+	if err != nil {
+		return err
+	}
+	if s.ActivityLogService != nil {
+		for _, inventoryID := range left {
+			if err := s.ActivityLogService.LogActivity(ctx, tx, &inventoryID, &userID, "inventory_membership.deleted", "inventory_membership", &userID, map[string]interface{}{
+				"reason": "account_deleted",
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.SessionModel.RevokeAllForUser(ctx, tx, userID, "", now); err != nil {
+		return err
+	}
+	if err := s.APIKeyModel.RevokeAllForUser(ctx, tx, userID, now); err != nil {
+		return err
+	}
+	if err := s.IdentityModel.DeleteAllForUser(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err := s.ActivityLogModel.Anonymise(ctx, tx, userID, user.Name, user.Email, deletedUserLabel); err != nil {
+		return err
+	}
+	if err := s.UserModel.DeleteAnonymised(ctx, tx, userID, now); err != nil {
+		return err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &userID, "user.deleted", "user", &userID, nil); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// requireRecentLogin checks that the session making a request signed in
+// within recentLoginWindow. Refreshing a session does not count as signing in.
+func (s *UserService) requireRecentLogin(ctx context.Context, userID, sessionID string) error {
+	now := time.Now()
+	session, err := s.SessionModel.GetActive(ctx, userID, sessionID, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrReauthenticationRequired
+	}
+	if err != nil {
+		return err
+	}
+	if now.Sub(session.AuthenticatedAt) > recentLoginWindow {
+		return ErrReauthenticationRequired
+	}
+	return nil
+}
+
+// handOver moves an inventory away from an owner who is leaving. Without an
+// admin to take it over the inventory is archived, and as only an owner or
+// admin can unarchive it, it stays read-only for its remaining members.
+func (s *UserService) handOver(ctx context.Context, tx *sql.Tx, inventory *models.Inventory, userID string, now time.Time) error {
+	newOwner, err := s.MembershipModel.OldestAdmin(ctx, tx, inventory.ID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err == sql.ErrNoRows {
+		if err := s.InventoryModel.Archive(ctx, tx, inventory.ID, now); err != nil {
+			return err
+		}
+		if s.ActivityLogService != nil {
+			return s.ActivityLogService.LogActivity(ctx, tx, &inventory.ID, &userID, "inventory.archived", "inventory", &inventory.ID, map[string]interface{}{
+				"reason": "owner_deleted",
+			})
+		}
+		return nil
+	}
+
+	if err := s.InventoryModel.SetOwner(ctx, tx, inventory.ID, newOwner); err != nil {
+		return err
+	}
+	if s.ActivityLogService != nil {
+		return s.ActivityLogService.LogActivity(ctx, tx, &inventory.ID, &userID, "inventory.ownership_transferred", "inventory", &inventory.ID, map[string]interface{}{
+			"old_owner_user_id": userID,
+			"new_owner_user_id": newOwner,
+			"reason":            "owner_deleted",
+		})
+	}
+	return nil
+}
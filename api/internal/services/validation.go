@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Field error codes.
+const (
+	CodeRequired = "required"
+	CodeInvalid  = "invalid"
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeTaken    = "taken"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes.
+	maxPasswordBytes = 72
+	maxNameLength    = 255
+	maxEmailLength   = 255
+)
+
+// FieldError explains why one input field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// ValidationError collects every field error found in a request so they can
+// be reported together.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		parts = append(parts, fe.Field+": "+fe.Code)
+	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
+
+func (e *ValidationError) Add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Has reports whether any field failed with code.
+func (e *ValidationError) Has(code string) bool {
+	for _, fe := range e.Errors {
+		if fe.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns e if any field failed, or nil.
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func fieldError(field, code, message string) error {
+	v := &ValidationError{}
+	v.Add(field, code, message)
+	return v
+}
+
+func errEmailTaken(field string) error {
+	return fieldError(field, CodeTaken, "an account with this email already exists")
+}
+
+// emailConflict turns a unique violation on users' email, which happens when
+// two signups for the same address race past the EmailTaken check, into the
+// same field error the check would have returned.
+func emailConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_email_lower_idx" {
+		return errEmailTaken("email")
+	}
+	return err
+}
+
+// NormalizeEmail trims and lowercases an email address so that each address
+// maps to one account however it is typed.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateEmail checks an already normalised email address.
+func validateEmail(v *ValidationError, field, email string) {
+	switch {
+	case email == "":
+		v.Add(field, CodeRequired, "email is required")
+	case len(email) > maxEmailLength:
+		v.Add(field, CodeTooLong, "email is too long")
+	default:
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@")+1:], ".") {
+			v.Add(field, CodeInvalid, "email is not a valid address")
+		}
+	}
+}
+
+func validateName(v *ValidationError, field, name string) {
+	switch {
+	case strings.TrimSpace(name) == "":
+		v.Add(field, CodeRequired, "name is required")
+	case utf8.RuneCountInString(name) > maxNameLength:
+		v.Add(field, CodeTooLong, "name is too long")
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		v.Add(field, CodeInvalid, "name cannot contain control characters such as line breaks")
+	}
+}
+
+// validatePassword applies the password policy: at least 8 characters, and
+// no more than bcrypt can use.
+func validatePassword(v *ValidationError, field, password string) {
+	switch {
+	case password == "":
+		v.Add(field, CodeRequired, "password is required")
+	case utf8.RuneCountInString(password) < minPasswordLength:
+		v.Add(field, CodeTooShort, "password must be at least 8 characters")
+	case len(password) > maxPasswordBytes:
+		v.Add(field, CodeTooLong, "password must be at most 72 bytes")
+	case strings.TrimSpace(password) == "":
+		v.Add(field, CodeInvalid, "password cannot be only spaces")
+	}
+}
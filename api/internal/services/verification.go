@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"ukoni/internal/database"
+	"ukoni/internal/models"
+	"ukoni/internal/notify"
+)
+
+// emailVerificationTTL is how long a verification link can be used for.
+const emailVerificationTTL = 48 * time.Hour
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+	ErrEmailNotVerified         = errors.New("email address must be verified first")
+)
+
+// requireVerifiedEmail refuses users who haven't verified their email when
+// enforce is set.
+func requireVerifiedEmail(enforce bool, user *models.User) error {
+	if enforce && user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// sendVerification queues a link proving ownership of the user's current
+// email, voiding any earlier links.
+func (s *AuthService) sendVerification(ctx context.Context, dbtx database.DBTX, user *models.User) error {
+	now := time.Now()
+	if err := s.EmailVerificationModel.UseAllForUser(ctx, dbtx, user.ID, now); err != nil {
+		return err
+	}
+
+	token, err := generateSecret()
+	if err != nil {
+		return err
+	}
+	verification := &models.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(emailVerificationTTL),
+	}
+	if err := s.EmailVerificationModel.Create(ctx, dbtx, verification); err != nil {
+		return err
+	}
+
+	if s.Outbox == nil {
+		return nil
+	}
+	return s.Outbox.Enqueue(ctx, dbtx, user.Email, notify.EmailVerificationEmail{
+		Name:      user.Name,
+		VerifyURL: s.Outbox.Links.VerifyEmail(token),
+		ExpiresAt: verification.ExpiresAt,
+	})
+}
+
+// VerifyEmail marks the address a verification token was sent to as
+// verified. The token then stops working.
+func (s *AuthService) VerifyEmail(token string) error {
+	ctx := context.Background()
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	verification, err := s.EmailVerificationModel.GetByHashForUpdate(ctx, tx, hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+	if verification.UsedAt != nil || !verification.ExpiresAt.After(now) {
+		return ErrInvalidVerificationToken
+	}
+
+	if err := s.UserModel.MarkEmailVerified(ctx, tx, verification.UserID, verification.Email, now); err != nil {
+		if err == sql.ErrNoRows {
+			// The user has since moved to a different address.
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+	if err := s.EmailVerificationModel.UseAllForUser(ctx, tx, verification.UserID, now); err != nil {
+		return err
+	}
+
+	if s.ActivityLogService != nil {
+		if err := s.ActivityLogService.LogActivity(ctx, tx, nil, &verification.UserID, "user.email_verified", "user", &verification.UserID, map[string]interface{}{
+			"email": verification.Email,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ResendVerification sends a new verification link to a user who hasn't
+// verified their email yet.
+func (s *AuthService) ResendVerification(userID string) error {
+	user, err := s.UserModel.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	ctx := context.Background()
+	tx, err := s.UserModel.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.sendVerification(ctx, tx, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
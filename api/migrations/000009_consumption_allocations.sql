@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE consumption_allocations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    consumption_event_id UUID NOT NULL REFERENCES consumption_events(id),
+    inventory_product_id UUID NOT NULL REFERENCES inventory_products(id),
+    product_variant_id UUID NOT NULL REFERENCES product_variants(id),
+    quantity DECIMAL NOT NULL,
+    unit VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    reversed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX consumption_allocations_event_idx ON consumption_allocations(consumption_event_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS consumption_allocations_event_idx;
+DROP TABLE IF EXISTS consumption_allocations;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE inventory_adjustments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    inventory_id UUID NOT NULL REFERENCES inventories(id),
+    inventory_product_id UUID NOT NULL REFERENCES inventory_products(id),
+    product_variant_id UUID NOT NULL REFERENCES product_variants(id),
+    adjustment_type VARCHAR(50) NOT NULL CHECK (adjustment_type IN ('stock_take', 'spoilage', 'gift', 'correction')),
+    quantity_change DECIMAL NOT NULL,
+    quantity_before DECIMAL NOT NULL,
+    quantity_after DECIMAL NOT NULL,
+    unit VARCHAR(100),
+    note TEXT,
+    created_by_user_id UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX inventory_adjustments_product_idx ON inventory_adjustments(inventory_product_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS inventory_adjustments_product_idx;
+DROP TABLE IF EXISTS inventory_adjustments;
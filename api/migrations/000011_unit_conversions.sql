@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE unit_conversions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    canonical_product_id UUID NOT NULL REFERENCES canonical_products(id),
+    from_unit VARCHAR(100) NOT NULL,
+    to_unit VARCHAR(100) NOT NULL,
+    factor DECIMAL NOT NULL CHECK (factor > 0),
+    confidence DECIMAL NOT NULL DEFAULT 1 CHECK (confidence > 0 AND confidence <= 1),
+    note TEXT,
+    created_by_user_id UUID REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+CREATE UNIQUE INDEX unit_conversions_product_units_idx
+    ON unit_conversions(canonical_product_id, from_unit, to_unit)
+    WHERE deleted_at IS NULL;
+
+ALTER TABLE consumption_allocations ADD COLUMN confidence DECIMAL NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE consumption_allocations DROP COLUMN IF EXISTS confidence;
+DROP INDEX IF EXISTS unit_conversions_product_units_idx;
+DROP TABLE IF EXISTS unit_conversions;
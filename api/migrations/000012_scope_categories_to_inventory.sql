@@ -0,0 +1,107 @@
+-- +goose Up
+-- Categories were shared by every inventory; now each belongs to one. An
+-- inventory gets each category its products use, along with the category's
+-- ancestors. The first inventory to need a category keeps the row and the
+-- others get copies, so every product keeps its categorisation. Categories no
+-- product uses have nowhere to go and are dropped.
+ALTER TABLE product_categories ADD COLUMN inventory_id UUID REFERENCES inventories(id);
+ALTER TABLE product_categories ADD COLUMN created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE product_categories ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+CREATE TEMPORARY TABLE category_homes ON COMMIT DROP AS
+WITH RECURSIVE used (category_id, inventory_id) AS (
+    SELECT category_id, inventory_id FROM (
+        SELECT category_id, inventory_id FROM products WHERE category_id IS NOT NULL
+        UNION
+        SELECT category_id, inventory_id FROM canonical_products WHERE category_id IS NOT NULL
+    ) direct
+    UNION
+    SELECT pc.parent_category_id, used.inventory_id
+    FROM used
+    JOIN product_categories pc ON pc.id = used.category_id
+    WHERE pc.parent_category_id IS NOT NULL
+)
+SELECT used.category_id, used.inventory_id,
+    CASE WHEN ROW_NUMBER() OVER (PARTITION BY used.category_id ORDER BY i.created_at, i.id) = 1
+        THEN used.category_id ELSE uuid_generate_v4() END AS home_id
+FROM used
+JOIN inventories i ON i.id = used.inventory_id;
+
+UPDATE product_categories pc SET inventory_id = h.inventory_id
+    FROM category_homes h WHERE h.category_id = pc.id AND h.home_id = pc.id;
+INSERT INTO product_categories (id, inventory_id, name, parent_category_id, deleted_at)
+    SELECT h.home_id, h.inventory_id, pc.name, pc.parent_category_id, pc.deleted_at
+    FROM category_homes h
+    JOIN product_categories pc ON pc.id = h.category_id
+    WHERE h.home_id <> h.category_id;
+
+-- Parents, products and canonical products point at the row of their own
+-- inventory.
+UPDATE product_categories pc SET parent_category_id = h.home_id
+    FROM category_homes h WHERE h.category_id = pc.parent_category_id AND h.inventory_id = pc.inventory_id;
+UPDATE products p SET category_id = h.home_id
+    FROM category_homes h WHERE h.category_id = p.category_id AND h.inventory_id = p.inventory_id;
+UPDATE canonical_products cp SET category_id = h.home_id
+    FROM category_homes h WHERE h.category_id = cp.category_id AND h.inventory_id = cp.inventory_id;
+
+DELETE FROM product_categories WHERE inventory_id IS NULL;
+ALTER TABLE product_categories ALTER COLUMN inventory_id SET NOT NULL;
+
+-- Sibling names were never checked, so an inventory may now hold two
+-- categories of the same name under one parent. The one with the most
+-- products keeps the name; the others get the first free " (2)", " (3)", ...
+-- suffix, and each rename is logged so it can be found and fixed by hand.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    dup RECORD;
+    n INT;
+    candidate TEXT;
+BEGIN
+    FOR dup IN
+        SELECT id, inventory_id, parent_category_id, name FROM (
+            SELECT pc.id, pc.inventory_id, pc.parent_category_id, pc.name,
+                ROW_NUMBER() OVER (
+                    PARTITION BY pc.inventory_id, pc.parent_category_id, LOWER(pc.name)
+                    ORDER BY (SELECT COUNT(*) FROM products p WHERE p.category_id = pc.id) DESC, pc.id
+                ) AS rank
+            FROM product_categories pc
+            WHERE pc.deleted_at IS NULL
+        ) ranked
+        WHERE rank > 1
+        ORDER BY inventory_id, LOWER(name), rank
+    LOOP
+        n := 2;
+        LOOP
+            candidate := LEFT(dup.name, 255 - LENGTH(' (' || n || ')')) || ' (' || n || ')';
+            EXIT WHEN NOT EXISTS (
+                SELECT 1 FROM product_categories
+                WHERE inventory_id = dup.inventory_id
+                    AND parent_category_id IS NOT DISTINCT FROM dup.parent_category_id
+                    AND LOWER(name) = LOWER(candidate) AND deleted_at IS NULL
+            );
+            n := n + 1;
+        END LOOP;
+
+        UPDATE product_categories SET name = candidate WHERE id = dup.id;
+        INSERT INTO activity_logs (inventory_id, action, entity_type, entity_id, metadata)
+        VALUES (dup.inventory_id, 'category.updated', 'category', dup.id,
+            jsonb_build_object('old_name', dup.name, 'new_name', candidate, 'reason', 'duplicate_name'));
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+CREATE INDEX product_categories_inventory_idx ON product_categories(inventory_id, parent_category_id);
+CREATE UNIQUE INDEX product_categories_sibling_name_idx
+    ON product_categories(inventory_id, COALESCE(parent_category_id, '00000000-0000-0000-0000-000000000000'), LOWER(name))
+    WHERE deleted_at IS NULL;
+
+-- +goose Down
+-- Copies made for other inventories are kept; they can't be told apart from
+-- categories created since.
+DROP INDEX IF EXISTS product_categories_sibling_name_idx;
+DROP INDEX IF EXISTS product_categories_inventory_idx;
+ALTER TABLE product_categories DROP COLUMN updated_at;
+ALTER TABLE product_categories DROP COLUMN created_at;
+ALTER TABLE product_categories DROP COLUMN inventory_id;
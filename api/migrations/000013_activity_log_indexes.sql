@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE INDEX activity_logs_inventory_created_idx
+    ON activity_logs(inventory_id, created_at DESC, id DESC);
+CREATE INDEX activity_logs_entity_created_idx
+    ON activity_logs(entity_type, entity_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS activity_logs_entity_created_idx;
+DROP INDEX IF EXISTS activity_logs_inventory_created_idx;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE shopping_list_items ADD COLUMN quantity DECIMAL CHECK (quantity > 0);
+ALTER TABLE shopping_list_items ADD COLUMN unit VARCHAR(50);
+
+-- +goose Down
+ALTER TABLE shopping_list_items DROP COLUMN IF EXISTS unit;
+ALTER TABLE shopping_list_items DROP COLUMN IF EXISTS quantity;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Archived inventories are kept read-only, e.g. when their owner deletes
+-- their account and no admin is left to take them over.
+ALTER TABLE inventories ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE inventories DROP COLUMN IF EXISTS archived_at;
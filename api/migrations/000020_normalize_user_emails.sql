@@ -0,0 +1,35 @@
+-- +goose Up
+-- Emails are now stored trimmed and lowercased, and compared
+-- case-insensitively. Deleted accounts no longer hold on to their address.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+-- Accounts whose emails only differ by case or surrounding spaces can't be
+-- merged automatically: each may own inventories and history. Stop and name
+-- them so they can be merged or deleted by hand before migrating again.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(email || ' (' || ids || ')', '; ' ORDER BY email) INTO duplicates
+    FROM (
+        SELECT LOWER(TRIM(email)) AS email, string_agg(id::text, ', ' ORDER BY created_at, id) AS ids
+        FROM users
+        WHERE deleted_at IS NULL
+        GROUP BY LOWER(TRIM(email))
+        HAVING COUNT(*) > 1
+    ) dup;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'users share an email address once case and spaces are ignored; merge or delete them first: %', duplicates;
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+UPDATE users SET email = LOWER(TRIM(email)) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_email_lower_idx ON users (LOWER(email)) WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS users_email_lower_idx;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
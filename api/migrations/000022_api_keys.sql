@@ -0,0 +1,21 @@
+-- +goose Up
+-- Personal access tokens. Only a hash of each key is kept; the prefix is
+-- stored in the clear so users can tell their keys apart.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    inventory_id UUID REFERENCES inventories(id),
+    scope VARCHAR(16) NOT NULL DEFAULT 'read_write' CHECK (scope IN ('read', 'read_write')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX api_keys_user_idx ON api_keys (user_id) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Offers to hand an inventory to another admin. Ownership only moves once
+-- the new owner accepts; an inventory has at most one open offer.
+CREATE TABLE inventory_transfers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    inventory_id UUID NOT NULL REFERENCES inventories(id),
+    from_user_id UUID NOT NULL REFERENCES users(id),
+    to_user_id UUID NOT NULL REFERENCES users(id),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX inventory_transfers_pending_idx ON inventory_transfers (inventory_id) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE IF EXISTS inventory_transfers;
@@ -0,0 +1,67 @@
+-- +goose Up
+-- Variants carry their inventory so their SKU and barcode (GTIN) can be
+-- unique within it. Scanners read barcodes with or without leading zeros, so
+-- GTINs are compared padded to 14 digits.
+ALTER TABLE product_variants ADD COLUMN inventory_id UUID REFERENCES inventories(id);
+UPDATE product_variants pv SET inventory_id = p.inventory_id FROM products p WHERE p.id = pv.product_id;
+ALTER TABLE product_variants ALTER COLUMN inventory_id SET NOT NULL;
+ALTER TABLE product_variants ADD COLUMN gtin VARCHAR(14);
+
+-- Variants of deleted products could never be reached again.
+UPDATE product_variants pv SET deleted_at = p.deleted_at
+    FROM products p WHERE p.id = pv.product_id AND p.deleted_at IS NOT NULL AND pv.deleted_at IS NULL;
+
+-- SKUs were never checked, so the same one may be on several variants. The
+-- variant of the oldest product keeps it; the others get the first free
+-- "-2", "-3", ... suffix, and each rename is logged so it can be found and
+-- fixed by hand.
+UPDATE product_variants SET sku = NULLIF(TRIM(sku), '');
+-- +goose StatementBegin
+DO $$
+DECLARE
+    dup RECORD;
+    n INT;
+    candidate TEXT;
+BEGIN
+    FOR dup IN
+        SELECT id, inventory_id, sku FROM (
+            SELECT pv.id, pv.inventory_id, pv.sku,
+                ROW_NUMBER() OVER (PARTITION BY pv.inventory_id, LOWER(pv.sku) ORDER BY p.created_at, pv.id) AS rank
+            FROM product_variants pv
+            JOIN products p ON p.id = pv.product_id
+            WHERE pv.sku IS NOT NULL AND pv.deleted_at IS NULL
+        ) ranked
+        WHERE rank > 1
+        ORDER BY inventory_id, LOWER(sku), rank
+    LOOP
+        n := 2;
+        LOOP
+            candidate := LEFT(dup.sku, 255 - LENGTH('-' || n)) || '-' || n;
+            EXIT WHEN NOT EXISTS (
+                SELECT 1 FROM product_variants
+                WHERE inventory_id = dup.inventory_id AND LOWER(sku) = LOWER(candidate) AND deleted_at IS NULL
+            );
+            n := n + 1;
+        END LOOP;
+
+        UPDATE product_variants SET sku = candidate WHERE id = dup.id;
+        INSERT INTO activity_logs (inventory_id, action, entity_type, entity_id, metadata)
+        VALUES (dup.inventory_id, 'product_variant.updated', 'product_variant', dup.id,
+            jsonb_build_object('old_sku', dup.sku, 'new_sku', candidate, 'reason', 'duplicate_sku'));
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+CREATE UNIQUE INDEX product_variants_sku_idx
+    ON product_variants (inventory_id, LOWER(sku))
+    WHERE sku IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX product_variants_gtin_idx
+    ON product_variants (inventory_id, LPAD(gtin, 14, '0'))
+    WHERE gtin IS NOT NULL AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS product_variants_gtin_idx;
+DROP INDEX IF EXISTS product_variants_sku_idx;
+ALTER TABLE product_variants DROP COLUMN gtin;
+ALTER TABLE product_variants DROP COLUMN inventory_id;
@@ -7,7 +7,11 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"ukoni/internal/models"
+	"ukoni/internal/services"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestActivityLog(t *testing.T) {
@@ -65,3 +69,115 @@ func TestActivityLog(t *testing.T) {
 		assert.Equal(t, inventoryID, entityID)
 	})
 }
+
+func TestActivityRead(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createTransactionTestUser(router, "activity-owner@example.com")
+	inventoryID := createTransactionTestInventory(router, token)
+	viewerToken := addTestMember(t, router, token, inventoryID, "activity-viewer@example.com", "viewer")
+	outsiderToken := createTransactionTestUser(router, "activity-outsider@example.com")
+
+	listActivity := func(query string) services.ActivityPage {
+		rr := doRequest(router, viewerToken, "GET", "/inventories/"+inventoryID+"/activity"+query, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var page services.ActivityPage
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		return page
+	}
+
+	rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/products", map[string]string{"name": "Oats"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var product models.Product
+	json.Unmarshal(rr.Body.Bytes(), &product)
+
+	rr = doRequest(router, token, "PUT", "/products/"+product.ID, map[string]string{"name": "Rolled Oats"})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = doRequest(router, token, "POST", "/products/"+product.ID+"/variants", map[string]string{"variant_name": "1kg Bag"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	createTestVariant(t, router, token, inventoryID)
+
+	t.Run("Newest First", func(t *testing.T) {
+		page := listActivity("")
+		require.NotEmpty(t, page.Items)
+		for i := 1; i < len(page.Items); i++ {
+			assert.False(t, page.Items[i].CreatedAt.After(page.Items[i-1].CreatedAt))
+		}
+		assert.Equal(t, "inventory.created", page.Items[len(page.Items)-1].Action)
+		assert.Nil(t, page.NextCursor)
+	})
+
+	t.Run("Action Prefix", func(t *testing.T) {
+		page := listActivity("?action=product.*")
+		require.Len(t, page.Items, 3)
+		for _, item := range page.Items {
+			assert.Contains(t, []string{"product.created", "product.updated"}, item.Action)
+		}
+
+		page = listActivity("?action=product.updated")
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "Oats", page.Items[0].Metadata["old_name"])
+		assert.Equal(t, "Rolled Oats", page.Items[0].Metadata["new_name"])
+	})
+
+	t.Run("Entity And Actor", func(t *testing.T) {
+		page := listActivity("?entity_type=product&entity_id=" + product.ID)
+		assert.Len(t, page.Items, 2)
+
+		page = listActivity("?actor=" + product.ID)
+		assert.Empty(t, page.Items)
+	})
+
+	t.Run("Time Range", func(t *testing.T) {
+		page := listActivity("?until=2000-01-01T00:00:00Z")
+		assert.Empty(t, page.Items)
+
+		rr := doRequest(router, viewerToken, "GET", "/inventories/"+inventoryID+"/activity?since=yesterday", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Cursor Pagination", func(t *testing.T) {
+		all := listActivity("")
+
+		seen := []string{}
+		query := "?limit=2"
+		for {
+			page := listActivity(query)
+			require.LessOrEqual(t, len(page.Items), 2)
+			for _, item := range page.Items {
+				seen = append(seen, item.ID)
+			}
+			if page.NextCursor == nil {
+				break
+			}
+			query = "?limit=2&cursor=" + *page.NextCursor
+		}
+
+		require.Len(t, seen, len(all.Items))
+		for i, item := range all.Items {
+			assert.Equal(t, item.ID, seen[i])
+		}
+
+		rr := doRequest(router, viewerToken, "GET", "/inventories/"+inventoryID+"/activity?cursor=not-a-cursor", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Product History Includes Variants", func(t *testing.T) {
+		rr := doRequest(router, viewerToken, "GET", "/products/"+product.ID+"/history", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var page services.ActivityPage
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		require.Len(t, page.Items, 3)
+		assert.Equal(t, "product_variant.created", page.Items[0].Action)
+		assert.Equal(t, "product.updated", page.Items[1].Action)
+		assert.Equal(t, "product.created", page.Items[2].Action)
+	})
+
+	t.Run("Non Member Is Forbidden", func(t *testing.T) {
+		rr := doRequest(router, outsiderToken, "GET", "/inventories/"+inventoryID+"/activity", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, outsiderToken, "GET", "/products/"+product.ID+"/history", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	token := createTransactionTestUser(router, "keys@example.com")
+	homeID := createTransactionTestInventory(router, token)
+	officeID := createTransactionTestInventory(router, token)
+
+	createKey := func(t *testing.T, payload map[string]interface{}) (string, string) {
+		rr := doRequest(router, token, "POST", "/me/api-keys", payload)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var key map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &key)
+		return key["id"].(string), key["token"].(string)
+	}
+
+	t.Run("Create And List", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/me/api-keys", map[string]interface{}{"name": "Home Assistant"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var created map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		secret := created["token"].(string)
+		assert.True(t, strings.HasPrefix(secret, "uk_"))
+		assert.True(t, strings.HasPrefix(secret, created["prefix"].(string)))
+		assert.Equal(t, "read_write", created["scope"])
+		assert.NotContains(t, created, "token_hash")
+
+		var stored int
+		testDB.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE token_hash = $1`, secret).Scan(&stored)
+		assert.Equal(t, 0, stored, "keys are stored hashed")
+
+		rr = doRequest(router, token, "GET", "/me/api-keys", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var keys []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &keys)
+		require.Len(t, keys, 1)
+		assert.Equal(t, created["prefix"], keys[0]["prefix"])
+		assert.NotContains(t, keys[0], "token")
+	})
+
+	t.Run("Invalid Input", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/me/api-keys", map[string]interface{}{"name": "", "scope": "admin"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, token, "POST", "/me/api-keys", map[string]interface{}{
+			"name":       "Expired",
+			"expires_at": time.Now().Add(-time.Hour),
+		})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Authenticates Requests", func(t *testing.T) {
+		_, key := createKey(t, map[string]interface{}{"name": "Script"})
+
+		rr := doRequest(router, key, "GET", "/inventories/"+homeID+"/categories", nil)
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, key, "POST", "/inventories/"+homeID+"/categories", map[string]string{"name": "Dairy"})
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var lastUsed *time.Time
+		testDB.QueryRow(`SELECT last_used_at FROM api_keys WHERE name = 'Script'`).Scan(&lastUsed)
+		assert.NotNil(t, lastUsed)
+	})
+
+	t.Run("Read Only", func(t *testing.T) {
+		_, key := createKey(t, map[string]interface{}{"name": "Dashboard", "scope": "read"})
+
+		rr := doRequest(router, key, "GET", "/inventories/"+homeID+"/categories", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doRequest(router, key, "POST", "/inventories/"+homeID+"/categories", map[string]string{"name": "Bakery"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, key, "POST", "/inventories", map[string]string{"name": "Sneaky"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, key, "POST", "/sellers", map[string]string{"name": "Sneaky Shop", "type": "independent"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, token, "POST", "/sellers", map[string]string{"name": "Corner Shop", "type": "independent"})
+		require.Equal(t, http.StatusCreated, rr.Code)
+		var seller map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &seller)
+		sellerID := seller["id"].(string)
+
+		rr = doRequest(router, key, "GET", "/sellers/"+sellerID, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = doRequest(router, key, "PUT", "/sellers/"+sellerID, map[string]string{"name": "Renamed", "type": "independent"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = doRequest(router, key, "DELETE", "/sellers/"+sellerID, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = doRequest(router, key, "POST", "/sellers/"+sellerID+"/outlets", map[string]string{"name": "High Street"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Restricted To One Inventory", func(t *testing.T) {
+		_, key := createKey(t, map[string]interface{}{"name": "Home Only", "inventory_id": homeID})
+
+		rr := doRequest(router, key, "GET", "/inventories/"+homeID+"/categories", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doRequest(router, key, "GET", "/inventories/"+officeID+"/categories", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, key, "GET", "/inventories", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var inventories []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &inventories)
+		require.Len(t, inventories, 1)
+		assert.Equal(t, homeID, inventories[0]["id"])
+
+		rr = doRequest(router, key, "POST", "/inventories", map[string]string{"name": "Sneaky"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Cannot Manage The Account", func(t *testing.T) {
+		_, key := createKey(t, map[string]interface{}{"name": "Limited"})
+
+		rr := doRequest(router, key, "GET", "/me", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		for _, path := range []string{"/me/api-keys", "/auth/sessions"} {
+			rr = doRequest(router, key, "GET", path, nil)
+			assert.Equal(t, http.StatusForbidden, rr.Code, path)
+		}
+
+		rr = doRequest(router, key, "POST", "/me/password", map[string]string{"current_password": "password123", "new_password": "new-password123"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		id, key := createKey(t, map[string]interface{}{"name": "Temporary"})
+
+		rr := doRequest(router, token, "DELETE", "/me/api-keys/"+id, nil)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = doRequest(router, key, "GET", "/inventories", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = doRequest(router, token, "DELETE", "/me/api-keys/"+id, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		id, key := createKey(t, map[string]interface{}{
+			"name":       "Short Lived",
+			"expires_at": time.Now().Add(time.Hour),
+		})
+
+		rr := doRequest(router, key, "GET", "/inventories", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		testDB.Exec(`UPDATE api_keys SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, id)
+		rr = doRequest(router, key, "GET", "/inventories", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Other Users Cannot Revoke", func(t *testing.T) {
+		id, _ := createKey(t, map[string]interface{}{"name": "Mine"})
+		other := createTransactionTestUser(router, "other-keys@example.com")
+
+		rr := doRequest(router, other, "DELETE", "/me/api-keys/"+id, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
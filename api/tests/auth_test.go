@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSignup(t *testing.T) {
@@ -56,7 +58,80 @@ func TestSignup(t *testing.T) {
 
 		router.ServeHTTP(rr, req2)
 
-		assert.Equal(t, http.StatusInternalServerError, rr.Code) // Ideally this should be 409 Conflict, but checking current behavior
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		var response struct {
+			Errors []map[string]string `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		require.Len(t, response.Errors, 1)
+		assert.Equal(t, "email", response.Errors[0]["field"])
+		assert.Equal(t, "taken", response.Errors[0]["code"])
+
+		// Emails are compared case-insensitively
+		payload["email"] = "  Duplicate@Example.COM "
+		body, _ = json.Marshal(payload)
+		req3, _ := http.NewRequest("POST", "/signup", bytes.NewBuffer(body))
+		req3.Header.Set("Content-Type", "application/json")
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req3)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Email Is Normalised", func(t *testing.T) {
+		payload := map[string]string{
+			"name":     "Mixed Case",
+			"email":    " Mixed.Case@Example.com ",
+			"password": "password123",
+		}
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/signup", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var response struct {
+			User struct {
+				Email string `json:"email"`
+			} `json:"user"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, "mixed.case@example.com", response.User.Email)
+	})
+
+	t.Run("Invalid Fields", func(t *testing.T) {
+		payload := map[string]string{
+			"name":     " ",
+			"email":    "not-an-email",
+			"password": "short",
+		}
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/signup", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		var response struct {
+			Errors []map[string]string `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		codes := map[string]string{}
+		for _, e := range response.Errors {
+			codes[e["field"]] = e["code"]
+		}
+		assert.Equal(t, map[string]string{
+			"name":     "required",
+			"email":    "invalid",
+			"password": "too_short",
+		}, codes)
 	})
 }
 
@@ -96,6 +171,22 @@ func TestLogin(t *testing.T) {
 		assert.NotEmpty(t, response["token"])
 	})
 
+	t.Run("Email Case Is Ignored", func(t *testing.T) {
+		payload := map[string]string{
+			"email":    " LOGIN@example.com",
+			"password": "password123",
+		}
+		body, _ := json.Marshal(payload)
+
+		req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
 	t.Run("Invalid Credentials", func(t *testing.T) {
 		payload := map[string]string{
 			"email":    "login@example.com",
@@ -112,3 +203,322 @@ func TestLogin(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 	})
 }
+
+func TestSessions(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	do := func(token, method, path string, payload interface{}) *httptest.ResponseRecorder {
+		req := newJSONRequest(token, method, path, payload)
+		req.Header.Set("User-Agent", "session-test")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	do("", "POST", "/signup", map[string]string{"name": "Session User", "email": "session@example.com", "password": "password123"})
+
+	login := func() (string, string) {
+		rr := do("", "POST", "/login", map[string]string{"email": "session@example.com", "password": "password123"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		require.NotEmpty(t, response["refresh_token"])
+		return response["token"].(string), response["refresh_token"].(string)
+	}
+
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		return do("", "POST", "/auth/refresh", map[string]string{"refresh_token": refreshToken})
+	}
+
+	t.Run("Refresh Rotates The Token", func(t *testing.T) {
+		access, refreshToken := login()
+
+		rr := refresh(refreshToken)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var rotated map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &rotated)
+		assert.NotEqual(t, refreshToken, rotated["refresh_token"])
+		assert.Equal(t, http.StatusOK, do(rotated["token"].(string), "GET", "/inventories", nil).Code)
+		assert.Equal(t, http.StatusOK, do(access, "GET", "/inventories", nil).Code)
+
+		rr = refresh("not-a-refresh-token")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Reusing A Refresh Token Revokes The Session", func(t *testing.T) {
+		_, refreshToken := login()
+
+		rr := refresh(refreshToken)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var rotated map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &rotated)
+
+		rr = refresh(refreshToken)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		// The whole family is gone, including the token issued by the
+		// legitimate refresh.
+		rr = refresh(rotated["refresh_token"].(string))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, http.StatusUnauthorized, do(rotated["token"].(string), "GET", "/inventories", nil).Code)
+
+		var count int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'session.token_reused'`).Scan(&count)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("List Sessions", func(t *testing.T) {
+		access, _ := login()
+
+		rr := do(access, "GET", "/auth/sessions", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var sessions []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &sessions)
+		require.NotEmpty(t, sessions)
+
+		current := 0
+		for _, session := range sessions {
+			assert.Equal(t, "session-test", session["user_agent"])
+			assert.NotContains(t, session, "refresh_token_hash")
+			if session["current"] == true {
+				current++
+			}
+		}
+		assert.Equal(t, 1, current)
+	})
+
+	t.Run("Logout Ends Only That Session", func(t *testing.T) {
+		accessA, refreshA := login()
+		accessB, _ := login()
+
+		rr := do(accessA, "POST", "/auth/logout", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, do(accessA, "GET", "/inventories", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(refreshA).Code)
+		assert.Equal(t, http.StatusOK, do(accessB, "GET", "/inventories", nil).Code)
+	})
+
+	t.Run("Revoke Another Session", func(t *testing.T) {
+		accessA, _ := login()
+		accessB, _ := login()
+
+		var sessionB string
+		for _, session := range func() []map[string]interface{} {
+			var sessions []map[string]interface{}
+			json.Unmarshal(do(accessB, "GET", "/auth/sessions", nil).Body.Bytes(), &sessions)
+			return sessions
+		}() {
+			if session["current"] == true {
+				sessionB = session["id"].(string)
+			}
+		}
+		require.NotEmpty(t, sessionB)
+
+		rr := do(accessA, "DELETE", "/auth/sessions/"+sessionB, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+		assert.Equal(t, http.StatusUnauthorized, do(accessB, "GET", "/inventories", nil).Code)
+		assert.Equal(t, http.StatusOK, do(accessA, "GET", "/inventories", nil).Code)
+
+		rr = do(accessA, "DELETE", "/auth/sessions/"+sessionB, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Logout All Devices", func(t *testing.T) {
+		accessA, refreshA := login()
+		accessB, _ := login()
+
+		rr := do(accessA, "POST", "/auth/logout-all", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, do(accessA, "GET", "/inventories", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, do(accessB, "GET", "/inventories", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(refreshA).Code)
+	})
+}
+
+func TestPasswordFlows(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	login := func(password string) (int, string) {
+		rr := doRequest(router, "", "POST", "/login", map[string]string{"email": "forgetful@example.com", "password": password})
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		token, _ := response["token"].(string)
+		return rr.Code, token
+	}
+
+	rr := doRequest(router, "", "POST", "/signup", map[string]string{"name": "Forgetful", "email": "forgetful@example.com", "password": "original-pass"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	t.Run("Forgot Password For Unknown Email", func(t *testing.T) {
+		rr := doRequest(router, "", "POST", "/auth/password/forgot", map[string]string{"email": "nobody@example.com"})
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+
+		var count int
+		testDB.QueryRow(`SELECT COUNT(*) FROM email_outbox WHERE recipient = 'nobody@example.com'`).Scan(&count)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("Reset Password", func(t *testing.T) {
+		_, oldAccess := login("original-pass")
+
+		rr := doRequest(router, "", "POST", "/auth/password/forgot", map[string]string{"email": "forgetful@example.com"})
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		firstToken := lastEmailToken(t, "forgetful@example.com", "password_reset")
+
+		// Asking again replaces the earlier link.
+		rr = doRequest(router, "", "POST", "/auth/password/forgot", map[string]string{"email": "forgetful@example.com"})
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		token := lastEmailToken(t, "forgetful@example.com", "password_reset")
+		assert.NotEqual(t, firstToken, token)
+
+		rr = doRequest(router, "", "POST", "/auth/password/reset", map[string]string{"token": firstToken, "password": "reset-pass"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, "", "POST", "/auth/password/reset", map[string]string{"token": token, "password": ""})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, "", "POST", "/auth/password/reset", map[string]string{"token": token, "password": "reset-pass"})
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, doRequest(router, oldAccess, "GET", "/inventories", nil).Code)
+		code, _ := login("original-pass")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = login("reset-pass")
+		assert.Equal(t, http.StatusOK, code)
+
+		// The link only works once.
+		rr = doRequest(router, "", "POST", "/auth/password/reset", map[string]string{"token": token, "password": "another-pass"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Expired Reset Token", func(t *testing.T) {
+		doRequest(router, "", "POST", "/auth/password/forgot", map[string]string{"email": "forgetful@example.com"})
+		token := lastEmailToken(t, "forgetful@example.com", "password_reset")
+		_, err := testDB.Exec(`UPDATE password_reset_tokens SET expires_at = NOW() - INTERVAL '1 minute' WHERE used_at IS NULL`)
+		require.NoError(t, err)
+
+		rr := doRequest(router, "", "POST", "/auth/password/reset", map[string]string{"token": token, "password": "too-late"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Change Password", func(t *testing.T) {
+		_, access := login("reset-pass")
+		_, otherDevice := login("reset-pass")
+
+		rr := doRequest(router, access, "POST", "/me/password", map[string]string{"current_password": "wrong", "new_password": "changed-pass"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, access, "POST", "/me/password", map[string]string{"current_password": "reset-pass", "new_password": "changed-pass"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var tokens map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &tokens)
+
+		assert.Equal(t, http.StatusOK, doRequest(router, tokens["token"].(string), "GET", "/inventories", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, doRequest(router, access, "GET", "/inventories", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, doRequest(router, otherDevice, "GET", "/inventories", nil).Code)
+
+		code, _ := login("changed-pass")
+		assert.Equal(t, http.StatusOK, code)
+
+		var logged int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'user.password_changed'`).Scan(&logged)
+		assert.Equal(t, 1, logged)
+	})
+}
+
+// verifyTestUser verifies a user's email using the link from their latest
+// verification email.
+func verifyTestUser(t *testing.T, router *http.ServeMux, email string) {
+	body, _ := json.Marshal(map[string]string{"token": lastEmailToken(t, email, "email_verification")})
+	req, _ := http.NewRequest("POST", "/auth/verify-email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+}
+
+func TestEmailVerification(t *testing.T) {
+	clearDB()
+	enforcing := *cfg
+	enforcing.RequireVerifiedEmail = true
+	router := setupRouterWithConfig(&enforcing)
+
+	signup := func(email string, extra map[string]string) map[string]interface{} {
+		payload := map[string]string{"name": "Verifier", "email": email, "password": "password123"}
+		for k, v := range extra {
+			payload[k] = v
+		}
+		rr := doRequest(router, "", "POST", "/signup", payload)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return response
+	}
+
+	verifiedAt := func(email string) *time.Time {
+		var at *time.Time
+		testDB.QueryRow(`SELECT email_verified_at FROM users WHERE email = $1`, email).Scan(&at)
+		return at
+	}
+
+	owner := signup("owner@example.com", nil)
+	ownerToken := owner["token"].(string)
+	assert.Nil(t, owner["user"].(map[string]interface{})["email_verified_at"])
+
+	t.Run("Unverified Users Are Held Back", func(t *testing.T) {
+		rr := doRequest(router, ownerToken, "POST", "/inventories", map[string]string{"name": "Too Soon"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	var inventoryID string
+	t.Run("Verify Email", func(t *testing.T) {
+		firstToken := lastEmailToken(t, "owner@example.com", "email_verification")
+
+		rr := doRequest(router, ownerToken, "POST", "/auth/verify-email/resend", nil)
+		require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, "", "POST", "/auth/verify-email", map[string]string{"token": firstToken})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Nil(t, verifiedAt("owner@example.com"))
+
+		verifyTestUser(t, router, "owner@example.com")
+		assert.NotNil(t, verifiedAt("owner@example.com"))
+
+		rr = doRequest(router, ownerToken, "POST", "/auth/verify-email/resend", nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, ownerToken, "POST", "/inventories", map[string]string{"name": "Verified Pantry"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var inventory map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &inventory)
+		inventoryID = inventory["id"].(string)
+	})
+
+	t.Run("Unverified Users Cannot Accept Invitations", func(t *testing.T) {
+		invitee := signup("invitee@example.com", nil)
+		inviteeToken := invitee["token"].(string)
+
+		rr := doRequest(router, ownerToken, "POST", "/inventories/"+inventoryID+"/invitations", map[string]string{"email": "invitee@example.com", "role": "viewer"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		token := lastEmailToken(t, "invitee@example.com", "invitation")
+
+		rr = doRequest(router, inviteeToken, "POST", "/invitations/accept", map[string]string{"token": token})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		verifyTestUser(t, router, "invitee@example.com")
+		rr = doRequest(router, inviteeToken, "POST", "/invitations/accept", map[string]string{"token": token})
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("Signup With Invitation Is Verified", func(t *testing.T) {
+		rr := doRequest(router, ownerToken, "POST", "/inventories/"+inventoryID+"/invitations", map[string]string{"email": "newcomer@example.com", "role": "viewer"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		signup("newcomer@example.com", map[string]string{"invitation_token": lastEmailToken(t, "newcomer@example.com", "invitation")})
+		assert.NotNil(t, verifiedAt("newcomer@example.com"))
+	})
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addTestMember signs up a user, invites them to the inventory with the given
+// role and accepts the invitation on their behalf. It returns their token.
+func addTestMember(t *testing.T, router *http.ServeMux, ownerToken, inventoryID, email, role string) string {
+	token := createTransactionTestUser(router, email)
+
+	payload := map[string]string{"email": email, "role": role}
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/invitations", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var invite map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &invite)
+
+	body, _ = json.Marshal(map[string]string{"token": invitationToken(t, invite["id"].(string))})
+	req, _ = http.NewRequest("POST", "/invitations/"+invite["id"].(string)+"/accept", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	return token
+}
+
+func TestRolePermissions(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	ownerToken := createTransactionTestUser(router, "owner@example.com")
+	inventoryID := createTransactionTestInventory(router, ownerToken)
+	variantID := createTestVariant(t, router, ownerToken, inventoryID)
+
+	tokens := map[string]string{
+		"owner":  ownerToken,
+		"admin":  addTestMember(t, router, ownerToken, inventoryID, "admin@example.com", "admin"),
+		"editor": addTestMember(t, router, ownerToken, inventoryID, "editor@example.com", "editor"),
+		"viewer": addTestMember(t, router, ownerToken, inventoryID, "viewer@example.com", "viewer"),
+	}
+	outsiderToken := createTransactionTestUser(router, "outsider@example.com")
+
+	invites := 0
+	cases := []struct {
+		name    string
+		request func(token string) *httptest.ResponseRecorder
+		allowed map[string]int
+	}{
+		{
+			name: "List Products",
+			request: func(token string) *httptest.ResponseRecorder {
+				return doRequest(router, token, "GET", "/inventories/"+inventoryID+"/products", nil)
+			},
+			allowed: map[string]int{"owner": http.StatusOK, "admin": http.StatusOK, "editor": http.StatusOK, "viewer": http.StatusOK},
+		},
+		{
+			name: "View Stock",
+			request: func(token string) *httptest.ResponseRecorder {
+				return doRequest(router, token, "GET", "/inventories/"+inventoryID+"/stock", nil)
+			},
+			allowed: map[string]int{"owner": http.StatusOK, "admin": http.StatusOK, "editor": http.StatusOK, "viewer": http.StatusOK},
+		},
+		{
+			name: "Create Product",
+			request: func(token string) *httptest.ResponseRecorder {
+				return doRequest(router, token, "POST", "/inventories/"+inventoryID+"/products", map[string]string{"name": "Bread"})
+			},
+			allowed: map[string]int{"owner": http.StatusCreated, "admin": http.StatusCreated, "editor": http.StatusCreated},
+		},
+		{
+			name: "Create Shopping List",
+			request: func(token string) *httptest.ResponseRecorder {
+				return doRequest(router, token, "POST", "/inventories/"+inventoryID+"/shopping-lists", map[string]string{"name": "Weekly"})
+			},
+			allowed: map[string]int{"owner": http.StatusCreated, "admin": http.StatusCreated, "editor": http.StatusCreated},
+		},
+		{
+			name: "Create Transaction",
+			request: func(token string) *httptest.ResponseRecorder {
+				return doRequest(router, token, "POST", "/inventories/"+inventoryID+"/transactions", map[string]interface{}{
+					"transaction_date": time.Now().Format(time.RFC3339),
+					"items": []map[string]interface{}{
+						{"product_variant_id": variantID, "quantity": 1.0},
+					},
+				})
+			},
+			allowed: map[string]int{"owner": http.StatusCreated, "admin": http.StatusCreated, "editor": http.StatusCreated},
+		},
+		{
+			name: "Adjust Stock",
+			request: func(token string) *httptest.ResponseRecorder {
+				return doRequest(router, token, "POST", "/inventories/"+inventoryID+"/stock/"+variantID+"/adjustments", map[string]interface{}{
+					"type":     "gift",
+					"quantity": 1.0,
+				})
+			},
+			allowed: map[string]int{"owner": http.StatusCreated, "admin": http.StatusCreated, "editor": http.StatusCreated},
+		},
+		{
+			name: "Invite Member",
+			request: func(token string) *httptest.ResponseRecorder {
+				invites++
+				return doRequest(router, token, "POST", "/inventories/"+inventoryID+"/invitations", map[string]string{
+					"email": fmt.Sprintf("invitee%d@example.com", invites),
+					"role":  "viewer",
+				})
+			},
+			allowed: map[string]int{"owner": http.StatusCreated, "admin": http.StatusCreated},
+		},
+	}
+
+	for _, tc := range cases {
+		for _, role := range []string{"owner", "admin", "editor", "viewer"} {
+			t.Run(tc.name+" As "+role, func(t *testing.T) {
+				rr := tc.request(tokens[role])
+				expected, ok := tc.allowed[role]
+				if !ok {
+					expected = http.StatusForbidden
+				}
+				assert.Equal(t, expected, rr.Code, rr.Body.String())
+			})
+		}
+		t.Run(tc.name+" As Non Member", func(t *testing.T) {
+			rr := tc.request(outsiderToken)
+			assert.Equal(t, http.StatusForbidden, rr.Code)
+		})
+	}
+
+	t.Run("Invalid Role Rejected", func(t *testing.T) {
+		rr := doRequest(router, ownerToken, "POST", "/inventories/"+inventoryID+"/invitations", map[string]string{
+			"email": "typo@example.com",
+			"role":  "superuser",
+		})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Owner Cannot Be Removed", func(t *testing.T) {
+		rr := doRequest(router, ownerToken, "GET", "/inventories/"+inventoryID, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var inventory map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &inventory)
+		ownerID := inventory["owner_user_id"].(string)
+
+		rr = doRequest(router, tokens["admin"], "DELETE", "/inventories/"+inventoryID+"/members/"+ownerID, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"ukoni/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategories(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createTransactionTestUser(router, "categories@example.com")
+	inventoryID := createTransactionTestInventory(router, token)
+
+	createCategory := func(name string, parentID *string) string {
+		rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/categories", map[string]interface{}{
+			"name":               name,
+			"parent_category_id": parentID,
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var category models.Category
+		json.Unmarshal(rr.Body.Bytes(), &category)
+		return category.ID
+	}
+
+	food := createCategory("Food", nil)
+	baking := createCategory("Baking", &food)
+	flour := createCategory("Flour", &baking)
+	cleaning := createCategory("Cleaning", nil)
+
+	t.Run("Duplicate Sibling Name", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/categories", map[string]interface{}{
+			"name":               "baking",
+			"parent_category_id": food,
+		})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Tree", func(t *testing.T) {
+		rr := doRequest(router, token, "GET", "/inventories/"+inventoryID+"/categories/tree", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var tree []*models.CategoryNode
+		json.Unmarshal(rr.Body.Bytes(), &tree)
+		require.Len(t, tree, 2)
+		assert.Equal(t, "Cleaning", tree[0].Name)
+		assert.Equal(t, "Food", tree[1].Name)
+		require.Len(t, tree[1].Children, 1)
+		assert.Equal(t, "Baking", tree[1].Children[0].Name)
+		require.Len(t, tree[1].Children[0].Children, 1)
+		assert.Equal(t, flour, tree[1].Children[0].Children[0].ID)
+	})
+
+	t.Run("Move Beneath Own Descendant Is Rejected", func(t *testing.T) {
+		rr := doRequest(router, token, "PUT", "/categories/"+food, map[string]interface{}{
+			"name":               "Food",
+			"parent_category_id": flour,
+		})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, token, "PUT", "/categories/"+food, map[string]interface{}{
+			"name":               "Food",
+			"parent_category_id": food,
+		})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Rename And Move", func(t *testing.T) {
+		rr := doRequest(router, token, "PUT", "/categories/"+flour, map[string]interface{}{
+			"name":               "Flours",
+			"parent_category_id": food,
+		})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var category models.Category
+		json.Unmarshal(rr.Body.Bytes(), &category)
+		assert.Equal(t, "Flours", category.Name)
+		assert.Equal(t, food, *category.ParentCategoryID)
+
+		// Move it back for the filter checks below
+		rr = doRequest(router, token, "PUT", "/categories/"+flour, map[string]interface{}{
+			"name":               "Flour",
+			"parent_category_id": baking,
+		})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("Filter Products By Category Includes Subcategories", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/products", map[string]string{"name": "Plain Flour", "category_id": flour})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		rr = doRequest(router, token, "POST", "/inventories/"+inventoryID+"/products", map[string]string{"name": "Bleach", "category_id": cleaning})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, token, "GET", "/inventories/"+inventoryID+"/products?category_id="+food, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var products []models.Product
+		json.Unmarshal(rr.Body.Bytes(), &products)
+		require.Len(t, products, 1)
+		assert.Equal(t, "Plain Flour", products[0].Name)
+	})
+
+	t.Run("Category From Another Inventory Is Rejected", func(t *testing.T) {
+		otherInventoryID := createTransactionTestInventory(router, token)
+		rr := doRequest(router, token, "POST", "/inventories/"+otherInventoryID+"/products", map[string]string{"name": "Sugar", "category_id": baking})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Delete Lifts Subcategories To Parent", func(t *testing.T) {
+		rr := doRequest(router, token, "DELETE", "/categories/"+baking, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, token, "GET", "/categories/"+flour, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var category models.Category
+		json.Unmarshal(rr.Body.Bytes(), &category)
+		assert.Equal(t, food, *category.ParentCategoryID)
+
+		rr = doRequest(router, token, "GET", "/categories/"+baking, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
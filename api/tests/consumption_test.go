@@ -2,6 +2,7 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,9 @@ import (
 	"time"
 
 	"ukoni/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createConsumptionTestUser(router *http.ServeMux) string {
@@ -117,3 +121,140 @@ func TestConsumptionEvents(t *testing.T) {
 		t.Errorf("expected 1 event, got %d", len(events))
 	}
 }
+
+func createConsumptionTestVariant(t *testing.T, router *http.ServeMux, token, inventoryID, canonicalProductID, name string, size float64) string {
+	pPayload := map[string]string{
+		"canonical_product_id": canonicalProductID,
+		"name":                 name,
+	}
+	pBody, _ := json.Marshal(pPayload)
+	req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/products", bytes.NewBuffer(pBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var pResp map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &pResp)
+	assert.Equal(t, canonicalProductID, pResp["canonical_product_id"])
+
+	vPayload := map[string]interface{}{
+		"variant_name": name,
+		"size":         size,
+		"unit":         "L",
+	}
+	vBody, _ := json.Marshal(vPayload)
+	req, _ = http.NewRequest("POST", "/products/"+pResp["id"].(string)+"/variants", bytes.NewBuffer(vBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var vResp map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &vResp)
+	return vResp["id"].(string)
+}
+
+func buyConsumptionTestVariant(t *testing.T, router *http.ServeMux, token, inventoryID, variantID string, quantity float64) {
+	payload := map[string]interface{}{
+		"transaction_date": time.Now().Format(time.RFC3339),
+		"items": []map[string]interface{}{
+			{"product_variant_id": variantID, "quantity": quantity},
+		},
+	}
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/transactions", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+}
+
+func TestConsumptionDrawdown(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	ctx := context.Background()
+	stock := &models.InventoryProductModel{DB: testDB}
+
+	token := createConsumptionTestUser(router)
+	inventoryID := createConsumptionTestInventory(router, token)
+	cpID := createConsumptionTestCanonicalProduct(router, token, inventoryID, "Milk")
+
+	// Older stock is bought first so it should be drawn down first
+	oldVariant := createConsumptionTestVariant(t, router, token, inventoryID, cpID, "Milk 1L", 1.0)
+	buyConsumptionTestVariant(t, router, token, inventoryID, oldVariant, 1)
+	newVariant := createConsumptionTestVariant(t, router, token, inventoryID, cpID, "Milk 2L", 2.0)
+	buyConsumptionTestVariant(t, router, token, inventoryID, newVariant, 1)
+
+	var eventID string
+
+	t.Run("Consumption draws down oldest stock first", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"canonical_product_id": cpID,
+			"quantity":             1.5,
+			"unit":                 "L",
+		}
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/consumption-events", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var event models.ConsumptionEvent
+		json.Unmarshal(rr.Body.Bytes(), &event)
+		eventID = event.ID
+		require.Len(t, event.Allocations, 2)
+		assert.Equal(t, oldVariant, event.Allocations[0].ProductVariantID)
+		assert.Equal(t, 1.0, event.Allocations[0].Quantity)
+		assert.Equal(t, newVariant, event.Allocations[1].ProductVariantID)
+		assert.Equal(t, 0.5, event.Allocations[1].Quantity)
+
+		ip, err := stock.Get(ctx, inventoryID, oldVariant)
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, ip.Quantity)
+		ip, err = stock.Get(ctx, inventoryID, newVariant)
+		require.NoError(t, err)
+		assert.Equal(t, 1.5, ip.Quantity)
+	})
+
+	t.Run("Deleting consumption restores stock", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/consumption-events/"+eventID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		ip, err := stock.Get(ctx, inventoryID, oldVariant)
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, ip.Quantity)
+		ip, err = stock.Get(ctx, inventoryID, newVariant)
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, ip.Quantity)
+
+		var reversed int
+		err = testDB.QueryRow(`SELECT count(*) FROM consumption_allocations WHERE consumption_event_id = $1 AND reversed_at IS NOT NULL`, eventID).Scan(&reversed)
+		require.NoError(t, err)
+		assert.Equal(t, 2, reversed)
+	})
+
+	t.Run("Deleting consumption of removed stock conflicts", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/consumption-events", map[string]interface{}{
+			"canonical_product_id": cpID,
+			"quantity":             0.5,
+			"unit":                 "L",
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var event models.ConsumptionEvent
+		json.Unmarshal(rr.Body.Bytes(), &event)
+
+		_, err := testDB.Exec(`UPDATE inventory_products SET deleted_at = NOW() WHERE inventory_id = $1`, inventoryID)
+		require.NoError(t, err)
+
+		rr = doRequest(router, token, "DELETE", "/consumption-events/"+event.ID, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "stock_removed")
+	})
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"ukoni/internal/server"
+	"ukoni/internal/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errorEnvelope struct {
+	Error struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	} `json:"error"`
+	Errors []map[string]string `json:"errors"`
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	clearDB()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := server.New(cfg, dbService, logger).Handler()
+
+	do := func(token, method, path string, body []byte, requestID string) (*httptest.ResponseRecorder, errorEnvelope) {
+		req := newJSONRequest(token, method, path, body)
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var envelope errorEnvelope
+		json.Unmarshal(rr.Body.Bytes(), &envelope)
+		return rr, envelope
+	}
+
+	token := createTransactionTestUser(setupRouter(), "envelope@example.com")
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		rr, envelope := do("", "GET", "/inventories", nil, "client-supplied-id")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "unauthorized", envelope.Error.Code)
+		assert.NotEmpty(t, envelope.Error.Message)
+		assert.Equal(t, "client-supplied-id", envelope.Error.RequestID)
+		assert.Equal(t, "client-supplied-id", rr.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("Generated Request ID", func(t *testing.T) {
+		rr, envelope := do("", "GET", "/inventories", nil, "not a valid id!")
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.NotEmpty(t, envelope.Error.RequestID)
+		assert.NotEqual(t, "not a valid id!", envelope.Error.RequestID)
+		assert.Equal(t, envelope.Error.RequestID, rr.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("Malformed Body", func(t *testing.T) {
+		rr, envelope := do(token, "POST", "/inventories", []byte("{"), "")
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "bad_request", envelope.Error.Code)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		rr, envelope := do(token, "GET", "/sellers/00000000-0000-0000-0000-000000000000", nil, "")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "not_found", envelope.Error.Code)
+		assert.NotContains(t, envelope.Error.Message, "sql")
+	})
+
+	t.Run("Wrapped Errors Keep Only Service Detail", func(t *testing.T) {
+		apiErr, ok := services.ToError(fmt.Errorf("failed to get variant v1: %w", sql.ErrNoRows))
+		require.True(t, ok)
+		assert.Equal(t, http.StatusNotFound, apiErr.Status)
+		assert.Equal(t, "resource not found", apiErr.Message)
+
+		apiErr, _ = services.ToError(fmt.Errorf("failed to debit stock: %w", fmt.Errorf("%w: variant v1", services.ErrStockConsumed)))
+		assert.Equal(t, services.ErrStockConsumed.Error(), apiErr.Message)
+
+		apiErr, _ = services.ToError(fmt.Errorf("%w: name is required", services.ErrInvalidInput))
+		assert.Equal(t, "invalid input: name is required", apiErr.Message)
+	})
+
+	t.Run("Internal Errors Are Hidden", func(t *testing.T) {
+		// Not a UUID, so Postgres rejects the query
+		rr, envelope := do(token, "GET", "/sellers/not-a-uuid", nil, "")
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, "internal", envelope.Error.Code)
+		assert.Equal(t, "internal server error", envelope.Error.Message)
+		assert.NotEmpty(t, envelope.Error.RequestID)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"name": "", "email": "fresh@example.com", "password": "password123"})
+		rr, envelope := do("", "POST", "/signup", body, "")
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "validation_failed", envelope.Error.Code)
+		require.Len(t, envelope.Errors, 1)
+		assert.Equal(t, "name", envelope.Errors[0]["field"])
+		assert.Equal(t, "required", envelope.Errors[0]["code"])
+	})
+}
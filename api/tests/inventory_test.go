@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createTestUser(router *http.ServeMux) string {
@@ -88,3 +89,200 @@ func TestInventoryCRUD(t *testing.T) {
 		assert.Equal(t, "My Kitchen", response["name"])
 	})
 }
+
+func TestInventoryAccess(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	list := func(t *testing.T, token string) []map[string]interface{} {
+		rr := doRequest(router, token, "GET", "/inventories", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var inventories []map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &inventories))
+		return inventories
+	}
+
+	ownerToken := createTransactionTestUser(router, "access-owner@example.com")
+	inventoryID := createTransactionTestInventory(router, ownerToken)
+	editorToken := addTestMember(t, router, ownerToken, inventoryID, "access-editor@example.com", "editor")
+	addTestMember(t, router, ownerToken, inventoryID, "access-viewer@example.com", "viewer")
+	outsiderToken := createTransactionTestUser(router, "access-outsider@example.com")
+
+	t.Run("Get Requires Membership", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, doRequest(router, editorToken, "GET", "/inventories/"+inventoryID, nil).Code)
+		assert.Equal(t, http.StatusForbidden, doRequest(router, outsiderToken, "GET", "/inventories/"+inventoryID, nil).Code)
+	})
+
+	t.Run("List Shows Each Inventory Once With Role", func(t *testing.T) {
+		inventories := list(t, ownerToken)
+		require.Len(t, inventories, 1)
+		assert.Equal(t, inventoryID, inventories[0]["id"])
+		assert.Equal(t, "owner", inventories[0]["role"])
+		assert.Equal(t, float64(3), inventories[0]["member_count"])
+		assert.NotNil(t, inventories[0]["last_activity_at"])
+
+		inventories = list(t, editorToken)
+		require.Len(t, inventories, 1)
+		assert.Equal(t, "editor", inventories[0]["role"])
+
+		assert.Empty(t, list(t, outsiderToken))
+	})
+
+	t.Run("Removed Members Lose Access", func(t *testing.T) {
+		var editorID string
+		testDB.QueryRow(`SELECT id FROM users WHERE email = 'access-editor@example.com'`).Scan(&editorID)
+
+		rr := doRequest(router, ownerToken, "DELETE", "/inventories/"+inventoryID+"/members/"+editorID, nil)
+		require.Less(t, rr.Code, 300, rr.Body.String())
+
+		assert.Empty(t, list(t, editorToken))
+		assert.Equal(t, http.StatusForbidden, doRequest(router, editorToken, "GET", "/inventories/"+inventoryID, nil).Code)
+		assert.Equal(t, float64(2), list(t, ownerToken)[0]["member_count"])
+	})
+}
+
+func TestInventoryLifecycle(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	userID := func(email string) string {
+		var id string
+		testDB.QueryRow(`SELECT id FROM users WHERE email = $1`, email).Scan(&id)
+		return id
+	}
+
+	ownerToken := createTransactionTestUser(router, "lifecycle-owner@example.com")
+	inventoryID := createTransactionTestInventory(router, ownerToken)
+	adminToken := addTestMember(t, router, ownerToken, inventoryID, "lifecycle-admin@example.com", "admin")
+	editorToken := addTestMember(t, router, ownerToken, inventoryID, "lifecycle-editor@example.com", "editor")
+	path := "/inventories/" + inventoryID
+
+	t.Run("Rename", func(t *testing.T) {
+		rr := doRequest(router, editorToken, "PATCH", path, map[string]string{"name": "Mine Now"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, adminToken, "PATCH", path, map[string]string{"name": "  "})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, adminToken, "PATCH", path, map[string]string{"name": "Holiday Home"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var inventory map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &inventory)
+		assert.Equal(t, "Holiday Home", inventory["name"])
+
+		var logged int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'inventory.updated' AND metadata->>'new_name' = 'Holiday Home'`).Scan(&logged)
+		assert.Equal(t, 1, logged)
+	})
+
+	t.Run("Archive Makes It Read Only", func(t *testing.T) {
+		rr := doRequest(router, editorToken, "POST", path+"/archive", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, adminToken, "POST", path+"/archive", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var inventory map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &inventory)
+		assert.NotNil(t, inventory["archived_at"])
+
+		rr = doRequest(router, editorToken, "GET", path+"/categories", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		for _, token := range []string{ownerToken, editorToken} {
+			rr = doRequest(router, token, "POST", path+"/categories", map[string]string{"name": "Frozen"})
+			assert.Equal(t, http.StatusConflict, rr.Code)
+		}
+		rr = doRequest(router, adminToken, "PATCH", path, map[string]string{"name": "Renamed While Archived"})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, adminToken, "POST", path+"/unarchive", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		rr = doRequest(router, editorToken, "POST", path+"/categories", map[string]string{"name": "Frozen"})
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	})
+
+	t.Run("Transfer Ownership", func(t *testing.T) {
+		adminID := userID("lifecycle-admin@example.com")
+		ownerID := userID("lifecycle-owner@example.com")
+
+		rr := doRequest(router, adminToken, "POST", path+"/transfer", map[string]string{"user_id": adminID})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, ownerToken, "POST", path+"/transfer", map[string]string{"user_id": userID("lifecycle-editor@example.com")})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, ownerToken, "POST", path+"/transfer", map[string]string{"user_id": adminID})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, editorToken, "GET", path+"/transfer", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var transfer map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &transfer)
+		assert.Equal(t, adminID, transfer["to_user_id"])
+
+		// Only the admin it was offered to can accept
+		rr = doRequest(router, editorToken, "POST", path+"/transfer/accept", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = doRequest(router, adminToken, "POST", path+"/transfer/accept", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		var owner string
+		testDB.QueryRow(`SELECT owner_user_id FROM inventories WHERE id = $1`, inventoryID).Scan(&owner)
+		assert.Equal(t, adminID, owner)
+
+		// The previous owner stays on as an admin, but can't give it away
+		rr = doRequest(router, ownerToken, "PATCH", path, map[string]string{"name": "Still An Admin"})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = doRequest(router, ownerToken, "POST", path+"/transfer", map[string]string{"user_id": ownerID})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		// Offers can be declined or withdrawn
+		rr = doRequest(router, adminToken, "POST", path+"/transfer", map[string]string{"user_id": ownerID})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		rr = doRequest(router, ownerToken, "POST", path+"/transfer/decline", nil)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		rr = doRequest(router, adminToken, "GET", path+"/transfer", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = doRequest(router, adminToken, "POST", path+"/transfer", map[string]string{"user_id": ownerID})
+		require.Equal(t, http.StatusCreated, rr.Code)
+		rr = doRequest(router, adminToken, "DELETE", path+"/transfer", nil)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		rr = doRequest(router, ownerToken, "POST", path+"/transfer/accept", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		var logged int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'inventory.ownership_transferred' AND inventory_id = $1`, inventoryID).Scan(&logged)
+		assert.Equal(t, 1, logged)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		// adminToken now belongs to the owner
+		newOwnerToken, formerOwnerToken := adminToken, ownerToken
+		variantID := createTestVariant(t, router, newOwnerToken, inventoryID)
+		buyConsumptionTestVariant(t, router, newOwnerToken, inventoryID, variantID, 2)
+		rr := doRequest(router, newOwnerToken, "POST", path+"/shopping-lists", map[string]string{"name": "Weekly"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, formerOwnerToken, "DELETE", path, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, newOwnerToken, "DELETE", path, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, newOwnerToken, "GET", path, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, editorToken, "GET", "/inventories", nil)
+		var inventories []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &inventories)
+		assert.Empty(t, inventories)
+
+		for _, table := range []string{"products", "shopping_lists", "inventory_products", "product_categories"} {
+			var live int
+			testDB.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE inventory_id = $1 AND deleted_at IS NULL`, inventoryID).Scan(&live)
+			assert.Equal(t, 0, live, table)
+		}
+	})
+}
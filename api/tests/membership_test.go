@@ -2,12 +2,16 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"ukoni/internal/models"
+	"ukoni/internal/services"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createSecondUser(router *http.ServeMux) (string, string) {
@@ -27,6 +31,15 @@ func createSecondUser(router *http.ServeMux) (string, string) {
 	return response["token"].(string), response["user"].(map[string]interface{})["id"].(string)
 }
 
+// invitationToken reads an invitation's token from the database, standing in
+// for the link the invitee would be sent.
+func invitationToken(t *testing.T, invitationID string) string {
+	var token string
+	err := testDB.QueryRow(`SELECT token FROM invitations WHERE id = $1`, invitationID).Scan(&token)
+	require.NoError(t, err)
+	return token
+}
+
 func TestMembership(t *testing.T) {
 	clearDB()
 	router := setupRouter()
@@ -71,10 +84,10 @@ func TestMembership(t *testing.T) {
 		json.Unmarshal(rr.Body.Bytes(), &response)
 
 		inviteID = response["id"].(string)
-		inviteToken = response["token"].(string)
 		assert.Equal(t, "second@example.com", response["email"])
 		assert.Equal(t, "pending", response["status"])
-		assert.NotEmpty(t, inviteToken)
+		assert.NotContains(t, response, "token")
+		inviteToken = invitationToken(t, inviteID)
 	})
 
 	t.Run("Accept Invitation", func(t *testing.T) {
@@ -133,3 +146,351 @@ func TestMembership(t *testing.T) {
 		assert.Len(t, members, 1) // Only owner left
 	})
 }
+
+func TestInvitationManagement(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	ownerToken := createTransactionTestUser(router, "owner@example.com")
+	inventoryID := createTransactionTestInventory(router, ownerToken)
+	viewerToken := addTestMember(t, router, ownerToken, inventoryID, "viewer@example.com", "viewer")
+	inviteeToken := createTransactionTestUser(router, "invitee@example.com")
+
+	invite := func(email string) map[string]interface{} {
+		rr := doRequest(router, ownerToken, "POST", "/inventories/"+inventoryID+"/invitations", map[string]string{"email": email, "role": "editor"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var invitation map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &invitation)
+		return invitation
+	}
+
+	t.Run("List Invitations", func(t *testing.T) {
+		invite("list@example.com")
+
+		rr := doRequest(router, ownerToken, "GET", "/inventories/"+inventoryID+"/invitations?status=pending", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var invitations []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &invitations)
+		require.NotEmpty(t, invitations)
+		for _, invitation := range invitations {
+			assert.Equal(t, "pending", invitation["status"])
+		}
+
+		rr = doRequest(router, ownerToken, "GET", "/inventories/"+inventoryID+"/invitations?status=bogus", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, viewerToken, "GET", "/inventories/"+inventoryID+"/invitations", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Revoke Invitation", func(t *testing.T) {
+		invitation := invite("invitee@example.com")
+		id := invitation["id"].(string)
+
+		rr := doRequest(router, viewerToken, "DELETE", "/invitations/"+id, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, ownerToken, "DELETE", "/invitations/"+id, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, ownerToken, "DELETE", "/invitations/"+id, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, inviteeToken, "POST", "/invitations/"+id+"/accept", map[string]string{"token": invitationToken(t, id)})
+		assert.NotEqual(t, http.StatusOK, rr.Code)
+
+		rr = doRequest(router, ownerToken, "POST", "/invitations/"+id+"/resend", nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		var count int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'invitation.revoked' AND entity_id = $1`, id).Scan(&count)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Resend Invitation", func(t *testing.T) {
+		invitation := invite("invitee@example.com")
+		id := invitation["id"].(string)
+		oldToken := invitationToken(t, id)
+
+		rr := doRequest(router, ownerToken, "POST", "/invitations/"+id+"/resend", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resent map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resent)
+		assert.NotContains(t, resent, "token")
+		newToken := invitationToken(t, id)
+		assert.NotEqual(t, oldToken, newToken)
+		assert.Equal(t, "pending", resent["status"])
+
+		rr = doRequest(router, inviteeToken, "POST", "/invitations/"+id+"/accept", map[string]string{"token": oldToken})
+		assert.NotEqual(t, http.StatusOK, rr.Code)
+
+		rr = doRequest(router, inviteeToken, "GET", "/me/invitations", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var mine []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &mine)
+		require.Len(t, mine, 1)
+		assert.Equal(t, id, mine[0]["id"])
+		assert.NotEmpty(t, mine[0]["inventory_name"])
+
+		rr = doRequest(router, inviteeToken, "POST", "/invitations/"+id+"/accept", map[string]string{"token": newToken})
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, inviteeToken, "GET", "/me/invitations", nil)
+		json.Unmarshal(rr.Body.Bytes(), &mine)
+		assert.Empty(t, mine)
+	})
+
+	t.Run("My Invitations Match Email Case-Insensitively", func(t *testing.T) {
+		invitation := invite("Mixed.Case@Example.com")
+		mixedToken := createTransactionTestUser(router, "mixed.case@example.com")
+
+		rr := doRequest(router, mixedToken, "GET", "/me/invitations", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var mine []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &mine)
+		require.Len(t, mine, 1)
+		assert.Equal(t, invitation["id"], mine[0]["id"])
+	})
+
+	t.Run("Expiry Sweep", func(t *testing.T) {
+		invitation := invite("expiring@example.com")
+		id := invitation["id"].(string)
+		_, err := testDB.Exec(`UPDATE invitations SET expires_at = NOW() - INTERVAL '1 hour' WHERE id = $1`, id)
+		require.NoError(t, err)
+
+		service := &services.MembershipService{
+			MembershipModel:    &models.MembershipModel{DB: testDB},
+			ActivityLogService: &services.ActivityLogService{Model: &models.ActivityLogModel{DB: testDB}},
+		}
+		count, err := service.ExpireInvitations(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		var status string
+		testDB.QueryRow(`SELECT status FROM invitations WHERE id = $1`, id).Scan(&status)
+		assert.Equal(t, "expired", status)
+
+		var logged int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'invitation.expired' AND entity_id = $1`, id).Scan(&logged)
+		assert.Equal(t, 1, logged)
+
+		// An expired invitation can be resent and becomes pending again.
+		rr := doRequest(router, ownerToken, "POST", "/invitations/"+id+"/resend", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resent map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resent)
+		assert.Equal(t, "pending", resent["status"])
+	})
+}
+
+func TestInvitationAcceptance(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	ownerToken := createTransactionTestUser(router, "owner@example.com")
+	inventoryID := createTransactionTestInventory(router, ownerToken)
+
+	invite := func(email string) string {
+		rr := doRequest(router, ownerToken, "POST", "/inventories/"+inventoryID+"/invitations", map[string]string{"email": email, "role": "editor"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var invitation map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &invitation)
+		return invitation["id"].(string)
+	}
+
+	t.Run("Rejects A Different Email", func(t *testing.T) {
+		id := invite("intended@example.com")
+		otherToken := createTransactionTestUser(router, "someone-else@example.com")
+
+		rr := doRequest(router, otherToken, "POST", "/invitations/"+id+"/accept", map[string]string{"token": invitationToken(t, id)})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, otherToken, "POST", "/invitations/accept", map[string]string{"token": invitationToken(t, id)})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Rejects A Wrong Token", func(t *testing.T) {
+		id := invite("wrong-token@example.com")
+		userToken := createTransactionTestUser(router, "wrong-token@example.com")
+
+		rr := doRequest(router, userToken, "POST", "/invitations/"+id+"/accept", map[string]string{"token": "not-the-token"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, userToken, "POST", "/invitations/accept", map[string]string{"token": "not-the-token"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Accepts By Token With Case-Insensitive Email", func(t *testing.T) {
+		id := invite("Link.User@Example.com")
+		userToken := createTransactionTestUser(router, "link.user@example.com")
+
+		rr := doRequest(router, userToken, "POST", "/invitations/accept", map[string]string{"token": invitationToken(t, id)})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var accepted map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &accepted)
+		assert.Equal(t, "accepted", accepted["status"])
+		assert.Equal(t, inventoryID, accepted["inventory_id"])
+		assert.Equal(t, "editor", accepted["role"])
+
+		rr = doRequest(router, userToken, "GET", "/inventories/"+inventoryID, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doRequest(router, userToken, "POST", "/invitations/accept", map[string]string{"token": invitationToken(t, id)})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Rejects Duplicate Memberships", func(t *testing.T) {
+		rr := doRequest(router, ownerToken, "POST", "/inventories/"+inventoryID+"/invitations", map[string]string{"email": "LINK.USER@example.com", "role": "viewer"})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		first := invite("twice@example.com")
+		second := invite("twice@example.com")
+		userToken := createTransactionTestUser(router, "twice@example.com")
+
+		rr = doRequest(router, userToken, "POST", "/invitations/"+first+"/accept", map[string]string{"token": invitationToken(t, first)})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, userToken, "POST", "/invitations/"+second+"/accept", map[string]string{"token": invitationToken(t, second)})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		var count int
+		testDB.QueryRow(`SELECT COUNT(*) FROM inventory_memberships m JOIN users u ON u.id = m.user_id
+			WHERE m.inventory_id = $1 AND u.email = 'twice@example.com' AND m.deleted_at IS NULL`, inventoryID).Scan(&count)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Rejects An Expired Invitation", func(t *testing.T) {
+		id := invite("late@example.com")
+		userToken := createTransactionTestUser(router, "late@example.com")
+		_, err := testDB.Exec(`UPDATE invitations SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, id)
+		require.NoError(t, err)
+
+		rr := doRequest(router, userToken, "POST", "/invitations/accept", map[string]string{"token": invitationToken(t, id)})
+		assert.Equal(t, http.StatusGone, rr.Code)
+	})
+
+	t.Run("Signup With Invitation", func(t *testing.T) {
+		id := invite("newcomer@example.com")
+
+		rr := doRequest(router, "", "POST", "/signup", map[string]string{
+			"name":             "Newcomer",
+			"email":            "Newcomer@example.com",
+			"password":         "password123",
+			"invitation_token": invitationToken(t, id),
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		userToken := response["token"].(string)
+		invitation := response["invitation"].(map[string]interface{})
+		assert.Equal(t, "accepted", invitation["status"])
+		assert.Equal(t, inventoryID, invitation["inventory_id"])
+
+		rr = doRequest(router, userToken, "GET", "/inventories/"+inventoryID, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Signup With Invitation For Another Email Creates Nothing", func(t *testing.T) {
+		id := invite("reserved@example.com")
+
+		rr := doRequest(router, "", "POST", "/signup", map[string]string{
+			"name":             "Interloper",
+			"email":            "interloper@example.com",
+			"password":         "password123",
+			"invitation_token": invitationToken(t, id),
+		})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		var count int
+		testDB.QueryRow(`SELECT COUNT(*) FROM users WHERE email = 'interloper@example.com'`).Scan(&count)
+		assert.Equal(t, 0, count)
+
+		var status string
+		testDB.QueryRow(`SELECT status FROM invitations WHERE id = $1`, id).Scan(&status)
+		assert.Equal(t, "pending", status)
+	})
+}
+
+func TestMemberRolesAndLeaving(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	userID := func(email string) string {
+		var id string
+		testDB.QueryRow(`SELECT id FROM users WHERE email = $1`, email).Scan(&id)
+		return id
+	}
+
+	ownerToken := createTransactionTestUser(router, "roles-owner@example.com")
+	inventoryID := createTransactionTestInventory(router, ownerToken)
+	adminToken := addTestMember(t, router, ownerToken, inventoryID, "roles-admin@example.com", "admin")
+	viewerToken := addTestMember(t, router, ownerToken, inventoryID, "roles-viewer@example.com", "viewer")
+	adminID := userID("roles-admin@example.com")
+	viewerID := userID("roles-viewer@example.com")
+	membersPath := "/inventories/" + inventoryID + "/members/"
+
+	t.Run("Admin Promotes A Viewer", func(t *testing.T) {
+		rr := doRequest(router, adminToken, "PATCH", membersPath+viewerID, map[string]string{"role": "editor"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var member map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &member)
+		assert.Equal(t, "editor", member["role"])
+
+		var metadata string
+		testDB.QueryRow(`SELECT metadata FROM activity_logs WHERE action = 'inventory_membership.role_changed' AND entity_id = $1`, viewerID).Scan(&metadata)
+		assert.JSONEq(t, `{"old_role":"viewer","new_role":"editor"}`, metadata)
+	})
+
+	t.Run("Guards", func(t *testing.T) {
+		// Only admins change roles
+		rr := doRequest(router, viewerToken, "PATCH", membersPath+adminID, map[string]string{"role": "viewer"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = doRequest(router, adminToken, "PATCH", membersPath+viewerID, map[string]string{"role": "superuser"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, adminToken, "PATCH", membersPath+userID("roles-owner@example.com"), map[string]string{"role": "viewer"})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		// The owner's own admin membership doesn't count towards keeping one
+		rr = doRequest(router, ownerToken, "PATCH", membersPath+adminID, map[string]string{"role": "editor"})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "last_admin")
+
+		rr = doRequest(router, ownerToken, "PATCH", membersPath+"00000000-0000-0000-0000-000000000000", map[string]string{"role": "editor"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Demotes An Admin Once Another Exists", func(t *testing.T) {
+		rr := doRequest(router, ownerToken, "PATCH", membersPath+viewerID, map[string]string{"role": "admin"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, ownerToken, "PATCH", membersPath+adminID, map[string]string{"role": "viewer"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, adminToken, "GET", "/inventories/"+inventoryID+"/invitations", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Members Leave", func(t *testing.T) {
+		rr := doRequest(router, adminToken, "POST", "/inventories/"+inventoryID+"/leave", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, adminToken, "GET", "/inventories/"+inventoryID, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = doRequest(router, adminToken, "POST", "/inventories/"+inventoryID+"/leave", nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		var role string
+		testDB.QueryRow(`SELECT metadata->>'role' FROM activity_logs WHERE action = 'inventory_membership.left' AND user_id = $1`, adminID).Scan(&role)
+		assert.Equal(t, "viewer", role)
+
+		rr = doRequest(router, ownerToken, "POST", "/inventories/"+inventoryID+"/leave", nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		// The viewer was promoted above and is now the only admin
+		rr = doRequest(router, viewerToken, "POST", "/inventories/"+inventoryID+"/leave", nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "last_admin")
+	})
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+	"ukoni/internal/models"
+	"ukoni/internal/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var emailTokenPattern = regexp.MustCompile(`[?&]token=([^\s&]+)`)
+
+// lastEmailToken returns the token in the link of the newest email of a
+// template sent to recipient, as the user would find it in their inbox.
+func lastEmailToken(t *testing.T, recipient, template string) string {
+	var body string
+	err := testDB.QueryRow(`SELECT body FROM email_outbox WHERE recipient = $1 AND template = $2 ORDER BY created_at DESC LIMIT 1`,
+		recipient, template).Scan(&body)
+	require.NoError(t, err)
+
+	match := emailTokenPattern.FindStringSubmatch(body)
+	require.NotNil(t, match, body)
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg notify.Message) error {
+	return errors.New("smtp unavailable")
+}
+
+func TestEmailOutbox(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	ctx := context.Background()
+
+	ownerToken := createTransactionTestUser(router, "owner@example.com")
+	inventoryID := createTransactionTestInventory(router, ownerToken)
+
+	t.Run("Invitation Queues An Email", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"email": "invitee@example.com", "role": "editor"})
+		req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/invitations", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+ownerToken)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var invitation map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &invitation)
+		token := invitationToken(t, invitation["id"].(string))
+
+		var template, subject, emailBody, status string
+		err := testDB.QueryRow(`SELECT template, subject, body, status FROM email_outbox WHERE recipient = 'invitee@example.com'`).
+			Scan(&template, &subject, &emailBody, &status)
+		require.NoError(t, err)
+		assert.Equal(t, "invitation", template)
+		assert.Equal(t, "pending", status)
+		assert.Contains(t, subject, "Transaction Inventory")
+		assert.Contains(t, emailBody, (notify.Links{BaseURL: cfg.AppBaseURL}).AcceptInvitation(token))
+	})
+
+	t.Run("Flush Sends Due Emails", func(t *testing.T) {
+		var out bytes.Buffer
+		outbox := &notify.Outbox{
+			Model:  &models.EmailOutboxModel{DB: testDB},
+			Mailer: &notify.WriterMailer{W: &out, From: "test@example.com"},
+		}
+
+		sent, err := outbox.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Contains(t, out.String(), "To: invitee@example.com")
+
+		var status string
+		testDB.QueryRow(`SELECT status FROM email_outbox WHERE recipient = 'invitee@example.com'`).Scan(&status)
+		assert.Equal(t, "sent", status)
+
+		sent, err = outbox.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+	})
+
+	t.Run("Headers Stay On One Line", func(t *testing.T) {
+		var out bytes.Buffer
+		mailer := &notify.WriterMailer{W: &out, From: "test@example.com"}
+		err := mailer.Send(ctx, notify.Message{
+			To:      "victim@example.com",
+			Subject: "Join Pantry\r\nBcc: everyone@example.com",
+			Body:    "Hello",
+		})
+		require.NoError(t, err)
+		assert.NotContains(t, out.String(), "\r\nBcc:")
+		assert.Contains(t, out.String(), "Subject: Join Pantry Bcc: everyone@example.com\r\n")
+
+		rr := doRequest(router, ownerToken, "POST", "/inventories", map[string]string{"name": "Pantry\r\nBcc: everyone@example.com"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = doRequest(router, ownerToken, "PATCH", "/inventories/"+inventoryID, map[string]string{"name": "Pantry\nBcc: everyone@example.com"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Nothing Is Sent When The Transaction Rolls Back", func(t *testing.T) {
+		outbox := &notify.Outbox{Model: &models.EmailOutboxModel{DB: testDB}}
+
+		tx, err := testDB.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		err = outbox.Enqueue(ctx, tx, "rolled-back@example.com", notify.PasswordResetEmail{
+			Name: "Someone", ResetURL: "http://example.com/reset", ExpiresAt: time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback())
+
+		var count int
+		testDB.QueryRow(`SELECT COUNT(*) FROM email_outbox WHERE recipient = 'rolled-back@example.com'`).Scan(&count)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("Failed Sends Are Retried Then Given Up", func(t *testing.T) {
+		outbox := &notify.Outbox{
+			Model:       &models.EmailOutboxModel{DB: testDB},
+			Mailer:      failingMailer{},
+			MaxAttempts: 2,
+		}
+		err := outbox.Enqueue(ctx, testDB, "digest@example.com", notify.LowStockDigestEmail{
+			Name:          "Someone",
+			InventoryName: "Pantry",
+			Items:         []notify.LowStockItem{{Name: "Milk", Quantity: 0.5, Unit: "L"}},
+		})
+		require.NoError(t, err)
+
+		sent, err := outbox.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+
+		var status string
+		var attempts int
+		var lastError *string
+		var nextAttempt time.Time
+		testDB.QueryRow(`SELECT status, attempts, last_error, next_attempt_at FROM email_outbox WHERE recipient = 'digest@example.com'`).
+			Scan(&status, &attempts, &lastError, &nextAttempt)
+		assert.Equal(t, "pending", status)
+		assert.Equal(t, 1, attempts)
+		require.NotNil(t, lastError)
+		assert.Equal(t, "smtp unavailable", *lastError)
+		assert.True(t, nextAttempt.After(time.Now()))
+
+		// Not due yet, so a second flush leaves it alone.
+		outbox.Flush(ctx)
+		testDB.QueryRow(`SELECT attempts FROM email_outbox WHERE recipient = 'digest@example.com'`).Scan(&attempts)
+		assert.Equal(t, 1, attempts)
+
+		_, err = testDB.Exec(`UPDATE email_outbox SET next_attempt_at = NOW() WHERE recipient = 'digest@example.com'`)
+		require.NoError(t, err)
+		outbox.Flush(ctx)
+		testDB.QueryRow(`SELECT status, attempts FROM email_outbox WHERE recipient = 'digest@example.com'`).Scan(&status, &attempts)
+		assert.Equal(t, "failed", status)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("Templates Render", func(t *testing.T) {
+		expires := time.Now().Add(24 * time.Hour)
+		for _, email := range []notify.Email{
+			notify.InvitationEmail{InventoryName: "Pantry", InviterName: "Ada", Role: "admin", AcceptURL: "http://example.com/a", ExpiresAt: &expires},
+			notify.PasswordResetEmail{Name: "Ada", ResetURL: "http://example.com/r", ExpiresAt: expires},
+			notify.LowStockDigestEmail{Name: "Ada", InventoryName: "Pantry", Items: []notify.LowStockItem{{Name: "Rice", Quantity: 2}}},
+		} {
+			subject, body, err := notify.Render(email)
+			require.NoError(t, err, email.TemplateName())
+			assert.NotEmpty(t, subject)
+			assert.NotEmpty(t, body)
+		}
+	})
+}
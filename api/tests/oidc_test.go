@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ukoni/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	clearDB()
+	idp := newFakeIdP(t)
+
+	c := *cfg
+	c.OIDCProviders = []config.OIDCProvider{idp.Provider("fake")}
+	router := setupRouterWithConfig(&c)
+
+	post := func(path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	start := func(t *testing.T) string {
+		rr := post("/auth/oidc/fake/start", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp["authorization_url"]
+	}
+
+	login := func(t *testing.T, user fakeIdPUser) *httptest.ResponseRecorder {
+		code, state := idp.Authorize(t, start(t), user)
+		return post("/auth/oidc/fake/callback", map[string]string{"code": code, "state": state})
+	}
+
+	userID := func(rr *httptest.ResponseRecorder) string {
+		var resp struct {
+			User  map[string]interface{} `json:"user"`
+			Token string                 `json:"token"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.User == nil || resp.Token == "" {
+			return ""
+		}
+		return resp.User["id"].(string)
+	}
+
+	t.Run("List Providers", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/auth/oidc/providers", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"providers":["fake"]}`, rr.Body.String())
+	})
+
+	t.Run("Authorization URL", func(t *testing.T) {
+		authURL, err := url.Parse(start(t))
+		require.NoError(t, err)
+		q := authURL.Query()
+		assert.Equal(t, idp.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+		assert.Equal(t, "ukoni-test", q.Get("client_id"))
+		assert.Equal(t, "S256", q.Get("code_challenge_method"))
+		assert.NotEmpty(t, q.Get("code_challenge"))
+		assert.NotEmpty(t, q.Get("state"))
+		assert.NotEmpty(t, q.Get("nonce"))
+		assert.Contains(t, q.Get("scope"), "openid")
+	})
+
+	t.Run("Creates An Account", func(t *testing.T) {
+		user := fakeIdPUser{Subject: "new-1", Email: "New.User@Example.com", EmailVerified: true, Name: "New User"}
+		rr := login(t, user)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		id := userID(rr)
+		require.NotEmpty(t, id)
+
+		var email string
+		var verified bool
+		testDB.QueryRow(`SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1`, id).Scan(&email, &verified)
+		assert.Equal(t, "new.user@example.com", email)
+		assert.True(t, verified)
+
+		// Logging in again finds the same account
+		rr = login(t, user)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, id, userID(rr))
+
+		// Even after the email changed at the provider
+		user.Email = "renamed@example.com"
+		rr = login(t, user)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, id, userID(rr))
+	})
+
+	t.Run("Links An Existing Account", func(t *testing.T) {
+		createTransactionTestUser(router, "existing@example.com")
+		verifyTestUser(t, router, "existing@example.com")
+		var id string
+		testDB.QueryRow(`SELECT id FROM users WHERE email = 'existing@example.com'`).Scan(&id)
+
+		rr := login(t, fakeIdPUser{Subject: "existing-1", Email: "existing@example.com", EmailVerified: true})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, id, userID(rr))
+
+		var linked int
+		testDB.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id = $1 AND provider = 'fake'`, id).Scan(&linked)
+		assert.Equal(t, 1, linked)
+
+		var logged int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'user.identity_linked' AND user_id = $1`, id).Scan(&logged)
+		assert.Equal(t, 1, logged)
+	})
+
+	t.Run("Does Not Link Unverified Accounts", func(t *testing.T) {
+		createTransactionTestUser(router, "unverified@example.com")
+
+		rr := login(t, fakeIdPUser{Subject: "unverified-1", Email: "unverified@example.com", EmailVerified: true})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = login(t, fakeIdPUser{Subject: "unverified-2", Email: "someone@example.com", EmailVerified: false})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("State Works Once", func(t *testing.T) {
+		code, state := idp.Authorize(t, start(t), fakeIdPUser{Subject: "once-1", Email: "once@example.com", EmailVerified: true})
+		rr := post("/auth/oidc/fake/callback", map[string]string{"code": code, "state": state})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		rr = post("/auth/oidc/fake/callback", map[string]string{"code": code, "state": state})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		code, _ = idp.Authorize(t, start(t), fakeIdPUser{Subject: "once-1", Email: "once@example.com", EmailVerified: true})
+		rr = post("/auth/oidc/fake/callback", map[string]string{"code": code, "state": "made-up"})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = post("/auth/oidc/fake/callback", map[string]string{})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Rejects Bad ID Tokens", func(t *testing.T) {
+		user := fakeIdPUser{Subject: "bad-1", Email: "bad@example.com", EmailVerified: true}
+
+		idp.ExtraClaims = jwt.MapClaims{"nonce": "replayed"}
+		rr := login(t, user)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		idp.ExtraClaims = jwt.MapClaims{"aud": "another-client"}
+		rr = login(t, user)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		idp.ExtraClaims = nil
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		idp.SignWith = otherKey
+		rr = login(t, user)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		idp.SignWith = nil
+
+		var accounts int
+		testDB.QueryRow(`SELECT COUNT(*) FROM users WHERE email = 'bad@example.com'`).Scan(&accounts)
+		assert.Equal(t, 0, accounts)
+	})
+
+	t.Run("Deletes An Account Without A Password", func(t *testing.T) {
+		rr := login(t, fakeIdPUser{Subject: "leaver-1", Email: "leaver@example.com", EmailVerified: true, Name: "Leaver"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		id := userID(rr)
+		var resp struct {
+			Token string `json:"token"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+
+		// A session that signed in a while ago has to sign in again
+		testDB.Exec(`UPDATE sessions SET authenticated_at = NOW() - INTERVAL '1 hour' WHERE user_id = $1`, id)
+		rr = doRequest(router, resp.Token, "DELETE", "/me", map[string]string{})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "reauthentication_required")
+
+		rr = login(t, fakeIdPUser{Subject: "leaver-1", Email: "leaver@example.com", EmailVerified: true, Name: "Leaver"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		rr = doRequest(router, resp.Token, "DELETE", "/me", map[string]string{})
+		assert.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		var deleted bool
+		testDB.QueryRow(`SELECT deleted_at IS NOT NULL FROM users WHERE id = $1`, id).Scan(&deleted)
+		assert.True(t, deleted)
+	})
+
+	t.Run("Unknown Provider", func(t *testing.T) {
+		rr := post("/auth/oidc/nope/start", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
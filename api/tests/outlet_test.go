@@ -132,6 +132,6 @@ func TestOutletCRUD(t *testing.T) {
 		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 }
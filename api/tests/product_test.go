@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createProductTestInventory(router *http.ServeMux, token string) string {
@@ -116,6 +117,31 @@ func TestProductCRUD(t *testing.T) {
 		assert.Equal(t, "UpdatedProduct", response["name"])
 	})
 
+	t.Run("Update Keeps Canonical Product Unless Given", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/canonical-products", map[string]string{"name": "Generic Product"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var canonical map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &canonical)
+		canonicalID := canonical["id"].(string)
+
+		update := func(payload map[string]string) map[string]interface{} {
+			rr := doRequest(router, token, "PUT", "/products/"+productID, payload)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			var response map[string]interface{}
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			return response
+		}
+
+		product := update(map[string]string{"name": "UpdatedProduct", "canonical_product_id": canonicalID})
+		assert.Equal(t, canonicalID, product["canonical_product_id"])
+
+		product = update(map[string]string{"name": "UpdatedProduct"})
+		assert.Equal(t, canonicalID, product["canonical_product_id"])
+
+		product = update(map[string]string{"name": "UpdatedProduct", "canonical_product_id": ""})
+		assert.Nil(t, product["canonical_product_id"])
+	})
+
 	t.Run("Create Variant", func(t *testing.T) {
 		payload := map[string]string{
 			"variant_name": "Variant1",
@@ -177,3 +203,159 @@ func TestProductCRUD(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 }
+
+func TestProductVariants(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createTransactionTestUser(router, "variants@example.com")
+	inventoryID := createTransactionTestInventory(router, token)
+	// Has SKU 123456
+	stockedID := createTestVariant(t, router, token, inventoryID)
+
+	decode := func(rr *httptest.ResponseRecorder) map[string]interface{} {
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/products", map[string]string{"name": "Cereal"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	productID := decode(rr)["id"].(string)
+
+	var variantID string
+
+	t.Run("Codes Are Unique Per Inventory", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/products/"+productID+"/variants", map[string]interface{}{
+			"variant_name": "500g", "sku": "CER-500", "gtin": "5000112637922",
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		variantID = decode(rr)["id"].(string)
+
+		rr = doRequest(router, token, "POST", "/products/"+productID+"/variants", map[string]interface{}{
+			"variant_name": "Other", "sku": "cer-500",
+		})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		// The same barcode with a leading zero
+		rr = doRequest(router, token, "POST", "/products/"+productID+"/variants", map[string]interface{}{
+			"variant_name": "Other", "gtin": "05000112637922",
+		})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, token, "POST", "/products/"+productID+"/variants", map[string]interface{}{
+			"variant_name": "Other", "gtin": "5000112637923",
+		})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		// Another inventory may reuse them
+		otherInventoryID := createTransactionTestInventory(router, token)
+		rr = doRequest(router, token, "POST", "/inventories/"+otherInventoryID+"/products", map[string]string{"name": "Cereal"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		rr = doRequest(router, token, "POST", "/products/"+decode(rr)["id"].(string)+"/variants", map[string]interface{}{
+			"variant_name": "500g", "sku": "CER-500", "gtin": "5000112637922",
+		})
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	})
+
+	t.Run("Get And Update", func(t *testing.T) {
+		rr := doRequest(router, token, "GET", "/variants/"+variantID, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "CER-500", decode(rr)["sku"])
+
+		rr = doRequest(router, token, "PUT", "/variants/"+variantID, map[string]interface{}{
+			"variant_name": "750g", "sku": "CER-750", "gtin": "5000112637922", "size": 750, "unit": "g",
+		})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		variant := decode(rr)
+		assert.Equal(t, "750g", variant["variant_name"])
+		assert.Equal(t, "CER-750", variant["sku"])
+
+		// Can't take another variant's SKU
+		rr = doRequest(router, token, "PUT", "/variants/"+variantID, map[string]interface{}{
+			"variant_name": "750g", "sku": "123456",
+		})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		var metadata string
+		testDB.QueryRow(`SELECT metadata FROM activity_logs WHERE action = 'product_variant.updated' AND entity_id = $1`, variantID).Scan(&metadata)
+		assert.Contains(t, metadata, `"old_sku":"CER-500"`)
+		assert.Contains(t, metadata, `"new_sku":"CER-750"`)
+	})
+
+	t.Run("Lookup", func(t *testing.T) {
+		lookup := func(code string) []map[string]interface{} {
+			rr := doRequest(router, token, "GET", "/inventories/"+inventoryID+"/variants/lookup?code="+code, nil)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			var variants []map[string]interface{}
+			json.Unmarshal(rr.Body.Bytes(), &variants)
+			return variants
+		}
+
+		variants := lookup("cer-750")
+		require.Len(t, variants, 1)
+		assert.Equal(t, variantID, variants[0]["id"])
+		assert.Equal(t, "Cereal", variants[0]["product"].(map[string]interface{})["name"])
+
+		variants = lookup("05000112637922")
+		require.Len(t, variants, 1)
+		assert.Equal(t, variantID, variants[0]["id"])
+
+		assert.Empty(t, lookup("nothing"))
+
+		rr := doRequest(router, token, "GET", "/inventories/"+inventoryID+"/variants/lookup", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Delete Refuses Variants In Use", func(t *testing.T) {
+		buyConsumptionTestVariant(t, router, token, inventoryID, stockedID, 1)
+		rr := doRequest(router, token, "DELETE", "/variants/"+stockedID, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, token, "POST", "/inventories/"+inventoryID+"/shopping-lists", map[string]string{"name": "Weekly"})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		listID := decode(rr)["id"].(string)
+		rr = doRequest(router, token, "POST", "/shopping-lists/"+listID+"/items", map[string]interface{}{
+			"target_type": "product_variant", "target_id": variantID,
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		itemID := decode(rr)["id"].(string)
+
+		rr = doRequest(router, token, "DELETE", "/variants/"+variantID, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, token, "DELETE", "/shopping-list-items/"+itemID, nil)
+		require.Less(t, rr.Code, 300, rr.Body.String())
+
+		rr = doRequest(router, token, "DELETE", "/variants/"+variantID, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		rr = doRequest(router, token, "GET", "/variants/"+variantID, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		// Its codes are free again
+		rr = doRequest(router, token, "POST", "/products/"+productID+"/variants", map[string]interface{}{
+			"variant_name": "750g", "sku": "CER-750", "gtin": "5000112637922",
+		})
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	})
+
+	t.Run("Size Stays Fixed Once Bought", func(t *testing.T) {
+		// stockedID was bought above, as 2 pints
+		rr := doRequest(router, token, "PUT", "/variants/"+stockedID, map[string]interface{}{
+			"variant_name": "4 Pints", "sku": "123456", "size": 4, "unit": "pints",
+		})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "variant_in_use")
+
+		rr = doRequest(router, token, "PUT", "/variants/"+stockedID, map[string]interface{}{
+			"variant_name": "2 Pints", "sku": "123456", "size": 2, "unit": "litres",
+		})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, token, "PUT", "/variants/"+stockedID, map[string]interface{}{
+			"variant_name": "Two Pints", "sku": "MILK-2", "size": 2, "unit": "pints",
+		})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "Two Pints", decode(rr)["variant_name"])
+	})
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"ukoni/internal/config"
+	"ukoni/internal/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := middleware.NewMemoryRateLimitStore()
+	limit := config.RateLimit{Requests: 2, Per: time.Minute}
+	now := time.Now()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := store.Take(ctx, "key", limit, now)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	allowed, retryAfter, err := store.Take(ctx, "key", limit, now)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// Other keys have their own bucket
+	allowed, _, _ = store.Take(ctx, "other", limit, now)
+	assert.True(t, allowed)
+
+	// One token comes back every 30 seconds
+	allowed, _, _ = store.Take(ctx, "key", limit, now.Add(30*time.Second))
+	assert.True(t, allowed)
+	allowed, _, _ = store.Take(ctx, "key", limit, now.Add(30*time.Second))
+	assert.False(t, allowed)
+
+	// A refunded token can be taken again, but never beyond the limit
+	require.NoError(t, store.Refund(ctx, "key", limit))
+	allowed, _, _ = store.Take(ctx, "key", limit, now.Add(30*time.Second))
+	assert.True(t, allowed)
+	require.NoError(t, store.Refund(ctx, "other", limit))
+	require.NoError(t, store.Refund(ctx, "other", limit))
+	require.NoError(t, store.Refund(ctx, "other", limit))
+	for i := 0; i < 2; i++ {
+		allowed, _, _ = store.Take(ctx, "other", limit, now)
+		assert.True(t, allowed)
+	}
+	allowed, _, _ = store.Take(ctx, "other", limit, now)
+	assert.False(t, allowed)
+}
+
+func TestRateLimit(t *testing.T) {
+	clearDB()
+
+	loginVia := func(router http.Handler, ip, forwardedFor, email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"email": email, "password": "wrong-password"})
+		req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		req.RemoteAddr = ip + ":1234"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	login := func(router http.Handler, ip, email string) *httptest.ResponseRecorder {
+		return loginVia(router, ip, "", email)
+	}
+
+	t.Run("Per IP", func(t *testing.T) {
+		c := *cfg
+		c.AuthRateLimit = config.RateLimit{Requests: 3, Per: time.Minute}
+		router := setupRouterWithConfig(&c)
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.0.1", "nobody@example.com").Code)
+		}
+
+		rr := login(router, "10.0.0.1", "nobody@example.com")
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.Greater(t, retryAfter, 0)
+
+		var envelope errorEnvelope
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &envelope))
+		assert.Equal(t, "rate_limited", envelope.Error.Code)
+
+		// Another client is unaffected
+		assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.0.2", "nobody@example.com").Code)
+	})
+
+	t.Run("Per Account", func(t *testing.T) {
+		c := *cfg
+		c.AccountRateLimit = config.RateLimit{Requests: 2, Per: time.Minute}
+		router := setupRouterWithConfig(&c)
+
+		assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.1.1", "target@example.com").Code)
+		assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.1.2", "Target@Example.com").Code)
+
+		// Changing IP doesn't help once the account's budget is spent
+		assert.Equal(t, http.StatusTooManyRequests, login(router, "10.0.1.3", "target@example.com").Code)
+		assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.1.3", "someone-else@example.com").Code)
+	})
+
+	t.Run("Rejected Requests Are Refunded", func(t *testing.T) {
+		c := *cfg
+		c.AuthRateLimit = config.RateLimit{Requests: 3, Per: time.Minute}
+		c.AccountRateLimit = config.RateLimit{Requests: 1, Per: time.Minute}
+		router := setupRouterWithConfig(&c)
+
+		assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.2.1", "locked@example.com").Code)
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusTooManyRequests, login(router, "10.0.2.1", "locked@example.com").Code)
+		}
+
+		// Turned away by the account limit, those didn't spend the IP's budget
+		assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.2.1", "other1@example.com").Code)
+		assert.Equal(t, http.StatusUnauthorized, login(router, "10.0.2.1", "other2@example.com").Code)
+		assert.Equal(t, http.StatusTooManyRequests, login(router, "10.0.2.1", "other3@example.com").Code)
+	})
+
+	t.Run("Behind A Trusted Proxy", func(t *testing.T) {
+		c := *cfg
+		c.AuthRateLimit = config.RateLimit{Requests: 1, Per: time.Minute}
+		c.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.9.0.0/16")}
+		router := setupRouterWithConfig(&c)
+
+		// Clients behind the proxy are counted apart
+		assert.Equal(t, http.StatusUnauthorized, loginVia(router, "10.9.0.1", "203.0.113.1", "nobody@example.com").Code)
+		assert.Equal(t, http.StatusUnauthorized, loginVia(router, "10.9.0.1", "203.0.113.2", "nobody@example.com").Code)
+		assert.Equal(t, http.StatusTooManyRequests, loginVia(router, "10.9.0.2", "203.0.113.1", "nobody@example.com").Code)
+
+		// An address the client put in front of the proxy's doesn't count
+		assert.Equal(t, http.StatusTooManyRequests, loginVia(router, "10.9.0.1", "198.51.100.7, 203.0.113.1", "nobody@example.com").Code)
+
+		// Untrusted peers can't choose their address
+		assert.Equal(t, http.StatusUnauthorized, loginVia(router, "10.0.3.1", "203.0.113.3", "nobody@example.com").Code)
+		assert.Equal(t, http.StatusTooManyRequests, loginVia(router, "10.0.3.1", "203.0.113.4", "nobody@example.com").Code)
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	clearDB()
+	c := *cfg
+	c.LoginLockoutThreshold = 3
+	c.LoginLockoutBase = time.Minute
+	router := setupRouterWithConfig(&c)
+
+	createTransactionTestUser(router, "locked@example.com")
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"email": "locked@example.com", "password": password})
+		req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	unlock := func() {
+		_, err := testDB.Exec(`UPDATE users SET locked_until = NOW() - INTERVAL '1 second' WHERE email = 'locked@example.com'`)
+		require.NoError(t, err)
+	}
+	retryAfter := func(rr *httptest.ResponseRecorder) int {
+		seconds, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		return seconds
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("wrong-password").Code)
+	assert.Equal(t, http.StatusUnauthorized, login("wrong-password").Code)
+
+	rr := login("wrong-password")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, 60, retryAfter(rr))
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &envelope))
+	assert.Equal(t, "account_locked", envelope.Error.Code)
+
+	// Even the right password is refused while locked
+	assert.Equal(t, http.StatusTooManyRequests, login("password123").Code)
+
+	var logged int
+	require.NoError(t, testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'user.login_locked'`).Scan(&logged))
+	assert.Equal(t, 1, logged)
+
+	// Each further failure doubles the lockout
+	unlock()
+	rr = login("wrong-password")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, 120, retryAfter(rr))
+
+	// A successful login starts the count again
+	unlock()
+	require.Equal(t, http.StatusOK, login("password123").Code)
+	assert.Equal(t, http.StatusUnauthorized, login("wrong-password").Code)
+
+	var failures int
+	require.NoError(t, testDB.QueryRow(`SELECT failed_login_count FROM users WHERE email = 'locked@example.com'`).Scan(&failures))
+	assert.Equal(t, 1, failures)
+}
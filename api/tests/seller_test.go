@@ -110,6 +110,6 @@ func TestSellerCRUD(t *testing.T) {
 		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusInternalServerError, rr.Code) // Should fail to find
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 }
@@ -6,8 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"ukoni/internal/models"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createShoppingListTestUser(router *http.ServeMux, email string) string {
@@ -259,19 +263,204 @@ func TestShoppingListCRUD(t *testing.T) {
 	})
 
 	t.Run("Verify List Deleted", func(t *testing.T) {
-		// Get returns 404 or 500? Model returns error if not found?
-		// Handler returns 500 if error (needs better error handling, but for now expect non-success)
-		// Or GetList might return nil/err. Model GetList returns err if not found (sql.ErrNoRows).
-		// Service returns err.
 		req, _ := http.NewRequest("GET", "/shopping-lists/"+listID, nil)
 		req.Header.Set("Authorization", "Bearer "+token)
 		rr := httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
 
-		// Expecting 500 Internal Server Error because error handling in handler is generic
-		// "sql: no rows in result set"
-		// Ideally should be 404.
-		assert.NotEqual(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestShoppingListFulfilment(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createConsumptionTestUser(router)
+	inventoryID := createConsumptionTestInventory(router, token)
+
+	decodeID := func(rr *httptest.ResponseRecorder) string {
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return response["id"].(string)
+	}
+
+	milkID := createConsumptionTestCanonicalProduct(router, token, inventoryID, "Milk")
+	oatMilkID := createConsumptionTestCanonicalProduct(router, token, inventoryID, "Oat Milk")
+	breadID := createConsumptionTestCanonicalProduct(router, token, inventoryID, "Bread")
+	milkVariantID := createConsumptionTestVariant(t, router, token, inventoryID, milkID, "Milk 1L", 1.0)
+	oatMilkVariantID := createConsumptionTestVariant(t, router, token, inventoryID, oatMilkID, "Oat Milk 1L", 1.0)
+
+	rr := doRequest(router, token, "POST", "/sellers", map[string]string{"name": "Corner Shop", "type": "independent"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	rr = doRequest(router, token, "POST", "/sellers/"+decodeID(rr)+"/outlets", map[string]string{"name": "High Street", "channel": "physical"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	outletID := decodeID(rr)
+
+	rr = doRequest(router, token, "POST", "/inventories/"+inventoryID+"/shopping-lists", map[string]string{"name": "Weekly Shop"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	listID := decodeID(rr)
+
+	addItem := func(targetType, targetID string) string {
+		rr := doRequest(router, token, "POST", "/shopping-lists/"+listID+"/items", map[string]string{"target_type": targetType, "target_id": targetID})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var item models.ShoppingListItem
+		json.Unmarshal(rr.Body.Bytes(), &item)
+		assert.Equal(t, "open", item.Status)
+		return item.ID
+	}
+	milkItemID := addItem("canonical_product", milkID)
+	oatMilkItemID := addItem("product_variant", milkVariantID)
+	breadItemID := addItem("canonical_product", breadID)
+
+	// Milk is bought as asked; oat milk is bought in place of the dairy variant
+	rr = doRequest(router, token, "POST", "/inventories/"+inventoryID+"/transactions", map[string]interface{}{
+		"outlet_id":        outletID,
+		"transaction_date": time.Now().Format(time.RFC3339),
+		"items": []map[string]interface{}{
+			{"product_variant_id": milkVariantID, "quantity": 1, "shopping_list_item_id": milkItemID},
+			{"product_variant_id": milkVariantID, "quantity": 1, "shopping_list_item_id": milkItemID},
+			{"product_variant_id": oatMilkVariantID, "quantity": 1, "shopping_list_item_id": oatMilkItemID},
+		},
+	})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	t.Run("Item Status", func(t *testing.T) {
+		rr := doRequest(router, token, "GET", "/shopping-lists/"+listID+"/items", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var items []models.ShoppingListItem
+		json.Unmarshal(rr.Body.Bytes(), &items)
+		byID := map[string]models.ShoppingListItem{}
+		for _, item := range items {
+			byID[item.ID] = item
+		}
+
+		milk := byID[milkItemID]
+		assert.Equal(t, "fulfilled", milk.Status)
+		assert.Len(t, milk.TransactionItemIDs, 2)
+		assert.Equal(t, 2.0, milk.PurchasedQuantity)
+		require.NotNil(t, milk.PurchasedOutletID)
+		assert.Equal(t, outletID, *milk.PurchasedOutletID)
+
+		oatMilk := byID[oatMilkItemID]
+		assert.Equal(t, "substituted", oatMilk.Status)
+		assert.Len(t, oatMilk.TransactionItemIDs, 1)
+
+		bread := byID[breadItemID]
+		assert.Equal(t, "open", bread.Status)
+		assert.Empty(t, bread.TransactionItemIDs)
+		assert.Equal(t, 0.0, bread.PurchasedQuantity)
+	})
+
+	t.Run("List Progress", func(t *testing.T) {
+		rr := doRequest(router, token, "GET", "/shopping-lists/"+listID, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var list models.ShoppingList
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		require.NotNil(t, list.Progress)
+		assert.Equal(t, models.ShoppingListProgress{Total: 3, Open: 1, Fulfilled: 1, Substituted: 1}, *list.Progress)
+
+		rr = doRequest(router, token, "GET", "/inventories/"+inventoryID+"/shopping-lists", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var lists []models.ShoppingList
+		json.Unmarshal(rr.Body.Bytes(), &lists)
+		require.Len(t, lists, 1)
+		assert.Equal(t, 3, lists[0].Progress.Total)
+	})
+
+	t.Run("Links Stay Within The Inventory", func(t *testing.T) {
+		otherInventoryID := createConsumptionTestInventory(router, token)
+		otherBreadID := createConsumptionTestCanonicalProduct(router, token, otherInventoryID, "Bread")
+		otherVariantID := createConsumptionTestVariant(t, router, token, otherInventoryID, otherBreadID, "Loaf", 1.0)
+
+		buyInOther := func(item map[string]interface{}) *httptest.ResponseRecorder {
+			return doRequest(router, token, "POST", "/inventories/"+otherInventoryID+"/transactions", map[string]interface{}{
+				"transaction_date": time.Now().Format(time.RFC3339),
+				"items":            []map[string]interface{}{item},
+			})
+		}
+
+		rr := buyInOther(map[string]interface{}{"product_variant_id": otherVariantID, "quantity": 1, "shopping_list_item_id": breadItemID})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = buyInOther(map[string]interface{}{"product_variant_id": milkVariantID, "quantity": 1})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, token, "GET", "/shopping-lists/"+listID+"/items", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var items []models.ShoppingListItem
+		json.Unmarshal(rr.Body.Bytes(), &items)
+		for _, item := range items {
+			if item.ID == breadItemID {
+				assert.Equal(t, "open", item.Status)
+			}
+		}
+	})
+
+	t.Run("Quantity Validation", func(t *testing.T) {
+		for _, payload := range []map[string]interface{}{
+			{"target_type": "canonical_product", "target_id": milkID, "quantity": 0},
+			{"target_type": "canonical_product", "target_id": milkID, "quantity": 2, "unit": "smidgen"},
+			{"target_type": "canonical_product", "target_id": milkID, "unit": "L"},
+		} {
+			rr := doRequest(router, token, "POST", "/shopping-lists/"+listID+"/items", payload)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, payload)
+		}
+
+		rr := doRequest(router, token, "PUT", "/shopping-list-items/"+breadItemID, map[string]interface{}{"quantity": -1})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Partial Fulfilment Converts Units", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/shopping-lists/"+listID+"/items", map[string]interface{}{
+			"target_type": "canonical_product",
+			"target_id":   milkID,
+			"quantity":    1500,
+			"unit":        "ml",
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var item models.ShoppingListItem
+		json.Unmarshal(rr.Body.Bytes(), &item)
+
+		getItem := func() models.ShoppingListItem {
+			rr := doRequest(router, token, "GET", "/shopping-lists/"+listID+"/items", nil)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			var items []models.ShoppingListItem
+			json.Unmarshal(rr.Body.Bytes(), &items)
+			for _, i := range items {
+				if i.ID == item.ID {
+					return i
+				}
+			}
+			t.Fatalf("item %s not listed", item.ID)
+			return models.ShoppingListItem{}
+		}
+		buy := func() {
+			rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/transactions", map[string]interface{}{
+				"transaction_date": time.Now().Format(time.RFC3339),
+				"items": []map[string]interface{}{
+					{"product_variant_id": milkVariantID, "quantity": 1, "shopping_list_item_id": item.ID},
+				},
+			})
+			require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		// Each pack is a one litre carton
+		buy()
+		got := getItem()
+		assert.Equal(t, "partially_fulfilled", got.Status)
+		assert.Equal(t, 1000.0, got.PurchasedQuantity)
+
+		buy()
+		got = getItem()
+		assert.Equal(t, "fulfilled", got.Status)
+		assert.Equal(t, 2000.0, got.PurchasedQuantity)
+
+		// Raising the quantity wanted reopens the gap
+		rr = doRequest(router, token, "PUT", "/shopping-list-items/"+item.ID, map[string]interface{}{"quantity": 3, "unit": "L"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		json.Unmarshal(rr.Body.Bytes(), &got)
+		assert.Equal(t, "partially_fulfilled", got.Status)
+		assert.Equal(t, 2.0, got.PurchasedQuantity)
 	})
 }
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStock(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createTransactionTestUser(router, "stock@example.com")
+	inventoryID := createTransactionTestInventory(router, token)
+	variantID := createTestVariant(t, router, token, inventoryID)
+
+	// Buy two 2-pint bottles so there are 4 pints in stock
+	payload := map[string]interface{}{
+		"transaction_date": time.Now().Format(time.RFC3339),
+		"items": []map[string]interface{}{
+			{"product_variant_id": variantID, "quantity": 2.0},
+		},
+	}
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/transactions", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	adjust := func(adjustmentType string, quantity float64) *httptest.ResponseRecorder {
+		payload := map[string]interface{}{
+			"type":     adjustmentType,
+			"quantity": quantity,
+		}
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/stock/"+variantID+"/adjustments", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	getQuantity := func() float64 {
+		req, _ := http.NewRequest("GET", "/inventories/"+inventoryID+"/stock/"+variantID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var item map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &item)
+		return item["quantity"].(float64)
+	}
+
+	t.Run("List Stock", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/inventories/"+inventoryID+"/stock", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var items []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &items)
+		require.Len(t, items, 1)
+		assert.Equal(t, variantID, items[0]["product_variant_id"])
+		assert.Equal(t, "2 Pints", items[0]["variant_name"])
+		assert.Equal(t, "Milk", items[0]["product_name"])
+		assert.Equal(t, 4.0, items[0]["quantity"])
+	})
+
+	t.Run("Filter Stock By Canonical Product", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/inventories/"+inventoryID+"/stock?canonical_product_id=00000000-0000-0000-0000-000000000000", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var items []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &items)
+		assert.Len(t, items, 0)
+	})
+
+	t.Run("Spoilage Reduces Stock", func(t *testing.T) {
+		rr := adjust("spoilage", 1)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.Equal(t, "spoilage", response["adjustment_type"])
+		assert.Equal(t, 4.0, response["quantity_before"])
+		assert.Equal(t, 3.0, response["quantity_after"])
+		assert.Equal(t, 3.0, getQuantity())
+	})
+
+	t.Run("Stock Take Reconciles To Counted Quantity", func(t *testing.T) {
+		rr := adjust("stock_take", 6)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.Equal(t, 3.0, response["quantity_change"])
+		assert.Equal(t, 6.0, getQuantity())
+	})
+
+	t.Run("Adjustment Cannot Go Negative", func(t *testing.T) {
+		rr := adjust("spoilage", 100)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 6.0, getQuantity())
+	})
+
+	t.Run("Unknown Adjustment Type", func(t *testing.T) {
+		rr := adjust("magic", 1)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Adjustments Are Recorded", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/inventories/"+inventoryID+"/stock/"+variantID+"/adjustments", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var adjustments []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &adjustments)
+		assert.Len(t, adjustments, 2)
+
+		var count int
+		err := testDB.QueryRow(`SELECT count(*) FROM activity_logs WHERE inventory_id = $1 AND action = 'inventory_product.adjusted'`, inventoryID).Scan(&count)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("Non Member Is Forbidden", func(t *testing.T) {
+		otherToken := createTransactionTestUser(router, "stock-outsider@example.com")
+		req, _ := http.NewRequest("GET", "/inventories/"+inventoryID+"/stock", nil)
+		req.Header.Set("Authorization", "Bearer "+otherToken)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
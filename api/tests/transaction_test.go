@@ -8,7 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"ukoni/internal/models"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createTransactionTestUser(router *http.ServeMux, email string) string {
@@ -176,3 +179,114 @@ func TestTransactionCRUD(t *testing.T) {
 		assert.Equal(t, 2.0, item["quantity"])
 	})
 }
+
+func TestTransactionCorrection(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createConsumptionTestUser(router)
+	inventoryID := createConsumptionTestInventory(router, token)
+	milkID := createConsumptionTestCanonicalProduct(router, token, inventoryID, "Milk")
+	variantID := createConsumptionTestVariant(t, router, token, inventoryID, milkID, "Milk 1L", 1.0)
+	viewerToken := addTestMember(t, router, token, inventoryID, "correction-viewer@example.com", "viewer")
+
+	receipt := func(quantity float64) map[string]interface{} {
+		return map[string]interface{}{
+			"transaction_date": time.Now().Format(time.RFC3339),
+			"items": []map[string]interface{}{
+				{"product_variant_id": variantID, "quantity": quantity, "price_per_unit": 1.2},
+			},
+		}
+	}
+	stock := func() float64 {
+		rr := doRequest(router, token, "GET", "/inventories/"+inventoryID+"/stock/"+variantID, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var item models.StockItem
+		json.Unmarshal(rr.Body.Bytes(), &item)
+		return item.Quantity
+	}
+
+	// A receipt typed in as ten cartons instead of two
+	rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/transactions", receipt(10))
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var transaction models.Transaction
+	json.Unmarshal(rr.Body.Bytes(), &transaction)
+	require.Equal(t, 10.0, stock())
+
+	t.Run("Viewer Cannot Correct", func(t *testing.T) {
+		rr := doRequest(router, viewerToken, "PUT", "/transactions/"+transaction.ID, receipt(2))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = doRequest(router, viewerToken, "DELETE", "/transactions/"+transaction.ID, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Edit Replaces Items And Stock", func(t *testing.T) {
+		rr := doRequest(router, token, "PUT", "/transactions/"+transaction.ID, receipt(2))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var updated map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &updated)
+		assert.Equal(t, 2.4, updated["total_amount"])
+		assert.Len(t, updated["items"], 1)
+		assert.Equal(t, 2.0, stock())
+
+		var before, after float64
+		err := testDB.QueryRow(`
+			SELECT (metadata->'before'->'items'->0->>'quantity')::float, (metadata->'after'->'items'->0->>'quantity')::float
+			FROM activity_logs WHERE entity_id = $1 AND action = 'transaction.updated'
+		`, transaction.ID).Scan(&before, &after)
+		require.NoError(t, err)
+		assert.Equal(t, 10.0, before)
+		assert.Equal(t, 2.0, after)
+
+		rr = doRequest(router, token, "PUT", "/transactions/"+transaction.ID, receipt(0))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		// Leaving out the date doesn't reset it
+		undated := receipt(2)
+		delete(undated, "transaction_date")
+		rr = doRequest(router, token, "PUT", "/transactions/"+transaction.ID, undated)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "transaction_date")
+	})
+
+	t.Run("Used Stock Cannot Be Taken Back", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/consumption-events", map[string]interface{}{
+			"canonical_product_id": milkID,
+			"quantity":             1.5,
+			"unit":                 "L",
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		require.Equal(t, 0.5, stock())
+
+		rr = doRequest(router, token, "DELETE", "/transactions/"+transaction.ID, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		rr = doRequest(router, token, "PUT", "/transactions/"+transaction.ID, receipt(1))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, 0.5, stock())
+
+		// Raising the count only needs the difference on hand
+		rr = doRequest(router, token, "PUT", "/transactions/"+transaction.ID, receipt(3))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, 1.5, stock())
+	})
+
+	t.Run("Void", func(t *testing.T) {
+		rr := doRequest(router, token, "POST", "/inventories/"+inventoryID+"/transactions", receipt(1))
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var extra models.Transaction
+		json.Unmarshal(rr.Body.Bytes(), &extra)
+		require.Equal(t, 2.5, stock())
+
+		rr = doRequest(router, token, "DELETE", "/transactions/"+extra.ID, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+		assert.Equal(t, 1.5, stock())
+
+		rr = doRequest(router, token, "GET", "/transactions/"+extra.ID, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		var count int
+		err := testDB.QueryRow(`SELECT count(*) FROM activity_logs WHERE entity_id = $1 AND action = 'transaction.deleted'`, extra.ID).Scan(&count)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
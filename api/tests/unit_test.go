@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ukoni/internal/models"
+	"ukoni/internal/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitConversion(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createConsumptionTestUser(router)
+	inventoryID := createConsumptionTestInventory(router, token)
+	eggsID := createConsumptionTestCanonicalProduct(router, token, inventoryID, "Eggs")
+
+	convert := func(quantity, from, to, canonicalProductID string) *httptest.ResponseRecorder {
+		query := url.Values{}
+		query.Set("quantity", quantity)
+		query.Set("from", from)
+		query.Set("to", to)
+		if canonicalProductID != "" {
+			query.Set("canonical_product_id", canonicalProductID)
+		}
+		req, _ := http.NewRequest("GET", "/units/convert?"+query.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("List Units", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/units", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var units []services.Unit
+		json.Unmarshal(rr.Body.Bytes(), &units)
+		codes := map[string]string{}
+		for _, u := range units {
+			codes[u.Code] = u.Dimension
+		}
+		assert.Equal(t, "mass", codes["kg"])
+		assert.Equal(t, "volume", codes["pint"])
+		assert.Equal(t, "count", codes["dozen"])
+	})
+
+	t.Run("Convert Within A Dimension", func(t *testing.T) {
+		rr := convert("250", "grams", "kg", "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var conversion services.Conversion
+		json.Unmarshal(rr.Body.Bytes(), &conversion)
+		assert.Equal(t, 0.25, conversion.Quantity)
+		assert.Equal(t, "kg", conversion.Unit)
+		assert.Equal(t, 1.0, conversion.Confidence)
+
+		rr = convert("2", "Pints", "ml", "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		json.Unmarshal(rr.Body.Bytes(), &conversion)
+		assert.Equal(t, 1136.5225, conversion.Quantity)
+	})
+
+	t.Run("Unknown Unit", func(t *testing.T) {
+		rr := convert("1", "smidgen", "g", "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("No Conversion Across Dimensions", func(t *testing.T) {
+		rr := convert("3", "each", "g", eggsID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	var conversionID string
+
+	t.Run("Create Piece Weight", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"from_unit":  "piece",
+			"to_unit":    "g",
+			"factor":     60.0,
+			"confidence": 0.8,
+		}
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/canonical-products/"+eggsID+"/unit-conversions", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var conversion models.UnitConversion
+		json.Unmarshal(rr.Body.Bytes(), &conversion)
+		conversionID = conversion.ID
+
+		// The same pair in reverse is a duplicate
+		payload["from_unit"], payload["to_unit"] = "g", "piece"
+		body, _ = json.Marshal(payload)
+		req, _ = http.NewRequest("POST", "/canonical-products/"+eggsID+"/unit-conversions", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Registry Units Cannot Be Redefined", func(t *testing.T) {
+		payload := map[string]interface{}{"from_unit": "kg", "to_unit": "g", "factor": 900.0}
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/canonical-products/"+eggsID+"/unit-conversions", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Convert Through Product Edge", func(t *testing.T) {
+		rr := convert("1", "dozen", "kg", eggsID)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var conversion services.Conversion
+		json.Unmarshal(rr.Body.Bytes(), &conversion)
+		assert.Equal(t, 0.72, conversion.Quantity)
+		assert.Equal(t, 0.8, conversion.Confidence)
+		assert.Equal(t, []string{"dozen", "piece", "g", "kg"}, conversion.Path)
+
+		// Without the product the edge is not available
+		rr = convert("1", "dozen", "kg", "")
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("Delete Conversion", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/unit-conversions/"+conversionID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = convert("1", "dozen", "kg", eggsID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+func TestUnitAwareStock(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+	token := createConsumptionTestUser(router)
+	inventoryID := createConsumptionTestInventory(router, token)
+	cpID := createConsumptionTestCanonicalProduct(router, token, inventoryID, "Milk")
+
+	// Two litres of milk held in a unit other than the one it is consumed in
+	variantID := createConsumptionTestVariant(t, router, token, inventoryID, cpID, "Milk 1L", 1.0)
+	buyConsumptionTestVariant(t, router, token, inventoryID, variantID, 2)
+
+	t.Run("Consumption Converts Into Stock Unit", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"canonical_product_id": cpID,
+			"quantity":             250.0,
+			"unit":                 "ml",
+		}
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/inventories/"+inventoryID+"/consumption-events", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var event models.ConsumptionEvent
+		json.Unmarshal(rr.Body.Bytes(), &event)
+		require.Len(t, event.Allocations, 1)
+		assert.Equal(t, 0.25, event.Allocations[0].Quantity)
+		assert.Equal(t, "L", *event.Allocations[0].Unit)
+		assert.Equal(t, 1.0, event.Allocations[0].Confidence)
+	})
+
+	t.Run("Stock Total In Requested Unit", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/canonical-products/"+cpID+"/stock?unit=pint", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var total services.StockTotal
+		json.Unmarshal(rr.Body.Bytes(), &total)
+		assert.Equal(t, "pint", *total.Unit)
+		assert.InDelta(t, 3.0796, total.Quantity, 0.0001)
+		assert.Len(t, total.Items, 1)
+		assert.Empty(t, total.Unconverted)
+	})
+
+	t.Run("Stock Total Defaults To Stock Unit", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/canonical-products/"+cpID+"/stock", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var total services.StockTotal
+		json.Unmarshal(rr.Body.Bytes(), &total)
+		assert.Equal(t, "l", *total.Unit)
+		assert.Equal(t, 1.75, total.Quantity)
+	})
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	token := createTransactionTestUser(router, "profile@example.com")
+	createTransactionTestUser(router, "taken@example.com")
+
+	t.Run("Get Me", func(t *testing.T) {
+		rr := doRequest(router, token, "GET", "/me", nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var me map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &me)
+		assert.Equal(t, "profile@example.com", me["email"])
+		assert.NotContains(t, me, "password_hash")
+	})
+
+	t.Run("Update Name", func(t *testing.T) {
+		rr := doRequest(router, token, "PATCH", "/me", map[string]string{"name": "Renamed"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var me map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &me)
+		assert.Equal(t, "Renamed", me["name"])
+
+		rr = doRequest(router, token, "PATCH", "/me", map[string]string{"name": "  "})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Change Email Needs Verifying Again", func(t *testing.T) {
+		verifyTestUser(t, router, "profile@example.com")
+
+		rr := doRequest(router, token, "PATCH", "/me", map[string]string{"email": "TAKEN@example.com"})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = doRequest(router, token, "PATCH", "/me", map[string]string{"email": "not-an-email"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doRequest(router, token, "PATCH", "/me", map[string]string{"email": "moved@example.com"})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var me map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &me)
+		assert.Equal(t, "moved@example.com", me["email"])
+		assert.Nil(t, me["email_verified_at"])
+
+		verifyTestUser(t, router, "moved@example.com")
+		rr = doRequest(router, token, "GET", "/me", nil)
+		json.Unmarshal(rr.Body.Bytes(), &me)
+		assert.NotNil(t, me["email_verified_at"])
+
+		var logged int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'user.updated' AND metadata->>'new_email' = 'moved@example.com'`).Scan(&logged)
+		assert.Equal(t, 1, logged)
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	clearDB()
+	router := setupRouter()
+
+	leaverToken := createTransactionTestUser(router, "leaver@example.com")
+	var leaverID string
+	testDB.QueryRow(`SELECT id FROM users WHERE email = 'leaver@example.com'`).Scan(&leaverID)
+
+	// One inventory with an admin to take over, one with nobody suitable.
+	handedOver := createTransactionTestInventory(router, leaverToken)
+	adminToken := addTestMember(t, router, leaverToken, handedOver, "admin@example.com", "admin")
+	orphaned := createTransactionTestInventory(router, leaverToken)
+	addTestMember(t, router, leaverToken, orphaned, "viewer@example.com", "viewer")
+
+	// The leaver is also a member elsewhere, and their email is recorded in
+	// that inventory's history.
+	elsewhere := createTransactionTestInventory(router, adminToken)
+	rr := doRequest(router, adminToken, "POST", "/inventories/"+elsewhere+"/invitations", map[string]string{"email": "leaver@example.com", "role": "viewer"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var invitation map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &invitation)
+	rr = doRequest(router, adminToken, "POST", "/invitations/"+invitation["id"].(string)+"/resend", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = doRequest(router, leaverToken, "POST", "/invitations/accept", map[string]string{"token": invitationToken(t, invitation["id"].(string))})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// An ownership offer the leaver never saw through
+	var adminID string
+	testDB.QueryRow(`SELECT id FROM users WHERE email = 'admin@example.com'`).Scan(&adminID)
+	rr = doRequest(router, leaverToken, "POST", "/inventories/"+handedOver+"/transfer", map[string]string{"user_id": adminID})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		rr := doRequest(router, leaverToken, "DELETE", "/me", map[string]string{"password": "wrong"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Delete Account", func(t *testing.T) {
+		rr := doRequest(router, leaverToken, "DELETE", "/me", map[string]string{"password": "password123"})
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, doRequest(router, leaverToken, "GET", "/me", nil).Code)
+		rr = doRequest(router, "", "POST", "/login", map[string]string{"email": "leaver@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		var owner string
+		testDB.QueryRow(`SELECT owner_user_id FROM inventories WHERE id = $1`, handedOver).Scan(&owner)
+		assert.Equal(t, adminID, owner)
+
+		var pending int
+		testDB.QueryRow(`SELECT COUNT(*) FROM inventory_transfers WHERE (from_user_id = $1 OR to_user_id = $1) AND status = 'pending'`, leaverID).Scan(&pending)
+		assert.Equal(t, 0, pending)
+
+		var archivedAt *time.Time
+		testDB.QueryRow(`SELECT archived_at FROM inventories WHERE id = $1`, orphaned).Scan(&archivedAt)
+		assert.NotNil(t, archivedAt)
+
+		var memberships int
+		testDB.QueryRow(`SELECT COUNT(*) FROM inventory_memberships WHERE user_id = $1 AND deleted_at IS NULL`, leaverID).Scan(&memberships)
+		assert.Equal(t, 0, memberships)
+
+		var email, name string
+		var deletedAt *time.Time
+		testDB.QueryRow(`SELECT email, name, deleted_at FROM users WHERE id = $1`, leaverID).Scan(&email, &name, &deletedAt)
+		assert.NotEqual(t, "leaver@example.com", email)
+		assert.NotNil(t, deletedAt)
+
+		var mentions int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE metadata::text LIKE '%leaver@example.com%'`).Scan(&mentions)
+		assert.Equal(t, 0, mentions)
+
+		var logged int
+		testDB.QueryRow(`SELECT COUNT(*) FROM activity_logs WHERE action = 'inventory.ownership_transferred' AND inventory_id = $1`, handedOver).Scan(&logged)
+		assert.Equal(t, 1, logged)
+	})
+
+	t.Run("Email Can Be Used Again", func(t *testing.T) {
+		rr := doRequest(router, "", "POST", "/signup", map[string]string{"name": "Returner", "email": "leaver@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	})
+}